@@ -0,0 +1,66 @@
+// Command bundletool browses and extracts the files of a bundle index (_.index.bin),
+// as used by the Steam and Epic installs.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/user/ggpkgo/internal/cli"
+	"github.com/user/ggpkgo/internal/source"
+)
+
+const usageText = `Usage: bundletool -index <_.index.bin> <command> [arguments]
+
+The commands are the ones of ggpktool, which also reads Content.ggpk files.
+
+Commands:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("bundletool", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	indexPath := flags.String("index", "", "Path to the _.index.bin file (required)")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usageText)
+		cli.WriteCommands(stderr)
+		fmt.Fprint(stderr, "\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return cli.ExitOK
+		}
+		return cli.ExitUsage
+	}
+	if *indexPath == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return cli.ExitUsage
+	}
+	if cli.Lookup(flags.Arg(0)) == nil {
+		fmt.Fprintf(stderr, "Error: unknown command '%s'\n", flags.Arg(0))
+		flags.Usage()
+		return cli.ExitUsage
+	}
+
+	src, err := source.Open(*indexPath, source.Options{})
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return cli.ExitCode(err)
+	}
+	defer src.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return cli.Run(ctx, src, flags.Args(), stdout, stderr)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/bundletest"
+	"github.com/user/ggpkgo/internal/cli"
+)
+
+func createTestIndex(t *testing.T) string {
+	t.Helper()
+	return bundletest.WriteIndex(t, t.TempDir(), map[string]map[string][]byte{
+		"Data/Bundle0": {
+			"data/mods.dat64":  []byte("mods"),
+			"data/items.dat64": []byte("items data"),
+		},
+		"Art/Bundle1": {
+			"art/textures/a.dds": []byte("texture a"),
+			"art/textures/b.dds": []byte("texture b"),
+			"readme.txt":         []byte("hello bundles"),
+		},
+	})
+}
+
+// runTool runs the command line and returns the exit code, stdout and stderr.
+func runTool(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestBundleTool_Ls(t *testing.T) {
+	index := createTestIndex(t)
+	code, out, errOut := runTool(t, "-index", index, "ls")
+	if code != cli.ExitOK {
+		t.Fatalf("ls failed with code %d: %s", code, errOut)
+	}
+	if out != "art/\ndata/\nreadme.txt\n" {
+		t.Errorf("Unexpected ls output:\n%s", out)
+	}
+
+	code, out, _ = runTool(t, "-index", index, "ls", "art/textures")
+	if code != cli.ExitOK || out != "a.dds\nb.dds\n" {
+		t.Errorf("Unexpected ls output for art/textures (code %d):\n%s", code, out)
+	}
+
+	if code, _, _ := runTool(t, "-index", index, "ls", "missing"); code != cli.ExitNotFound {
+		t.Errorf("Expected exit code %d for a missing path, got %d", cli.ExitNotFound, code)
+	}
+}
+
+func TestBundleTool_Tree(t *testing.T) {
+	code, out, errOut := runTool(t, "-index", createTestIndex(t), "tree")
+	if code != cli.ExitOK {
+		t.Fatalf("tree failed with code %d: %s", code, errOut)
+	}
+	expected := "/\n  art/\n    textures/\n      a.dds\n      b.dds\n  data/\n    items.dat64\n    mods.dat64\n  readme.txt\n"
+	if out != expected {
+		t.Errorf("Unexpected tree output:\n%s\nexpected:\n%s", out, expected)
+	}
+}
+
+func TestBundleTool_Cat(t *testing.T) {
+	index := createTestIndex(t)
+	code, out, errOut := runTool(t, "-index", index, "cat", "data/items.dat64")
+	if code != cli.ExitOK {
+		t.Fatalf("cat failed with code %d: %s", code, errOut)
+	}
+	if out != "items data" {
+		t.Errorf("Unexpected cat output %q", out)
+	}
+	if code, _, _ := runTool(t, "-index", index, "cat", "data"); code != cli.ExitError {
+		t.Errorf("Expected exit code %d for cat of a directory, got %d", cli.ExitError, code)
+	}
+	if code, _, _ := runTool(t, "-index", index, "cat"); code != cli.ExitUsage {
+		t.Errorf("Expected exit code %d for cat without path, got %d", cli.ExitUsage, code)
+	}
+}
+
+func TestBundleTool_Extract(t *testing.T) {
+	index := createTestIndex(t)
+	for _, tc := range []struct {
+		arg   string
+		files []string
+	}{
+		{"readme.txt", []string{"readme.txt"}},
+		{"art", []string{"art/textures/a.dds", "art/textures/b.dds"}},
+		{"*/*.dat64", []string{"data/items.dat64", "data/mods.dat64"}},
+	} {
+		outDir := t.TempDir()
+		code, out, errOut := runTool(t, "-index", index, "extract", "-out", outDir, tc.arg)
+		if code != cli.ExitOK {
+			t.Fatalf("extract %s failed with code %d: %s", tc.arg, code, errOut)
+		}
+		if out != strings.Join(tc.files, "\n")+"\n" {
+			t.Errorf("Unexpected extract output for %s:\n%s", tc.arg, out)
+		}
+		for _, f := range tc.files {
+			if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(f))); err != nil {
+				t.Errorf("extract %s did not write %s: %v", tc.arg, f, err)
+			}
+		}
+	}
+	if code, _, _ := runTool(t, "-index", index, "extract", "-out", t.TempDir(), "*.nothing"); code != cli.ExitNotFound {
+		t.Errorf("Expected exit code %d when nothing matches, got %d", cli.ExitNotFound, code)
+	}
+}
+
+func TestBundleTool_Stat(t *testing.T) {
+	code, out, errOut := runTool(t, "-index", createTestIndex(t), "stat", "art/textures/b.dds")
+	if code != cli.ExitOK {
+		t.Fatalf("stat failed with code %d: %s", code, errOut)
+	}
+	for _, want := range []string{"Bundle:   Art/Bundle1\n", "Offset:   9\n", "Size:     9\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("stat output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestBundleTool_Find(t *testing.T) {
+	index := createTestIndex(t)
+	code, out, _ := runTool(t, "-index", index, "find", "*.dds")
+	if code != cli.ExitOK || out != "art/textures/a.dds\nart/textures/b.dds\n" {
+		t.Errorf("Unexpected find output (code %d):\n%s", code, out)
+	}
+	code, out, _ = runTool(t, "-index", index, "find", "data/m*")
+	if code != cli.ExitOK || out != "data/mods.dat64\n" {
+		t.Errorf("Unexpected find output for full path pattern (code %d):\n%s", code, out)
+	}
+}
+
+func TestBundleTool_Usage(t *testing.T) {
+	if code, _, _ := runTool(t, "ls"); code != cli.ExitUsage {
+		t.Errorf("Expected exit code %d without -index, got %d", cli.ExitUsage, code)
+	}
+	if code, _, _ := runTool(t, "-index", createTestIndex(t), "frobnicate"); code != cli.ExitUsage {
+		t.Errorf("Expected exit code %d for an unknown command, got %d", cli.ExitUsage, code)
+	}
+	if code, _, _ := runTool(t, "-index", filepath.Join(t.TempDir(), "missing.bin"), "ls"); code != cli.ExitNotFound {
+		t.Errorf("Expected exit code %d for a missing index, got %d", cli.ExitNotFound, code)
+	}
+}
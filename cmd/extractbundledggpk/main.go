@@ -1,45 +1,24 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
-	// "strings" // No longer used directly
 
+	"github.com/user/ggpkgo/internal/source"
 	"github.com/user/ggpkgo/pkg/bundle"
 	"github.com/user/ggpkgo/pkg/bundledggpk"
 	"github.com/user/ggpkgo/pkg/ggpk"
 )
 
-// Copied from cmd/ggpktool/main.go - consider refactoring to a shared utility package if more tools are made.
-func listContentsRecursiveSimple(node ggpk.TreeNode, currentIndent string, ggpkFile *ggpk.GGPKFile) error {
-	if node == nil {
-		return nil
-	}
-	fmt.Printf("%s%s\n", currentIndent, node.GetName())
-
-	if dirNode, ok := node.(*ggpk.DirectoryRecord); ok {
-		children, err := dirNode.GetChildren(ggpkFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting children for %s: %v\n", node.GetPath(), err)
-			return nil
-		}
-		for _, child := range children {
-			if err := listContentsRecursiveSimple(child, currentIndent+"  ", ggpkFile); err != nil {
-				// Log error or decide to bubble up
-				fmt.Fprintf(os.Stderr, "Error processing child of %s: %v\n", node.GetPath(), err)
-			}
-		}
-	}
-	return nil
-}
-
-
 func main() {
 	indexBinPath := flag.String("index", "", "Path to the _.index.bin file (required)")
 	ggpkInBundlePath := flag.String("ggpkpath", "", "Path of the GGPK file within the bundle system (e.g., Bundles2/Content.ggpk or _.ggpk) (required)")
-	action := flag.String("action", "list", "Action: list, extract")
+	action := flag.String("action", "list", "Action: list, extract, verify (checks all bundles of the index and prints a JSON report)")
 	itemPath := flag.String("itempath", "", "Path of the item within the bundled GGPK to extract (for action=extract)")
 	outputPath := flag.String("out", ".", "Output directory for extracted file (for action=extract)")
 
@@ -50,6 +29,9 @@ func main() {
 		flag.Usage()
 		os.Exit(1)
 	}
+	if *action == "verify" {
+		os.Exit(verifyIndex(*indexBinPath))
+	}
 	if *ggpkInBundlePath == "" {
 		fmt.Fprintln(os.Stderr, "Error: -ggpkpath flag (path of GGPK within bundle) is required.")
 		flag.Usage()
@@ -98,8 +80,8 @@ func main() {
 	switch *action {
 	case "list":
 		fmt.Println("Contents of bundled GGPK:")
-		// Use a simplified listing function (can be refactored from ggpktool if complex)
-		if err := listContentsRecursiveSimple(bundledGGPKFile.Root, "", bundledGGPKFile); err != nil {
+		src := source.FromGGPK(*ggpkInBundlePath, bundledGGPKFile)
+		if err := source.WriteTree(os.Stdout, src, src.Root()); err != nil {
 			fmt.Fprintf(os.Stderr, "Error listing contents of bundled GGPK: %v\n", err)
 			os.Exit(1)
 		}
@@ -126,7 +108,7 @@ func main() {
 			os.Exit(1)
 		}
 
-		fileData, err := bundledGGPKFile.ReadFileData(fileNode)
+		fileData, err := bundledGGPKFile.ReadRawData(fileNode)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading data for item '%s' from bundled GGPK: %v\n", *itemPath, err)
 			os.Exit(1)
@@ -145,8 +127,43 @@ func main() {
 		fmt.Printf("Successfully extracted '%s' to '%s'\n", *itemPath, outFilePath)
 
 	default:
-		fmt.Fprintf(os.Stderr, "Error: Unknown action '%s'. Supported actions: list, extract.\n", *action)
+		fmt.Fprintf(os.Stderr, "Error: Unknown action '%s'. Supported actions: list, extract, verify.\n", *action)
 		flag.Usage()
 		os.Exit(1)
 	}
 }
+
+// verifyIndex checks every bundle of the index and prints the report as JSON to stdout.
+// It returns the exit code: 0 if no damage was found, 1 if some was, 2 if the check itself failed.
+func verifyIndex(indexPath string) int {
+	idx, err := bundle.OpenIndex(indexPath, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening bundle index %s: %v\n", indexPath, err)
+		return 2
+	}
+	if _, err := idx.ParsePaths(); err != nil {
+		// Files are reported by hash instead
+		fmt.Fprintf(os.Stderr, "Warning: failed to parse paths: %v\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := idx.Verify(ctx)
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(report); encErr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", encErr)
+			return 2
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying bundles: %v\n", err)
+		return 2
+	}
+	if !report.OK() {
+		fmt.Fprintf(os.Stderr, "%d issue(s) found in %d bundle(s)\n", len(report.Issues), len(report.DamagedBundles()))
+		return 1
+	}
+	return 0
+}
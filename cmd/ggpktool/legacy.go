@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/user/ggpkgo/internal/cli"
+	"github.com/user/ggpkgo/internal/source"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// runLegacy runs the original interface: -ggpk file -action list|extract|extract-all.
+func runLegacy(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ggpktool", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	ggpkPath := flags.String("ggpk", "", "Path to the GGPK file (required)")
+	action := flags.String("action", "list", "Action to perform: list, extract, extract-all")
+	itemPath := flags.String("path", "", "Path of the item within GGPK to extract")
+	outputPath := flags.String("out", ".", "Output directory for extracted files/all files")
+	var includes, excludes cli.StringList
+	flags.Var(&includes, "include", "For extract-all, only extract files matching this glob or re: regular expression; may be repeated")
+	flags.Var(&excludes, "exclude", "For extract-all, skip files and directories matching this glob or re: regular expression; may be repeated")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 1
+	}
+
+	if *ggpkPath == "" {
+		fmt.Fprintln(stdout, "Error: -ggpk flag is required")
+		flags.Usage()
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "GGPK Tool - Go Version\n")
+	fmt.Fprintf(stdout, "Processing GGPK file: %s\n", *ggpkPath)
+	fmt.Fprintf(stdout, "Action: %s\n", *action)
+
+	// Open the GGPK file
+	gf, err := ggpk.Open(*ggpkPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error opening GGPK file %s: %v\n", *ggpkPath, err)
+		return 1
+	}
+	defer gf.Close()
+
+	switch *action {
+	case "list":
+		src := source.FromGGPK(*ggpkPath, gf)
+		if err := source.WriteTree(stdout, src, src.Root()); err != nil {
+			fmt.Fprintf(stderr, "Error listing contents: %v\n", err)
+			return 1
+		}
+	case "extract":
+		if *itemPath == "" {
+			fmt.Fprintln(stdout, "Error: -path flag is required for 'extract' action")
+			return 1
+		}
+		// Ensure output path is a directory, use itemPath's base name for the file
+		outFilePath := filepath.Join(*outputPath, filepath.Base(*itemPath))
+		fmt.Fprintf(stdout, "Extracting '%s' to '%s'\n", *itemPath, outFilePath)
+		if err := extractFile(gf, *itemPath, outFilePath); err != nil {
+			fmt.Fprintf(stderr, "Error extracting file '%s': %v\n", *itemPath, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "File '%s' extracted to '%s'\n", *itemPath, outFilePath)
+	case "extract-all":
+		filter, err := source.NewFilter(includes, excludes)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(stdout, "Extracting all files...")
+		if err := extractAllFiles(gf, gf.Root, *outputPath, filter, stdout, stderr); err != nil {
+			fmt.Fprintf(stderr, "Error during extract-all: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(stdout, "All files extracted to:", *outputPath)
+	default:
+		fmt.Fprintf(stderr, "Error: Unknown action '%s'\n", *action)
+		flags.Usage()
+		return 1
+	}
+	return 0
+}
+
+// extractFile extracts a single file from GGPK to the specified output path.
+func extractFile(gf *ggpk.GGPKFile, itemPath string, outFilePath string) error {
+	node, err := gf.GetNodeByPath(itemPath)
+	if err != nil {
+		return err
+	}
+
+	fileNode, ok := node.(*ggpk.FileRecord)
+	if !ok {
+		return fmt.Errorf("path '%s' is not a file", itemPath)
+	}
+
+	fileData, err := gf.ReadRawData(fileNode)
+	if err != nil {
+		return fmt.Errorf("failed to read file data for '%s': %w", itemPath, err)
+	}
+
+	// Ensure output directory exists
+	outDir := filepath.Dir(outFilePath)
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory '%s': %w", outDir, err)
+	}
+
+	err = os.WriteFile(outFilePath, fileData, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write extracted file to '%s': %w", outFilePath, err)
+	}
+	return nil
+}
+
+// extractAllFiles extracts all files below a directory node, in name order.
+// Directories that can't contain files selected by filter are not visited.
+func extractAllFiles(gf *ggpk.GGPKFile, node ggpk.TreeNode, baseOutputDir string, filter *source.Filter, stdout, stderr io.Writer) error {
+	if node == nil {
+		return nil
+	}
+
+	return ggpk.Walk(gf, node, func(nodePath string, node ggpk.TreeNode, err error) error {
+		if err != nil {
+			// For extract-all, skip problematic directories and continue with other parts
+			fmt.Fprintf(stderr, "Error getting children for %s: %v. Skipping directory.\n", nodePath, err)
+			return nil
+		}
+
+		_, isDir := node.(*ggpk.DirectoryRecord)
+		if nodePath != "" && !filepath.IsLocal(filepath.FromSlash(nodePath)) {
+			// Names come from the GGPK unchecked, like ".."
+			fmt.Fprintf(stderr, "Refusing to extract %s outside %s. Skipping.\n", nodePath, baseOutputDir)
+			if isDir {
+				return ggpk.SkipDir
+			}
+			return nil
+		}
+
+		if isDir {
+			if !filter.Enter(nodePath) {
+				return ggpk.SkipDir
+			}
+			// If it's the root node and its path is "", we don't want to create a "" folder.
+			// Children's paths will be relative to this.
+			if nodePath != "" {
+				currentOutDir := filepath.Join(baseOutputDir, filepath.FromSlash(nodePath))
+				if err := os.MkdirAll(currentOutDir, 0755); err != nil {
+					return fmt.Errorf("failed to create output directory %s: %w", currentOutDir, err)
+				}
+			}
+			return nil
+		}
+
+		fileNode := node.(*ggpk.FileRecord)
+		if !filter.Match(nodePath) {
+			return nil
+		}
+		// nodePath is like "Data/Items.dat" or "RootFile.txt"; keep the directory structure
+		outFilePath := filepath.Join(baseOutputDir, filepath.FromSlash(nodePath))
+
+		fmt.Fprintf(stdout, "Extracting %s -> %s\n", nodePath, outFilePath)
+
+		// Ensure directory for the file exists
+		outDir := filepath.Dir(outFilePath)
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s for file %s: %w", outDir, nodePath, err)
+		}
+
+		fileData, err := gf.ReadRawData(fileNode)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading data for %s: %v. Skipping.\n", nodePath, err)
+			return nil // Continue with other files
+		}
+		if err := os.WriteFile(outFilePath, fileData, 0644); err != nil {
+			fmt.Fprintf(stderr, "Error writing file %s to %s: %v. Skipping.\n", nodePath, outFilePath, err)
+			return nil // Continue with other files
+		}
+		return nil
+	})
+}
@@ -251,3 +251,17 @@ func TestGGPKTool_ExtractAllAction(t *testing.T) {
 
 // TODO: Add tests for cmd/extractbundledggpk (more complex due to needing bundle files)
 // TODO: Add basic invocation tests for cmd/browseggpk
+
+func TestGGPKTool_Subcommand(t *testing.T) {
+	ggpkFilePath := createTestGGPKFile(t)
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"cat", ggpkFilePath, "file1.txt"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("cat failed with code %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "hello world from GGPK" {
+		t.Errorf("Unexpected cat output %q", stdout.String())
+	}
+	if !isLegacy([]string{"-out", "dir", "-ggpk=" + ggpkFilePath}) || isLegacy([]string{"ls", "-kind", "ggpk", ggpkFilePath}) {
+		t.Error("isLegacy does not tell the flag interface from subcommands")
+	}
+}
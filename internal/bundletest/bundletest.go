@@ -0,0 +1,150 @@
+// Package bundletest builds small bundle indexes for tests.
+package bundletest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/user/ggpkgo/pkg/bundle"
+)
+
+// ChunkSize is the uncompressed chunk size of built bundles.
+const ChunkSize = 262144
+
+// fnvMagic is the PathHash of the first directory record in indexes hashing paths with FNV-1a.
+const fnvMagic = 0x07E47507B4A92E53
+
+// Bundle returns the bytes of a bundle storing data uncompressed (OodleCompressorNone).
+func Bundle(data []byte) []byte {
+	chunkCount := (len(data) + ChunkSize - 1) / ChunkSize
+	header := bundle.BundleHeader{
+		UncompressedSize:     int32(len(data)),
+		CompressedSize:       int32(len(data)),
+		HeadSize:             int32(48 + chunkCount*4),
+		Compressor:           int32(bundle.OodleCompressorNone),
+		Unknown1:             1,
+		UncompressedSizeLong: int64(len(data)),
+		CompressedSizeLong:   int64(len(data)),
+		ChunkCount:           int32(chunkCount),
+		ChunkSize:            ChunkSize,
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &header)
+	for i := 0; i < chunkCount; i++ {
+		binary.Write(&buf, binary.LittleEndian, int32(min(ChunkSize, len(data)-i*ChunkSize)))
+	}
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// PathHash returns the FNV-1a hash the built indexes use for a file path.
+func PathHash(path string) uint64 {
+	hash := uint64(0xCBF29CE484222325)
+	for _, b := range []byte(strings.ToLower(strings.TrimSuffix(path, "/"))) {
+		hash = (hash ^ uint64(b)) * 0x100000001B3
+	}
+	hash = (hash ^ '+') * 0x100000001B3
+	return (hash ^ '+') * 0x100000001B3
+}
+
+// WriteIndex writes an _.index.bin and its bundles into dir and returns the path of the index.
+// bundles maps bundle paths (without ".bundle.bin") to the files they contain, keyed by file path.
+// File paths are stored so that Index.ParsePaths resolves them.
+func WriteIndex(tb testing.TB, dir string, bundles map[string]map[string][]byte) string {
+	tb.Helper()
+	var index, paths bytes.Buffer
+
+	bundleNames := sortedKeys(bundles)
+	binary.Write(&index, binary.LittleEndian, int32(len(bundleNames)))
+	type fileEntry struct {
+		path           string
+		bundle         int32
+		offset, length int32
+	}
+	var files []fileEntry
+	for i, name := range bundleNames {
+		var content bytes.Buffer
+		for _, path := range sortedKeys(bundles[name]) {
+			data := bundles[name][path]
+			files = append(files, fileEntry{path, int32(i), int32(content.Len()), int32(len(data))})
+			content.Write(data)
+		}
+		bundlePath := filepath.Join(dir, filepath.FromSlash(name)+".bundle.bin")
+		if err := os.MkdirAll(filepath.Dir(bundlePath), 0o755); err != nil {
+			tb.Fatalf("Failed to create bundle directory: %v", err)
+		}
+		if err := os.WriteFile(bundlePath, Bundle(content.Bytes()), 0o644); err != nil {
+			tb.Fatalf("Failed to write bundle: %v", err)
+		}
+		binary.Write(&index, binary.LittleEndian, int32(len(name)))
+		index.WriteString(name)
+		binary.Write(&index, binary.LittleEndian, int32(content.Len()))
+	}
+
+	binary.Write(&index, binary.LittleEndian, int32(len(files)))
+	for _, f := range files {
+		binary.Write(&index, binary.LittleEndian, PathHash(f.path))
+		binary.Write(&index, binary.LittleEndian, f.bundle)
+		binary.Write(&index, binary.LittleEndian, f.offset)
+		binary.Write(&index, binary.LittleEndian, f.length)
+		// Every path is a complete segment outside of a base block
+		binary.Write(&paths, binary.LittleEndian, int32(1))
+		paths.WriteString(f.path)
+		paths.WriteByte(0)
+	}
+
+	binary.Write(&index, binary.LittleEndian, int32(1))
+	binary.Write(&index, binary.LittleEndian, &bundle.IndexDirectoryRecord{
+		PathHash: fnvMagic,
+		Offset:   0,
+		Size:     int32(paths.Len()),
+	})
+	index.Write(paths.Bytes())
+
+	indexPath := filepath.Join(dir, "_.index.bin")
+	if err := os.WriteFile(indexPath, Bundle(index.Bytes()), 0o644); err != nil {
+		tb.Fatalf("Failed to write index: %v", err)
+	}
+	return indexPath
+}
+
+// Files returns the files written by WriteIndex keyed by slash-separated path below dir,
+// e.g. "Bundles2" to store them in a GGPK like the Standalone client does.
+func Files(tb testing.TB, dir string, bundles map[string]map[string][]byte) map[string][]byte {
+	tb.Helper()
+	tmp := tb.TempDir()
+	WriteIndex(tb, tmp, bundles)
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(tmp, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(tmp, p)
+		files[path.Join(dir, filepath.ToSlash(rel))] = data
+		return nil
+	})
+	if err != nil {
+		tb.Fatalf("Failed to read written index: %v", err)
+	}
+	return files
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
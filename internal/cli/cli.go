@@ -0,0 +1,231 @@
+// Package cli implements the subcommands shared by the command line tools.
+// Every command works on a source.Source, so it runs the same against a Content.ggpk,
+// an _.index.bin and a Content.ggpk with bundles.
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/user/ggpkgo/internal/source"
+	"github.com/user/ggpkgo/pkg/bundle"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// Exit codes shared by all commands
+const (
+	ExitOK       = 0
+	ExitError    = 1 // The command failed for another reason, e.g. an I/O error
+	ExitUsage    = 2 // Invalid command line
+	ExitNotFound = 3 // A file or path doesn't exist
+	ExitCorrupt  = 4 // The data is damaged or in an unsupported version
+)
+
+// ErrUsage marks errors caused by invalid arguments.
+var ErrUsage = errors.New("usage error")
+
+// ErrNotFound marks errors for arguments that name nothing in the source, like a glob that
+// matches no file.
+var ErrNotFound = errors.New("not found")
+
+// ExitCode returns the exit code for an error returned by a command or by opening a source.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrUsage):
+		return ExitUsage
+	case errors.Is(err, ErrNotFound), errors.Is(err, ggpk.ErrNotFound), errors.Is(err, ggpk.ErrNotDirectory),
+		errors.Is(err, bundle.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return ExitNotFound
+	case errors.Is(err, ggpk.ErrCorrupt), errors.Is(err, ggpk.ErrUnsupportedVersion),
+		errors.Is(err, bundle.ErrCorrupt), errors.Is(err, bundle.ErrUnsupportedVersion):
+		return ExitCorrupt
+	}
+	return ExitError
+}
+
+// Env is what a command writes to.
+type Env struct {
+	Context context.Context
+	Stdout  io.Writer
+	Stderr  io.Writer
+	// Options open the other sources named by the arguments, as for the main one
+	Options source.Options
+}
+
+// runFunc runs a command once its flags are parsed. args are the positional arguments after the source.
+type runFunc func(env *Env, src source.Source, args []string) error
+
+// Command is a subcommand.
+type Command struct {
+	Name    string
+	Args    string // Synopsis of the flags and arguments after the source
+	Summary string
+	// writable commands open their source with source.Options.Writable
+	writable bool
+	// raw commands read files that may be too damaged to open: they get a nil source,
+	// and the file source.FindFile resolves the source path to as their first argument.
+	raw bool
+	// setup registers the flags of the command and returns the function running it.
+	setup func(fs *flag.FlagSet) runFunc
+}
+
+// Lookup returns the command with the given name, or nil.
+func Lookup(name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// WriteCommands writes the list of commands for a usage text.
+func WriteCommands(w io.Writer) {
+	for _, cmd := range commands {
+		lines := strings.Split(cmd.Summary, "\n")
+		fmt.Fprintf(w, "  %-30s %s\n", strings.TrimSpace(cmd.Name+" "+cmd.Args), lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(w, "  %-30s %s\n", "", line)
+		}
+	}
+}
+
+// Main runs a command line of the form "<command> [flags] <source> [arguments]", where flags
+// may also follow the source. prog is the name of the tool in messages.
+// It returns the exit code.
+func Main(ctx context.Context, prog string, args []string, stdout, stderr io.Writer) int {
+	usage := func() {
+		fmt.Fprintf(stderr, "Usage: %s <command> [flags] <source> [arguments]\n\n", prog)
+		fmt.Fprint(stderr, "The source is a Content.ggpk, an _.index.bin, or an install directory containing one of them.\n")
+		fmt.Fprint(stderr, "A Content.ggpk with a Bundles2 directory is read through its bundle index.\n\nCommands:\n")
+		WriteCommands(stderr)
+		fmt.Fprintf(stderr, "\nRun '%s <command> -h' for the flags of a command.\n", prog)
+	}
+	if len(args) == 0 {
+		usage()
+		return ExitUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage()
+		return ExitOK
+	}
+	cmd := Lookup(args[0])
+	if cmd == nil {
+		fmt.Fprintf(stderr, "Error: unknown command '%s'\n", args[0])
+		usage()
+		return ExitUsage
+	}
+
+	fs := flag.NewFlagSet(prog+" "+cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	kind := fs.String("kind", "", "Kind of the source: ggpk, index or bundled-ggpk (default: detected)")
+	run := cmd.setup(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s %s [flags] <source> %s\n\n%s\n\nFlags:\n", prog, cmd.Name, cmd.Args, cmd.Summary)
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterleaved(fs, args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if len(positional) == 0 {
+		fmt.Fprintln(stderr, "Error: missing source")
+		fs.Usage()
+		return ExitUsage
+	}
+
+	opts := source.Options{Kind: source.Kind(*kind)}
+	env := &Env{Context: ctx, Stdout: stdout, Stderr: stderr, Options: opts}
+	if cmd.raw {
+		path, err := source.FindFile(positional[0])
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return ExitCode(err)
+		}
+		return execute(env, run, nil, append([]string{path}, positional[1:]...))
+	}
+	srcOpts := opts
+	srcOpts.Writable = cmd.writable
+	src, err := source.Open(positional[0], srcOpts)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return ExitCode(err)
+	}
+	defer src.Close()
+	return execute(env, run, src, positional[1:])
+}
+
+// Run runs a command line of the form "<command> [flags] [arguments]" on an opened source.
+// It returns the exit code.
+func Run(ctx context.Context, src source.Source, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "Error: missing command")
+		return ExitUsage
+	}
+	cmd := Lookup(args[0])
+	if cmd == nil {
+		fmt.Fprintf(stderr, "Error: unknown command '%s'\n", args[0])
+		return ExitUsage
+	}
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	run := cmd.setup(fs)
+	positional, err := parseInterleaved(fs, args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if cmd.raw {
+		positional = append([]string{src.Path()}, positional...)
+	}
+	return execute(&Env{Context: ctx, Stdout: stdout, Stderr: stderr}, run, src, positional)
+}
+
+// execute runs the command with buffered output and returns the exit code.
+func execute(env *Env, run runFunc, src source.Source, args []string) int {
+	out := bufio.NewWriter(env.Stdout)
+	buffered := *env
+	buffered.Stdout = out
+	err := run(&buffered, src, args)
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(env.Stderr, "Error: %v\n", err)
+	}
+	return ExitCode(err)
+}
+
+// parseInterleaved parses the flags of fs wherever they appear in args and returns the
+// remaining positional arguments. Everything after "--" is positional.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
@@ -0,0 +1,495 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/bundletest"
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/internal/source"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// runMain runs the command line and returns the exit code, stdout and stderr.
+func runMain(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := Main(context.Background(), "ggpktool", args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func testSources(t *testing.T) map[string]string {
+	bundles := map[string]map[string][]byte{
+		"Data/Bundle0": {"data/mods.dat64": []byte("mods")},
+		"Art/Bundle1":  {"art/a.dds": []byte("texture a")},
+	}
+	return map[string]string{
+		"ggpk":         ggpktest.WriteFile(t, map[string][]byte{"data/mods.dat64": []byte("mods"), "art/a.dds": []byte("texture a")}),
+		"index":        bundletest.WriteIndex(t, t.TempDir(), bundles),
+		"bundled-ggpk": ggpktest.WriteFile(t, bundletest.Files(t, "Bundles2", bundles)),
+	}
+}
+
+func TestMain_AllSources(t *testing.T) {
+	for kind, path := range testSources(t) {
+		t.Run(kind, func(t *testing.T) {
+			code, out, errOut := runMain(t, "ls", path)
+			if code != ExitOK || out != "art/\ndata/\n" {
+				t.Errorf("Unexpected ls output (code %d): %s%s", code, out, errOut)
+			}
+			code, out, _ = runMain(t, "cat", path, "data/mods.dat64")
+			if code != ExitOK || out != "mods" {
+				t.Errorf("Unexpected cat output (code %d): %q", code, out)
+			}
+			code, out, _ = runMain(t, "info", path)
+			if fields := strings.Fields(out); code != ExitOK || len(fields) < 2 || fields[0] != "Kind:" || fields[1] != kind {
+				t.Errorf("Unexpected info output (code %d):\n%s", code, out)
+			}
+			code, out, errOut = runMain(t, "verify", path)
+			if code != ExitOK || !strings.Contains(out, `"issues": []`) {
+				t.Errorf("Unexpected verify output (code %d):\n%s%s", code, out, errOut)
+			}
+
+			// Flags may follow the source
+			outDir := t.TempDir()
+			code, out, errOut = runMain(t, "extract", path, "art", "-out", outDir)
+			if code != ExitOK || out != "art/a.dds\n" {
+				t.Errorf("Unexpected extract output (code %d): %s%s", code, out, errOut)
+			}
+			if data, err := os.ReadFile(filepath.Join(outDir, "art", "a.dds")); string(data) != "texture a" {
+				t.Errorf("extract did not write art/a.dds: %v", err)
+			}
+		})
+	}
+}
+
+func TestMain_StatGGPK(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("aaa")})
+	code, out, errOut := runMain(t, "stat", path, "Data/a.txt")
+	if code != ExitOK {
+		t.Fatalf("stat failed with code %d: %s", code, errOut)
+	}
+	for _, want := range []string{"Path:     Data/a.txt\n", "Size:     3\n", fmt.Sprintf("SHA256:   %x\n", sha256.Sum256([]byte("aaa")))} {
+		if !strings.Contains(out, want) {
+			t.Errorf("stat output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestMain_VerifyDamaged(t *testing.T) {
+	dir := t.TempDir()
+	bundletest.WriteIndex(t, dir, map[string]map[string][]byte{"Bundle0": {"a.txt": []byte("a")}})
+	os.Remove(filepath.Join(dir, "Bundle0.bundle.bin"))
+	code, out, _ := runMain(t, "verify", dir)
+	if code != ExitCorrupt || !strings.Contains(out, `"kind": "missing"`) {
+		t.Errorf("Expected a missing bundle and exit code %d, got %d:\n%s", ExitCorrupt, code, out)
+	}
+}
+
+func TestMain_Check(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("aaa")})
+	if code, out, errOut := runMain(t, "check", path); code != ExitOK || !strings.Contains(out, `"issues": []`) {
+		t.Errorf("Expected a clean report (code %d):\n%s%s", code, out, errOut)
+	}
+
+	// Clear the free list pointer of a GGPK with free space, orphaning the FreeRecord
+	if code, _, _ := runMain(t, "rm", path, "Data/a.txt"); code != ExitOK {
+		t.Fatalf("rm failed with code %d", code)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt(make([]byte, 8), 20)
+	f.Close()
+	code, out, _ := runMain(t, "check", path)
+	if code != ExitCorrupt || !strings.Contains(out, `"kind": "orphan"`) {
+		t.Errorf("Expected an orphan and exit code %d, got %d:\n%s", ExitCorrupt, code, out)
+	}
+}
+
+func TestMain_Salvage(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("aaa"), "Data/b.txt": []byte("bbb")})
+	// Smash the header and the root offset so that the GGPK can't be opened anymore
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt(bytes.Repeat([]byte{0xFF}, 28), 0)
+	f.Close()
+	if code, _, _ := runMain(t, "ls", path); code != ExitCorrupt {
+		t.Fatalf("Expected the damaged GGPK to fail to open, got code %d", code)
+	}
+
+	out := t.TempDir()
+	code, stdout, stderr := runMain(t, "salvage", path, "-out", out)
+	if code != ExitOK || stdout != "Salvaged 2 files (0 not matching their hash), skipped 28 damaged bytes\n" {
+		t.Errorf("Unexpected salvage output (code %d):\n%s%s", code, stdout, stderr)
+	}
+	if !strings.Contains(stderr, "skipped 28 bytes at offset 0") {
+		t.Errorf("Expected a warning about the damaged header, got %q", stderr)
+	}
+	entries, _ := os.ReadDir(out)
+	var contents []string
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), "_a.txt") && !strings.HasSuffix(e.Name(), "_b.txt") {
+			t.Errorf("Unexpected salvaged file name %s", e.Name())
+		}
+		data, _ := os.ReadFile(filepath.Join(out, e.Name()))
+		contents = append(contents, string(data))
+	}
+	sort.Strings(contents)
+	if !reflect.DeepEqual(contents, []string{"aaa", "bbb"}) {
+		t.Errorf("Unexpected salvaged contents %q", contents)
+	}
+}
+
+func TestMain_Repair(t *testing.T) {
+	files := map[string][]byte{"Data/a.txt": []byte("aaa"), "Data/b.txt": []byte("bbb")}
+	ref, path := ggpktest.WriteFile(t, files), ggpktest.WriteFile(t, files)
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := gf.GetNodeByPath("Data")
+	gf.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Smash the tag of Data so that its files become orphans
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("XXXX"), node.(*ggpk.DirectoryRecord).Offset+4)
+	f.Close()
+
+	code, stdout, stderr := runMain(t, "repair", path)
+	if code != ExitError || strings.Count(stdout, "unresolved  ") != 2 || !strings.Contains(stderr, "2 orphaned file(s) could not be placed") {
+		t.Errorf("Unexpected repair output without reference (code %d):\n%s%s", code, stdout, stderr)
+	}
+	code, stdout, stderr = runMain(t, "repair", path, "-ref", ref)
+	if code != ExitOK || !strings.Contains(stdout, "relinked    Data/a.txt\n") || !strings.Contains(stdout, "relinked    Data/b.txt\n") {
+		t.Errorf("Unexpected repair output (code %d):\n%s%s", code, stdout, stderr)
+	}
+	if code, stdout, _ := runMain(t, "check", path); code != ExitOK {
+		t.Errorf("Check after repair failed:\n%s", stdout)
+	}
+	if code, stdout, _ := runMain(t, "cat", path, "Data/b.txt"); code != ExitOK || stdout != "bbb" {
+		t.Errorf("Unexpected content after repair (code %d): %q", code, stdout)
+	}
+}
+
+func TestMain_Usage(t *testing.T) {
+	path := testSources(t)["ggpk"]
+	for _, tc := range []struct {
+		args []string
+		code int
+	}{
+		{nil, ExitUsage},
+		{[]string{"help"}, ExitOK},
+		{[]string{"frobnicate", path}, ExitUsage},
+		{[]string{"ls"}, ExitUsage},
+		{[]string{"ls", "-bogus", path}, ExitUsage},
+		{[]string{"cat", path}, ExitUsage},
+		{[]string{"ls", filepath.Join(t.TempDir(), "missing.ggpk")}, ExitNotFound},
+		{[]string{"ls", path, "missing"}, ExitNotFound},
+		{[]string{"ls", "-kind", "index", path}, ExitCorrupt},
+	} {
+		if code, _, _ := runMain(t, tc.args...); code != tc.code {
+			t.Errorf("Expected exit code %d for %q, got %d", tc.code, tc.args, code)
+		}
+	}
+}
+
+func TestMain_Formats(t *testing.T) {
+	sources := testSources(t)
+	hash := sha256.Sum256([]byte("mods"))
+
+	code, out, errOut := runMain(t, "tree", "-format", "json", sources["ggpk"], "data")
+	if code != ExitOK {
+		t.Fatalf("tree failed with code %d: %s", code, errOut)
+	}
+	var entries []listEntry
+	if err := json.Unmarshal([]byte(out), &entries); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+	if len(entries) != 2 || entries[0].Type != "directory" || entries[1].Path != "data/mods.dat64" ||
+		entries[1].Size != 4 || entries[1].Offset == nil || entries[1].SHA256 != hex.EncodeToString(hash[:]) {
+		t.Errorf("Unexpected JSON entries:\n%s", out)
+	}
+
+	code, out, _ = runMain(t, "ls", "--format=ndjson", sources["index"], "data")
+	want := `{"path":"data/mods.dat64","type":"file","size":4,"bundle":"Data/Bundle0","bundle_offset":0}` + "\n"
+	if code != ExitOK || out != want {
+		t.Errorf("Unexpected NDJSON output (code %d):\n%s", code, out)
+	}
+
+	code, out, _ = runMain(t, "find", sources["bundled-ggpk"], "*.dds", "-format", "csv")
+	want = "path,type,size,offset,sha256,bundle,bundle_offset\nart/a.dds,file,9,,,Art/Bundle1,0\n"
+	if code != ExitOK || out != want {
+		t.Errorf("Unexpected CSV output (code %d):\n%s", code, out)
+	}
+
+	if code, out, _ = runMain(t, "find", "-format", "json", sources["ggpk"], "*.none"); code != ExitOK || out != "[]\n" {
+		t.Errorf("Expected an empty JSON array (code %d):\n%s", code, out)
+	}
+	if code, _, _ := runMain(t, "ls", "-format", "xml", sources["ggpk"]); code != ExitUsage {
+		t.Errorf("Expected exit code %d for an unknown format, got %d", ExitUsage, code)
+	}
+}
+
+func TestMain_ExtractFilters(t *testing.T) {
+	bundles := map[string]map[string][]byte{
+		"Data/Bundle0":  {"data/mods.dat64": []byte("mods"), "data/balance/items.dat64": []byte("items"), "data/readme.txt": []byte("r")},
+		"Audio/Bundle1": {"audio/music/a.ogg": []byte("a"), "audio/sfx/b.ogg": []byte("b")},
+	}
+	for kind, path := range map[string]string{
+		"index":        bundletest.WriteIndex(t, t.TempDir(), bundles),
+		"bundled-ggpk": ggpktest.WriteFile(t, bundletest.Files(t, "Bundles2", bundles)),
+	} {
+		for _, tc := range []struct {
+			args []string
+			want string
+		}{
+			{[]string{"-include", "Data/**/*.dat64"}, "data/balance/items.dat64\ndata/mods.dat64\n"},
+			{[]string{"-include", `re:\.ogg$`, "-exclude", "**/sfx"}, "audio/music/a.ogg\n"},
+			{[]string{"-exclude", "data/**", "audio"}, "audio/music/a.ogg\naudio/sfx/b.ogg\n"},
+		} {
+			args := append([]string{"extract", path, "-out", t.TempDir()}, tc.args...)
+			code, out, errOut := runMain(t, args...)
+			if code != ExitOK || out != tc.want {
+				t.Errorf("%s: unexpected output for %q (code %d):\n%s%s", kind, tc.args, code, out, errOut)
+			}
+		}
+	}
+
+	path := testSources(t)["ggpk"]
+	if code, _, _ := runMain(t, "extract", path, "-out", t.TempDir(), "-include", "**/*.none"); code != ExitError {
+		t.Errorf("Expected exit code %d when no file matches the filters, got %d", ExitError, code)
+	}
+	if code, _, _ := runMain(t, "extract", path, "-include", "re:("); code != ExitUsage {
+		t.Errorf("Expected exit code %d for an invalid pattern, got %d", ExitUsage, code)
+	}
+}
+
+func TestMain_ExtractOutside(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{
+		"../evil.txt": []byte("outside"),
+		"ok.txt":      []byte("inside"),
+	})
+	parent := t.TempDir()
+	outDir := filepath.Join(parent, "out")
+	code, _, errOut := runMain(t, "extract", path, "-out", outDir)
+	if code != ExitError || !strings.Contains(errOut, "outside the output directory") {
+		t.Errorf("Expected exit code %d for a '..' entry, got %d: %s", ExitError, code, errOut)
+	}
+	for _, p := range []string{filepath.Join(parent, "evil.txt"), filepath.Join(outDir, "ok.txt")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to be written, got %v", p, err)
+		}
+	}
+}
+
+func TestMain_Diff(t *testing.T) {
+	oldPath := ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("aaa"), "Data/b.txt": []byte("b")})
+	newPath := ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("AAAA"), "Data/c.txt": []byte("cc")})
+
+	code, out, errOut := runMain(t, "diff", oldPath, newPath)
+	if code != ExitOK {
+		t.Fatalf("diff failed with code %d: %s", code, errOut)
+	}
+	var report diffReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+	if report.Summary.Added != 1 || report.Summary.Removed != 1 || report.Summary.Modified != 1 || len(report.Changes) != 3 {
+		t.Errorf("Unexpected report:\n%s", out)
+	}
+
+	code, out, _ = runMain(t, "diff", "-format", "text", oldPath, newPath)
+	want := "modified  Data/a.txt (3 -> 4)\nremoved   Data/b.txt (1)\nadded     Data/c.txt (2)\n"
+	if code != ExitOK || out != want {
+		t.Errorf("Unexpected text output (code %d):\n%s", code, out)
+	}
+
+	// A GGPK can't be compared with an index
+	index := bundletest.WriteIndex(t, t.TempDir(), map[string]map[string][]byte{"Bundle0": {"a.txt": []byte("a")}})
+	if code, _, errOut := runMain(t, "diff", oldPath, index); code != ExitError {
+		t.Errorf("Expected an error comparing a GGPK with an index, got code %d: %s", code, errOut)
+	}
+}
+
+func TestMain_MakePatch(t *testing.T) {
+	oldFiles := map[string][]byte{"data/a.txt": []byte("aaa"), "data/b.txt": []byte("b"), "data/same.txt": []byte("same")}
+	newFiles := map[string][]byte{"data/a.txt": []byte("AAA"), "data/c.txt": []byte("cc"), "data/same.txt": []byte("same")}
+	pairs := map[string][2]string{
+		"ggpk": {ggpktest.WriteFile(t, oldFiles), ggpktest.WriteFile(t, newFiles)},
+		"index": {
+			bundletest.WriteIndex(t, t.TempDir(), map[string]map[string][]byte{"Bundle0": oldFiles}),
+			bundletest.WriteIndex(t, t.TempDir(), map[string]map[string][]byte{"Bundle0": newFiles}),
+		},
+	}
+	for kind, pair := range pairs {
+		t.Run(kind, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "patch.zip")
+			code, stdout, errOut := runMain(t, "make-patch", pair[0], pair[1], "-o", out)
+			if code != ExitOK {
+				t.Fatalf("make-patch failed with code %d: %s", code, errOut)
+			}
+			if want := "Wrote 2 files (1 added, 1 modified) and 1 deletions to " + out + "\n"; stdout != want {
+				t.Errorf("Unexpected output: %q", stdout)
+			}
+
+			zr, err := zip.OpenReader(out)
+			if err != nil {
+				t.Fatalf("Failed to open the patch: %v", err)
+			}
+			defer zr.Close()
+			got := make(map[string]string)
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("Failed to open %s: %v", f.Name, err)
+				}
+				data, _ := io.ReadAll(rc)
+				rc.Close()
+				got[f.Name] = string(data)
+			}
+			want := map[string]string{"data/a.txt": "AAA", "data/c.txt": "cc", source.DeletedManifest: "data/b.txt\n"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Unexpected patch content: %v", got)
+			}
+		})
+	}
+}
+
+func TestMain_ApplyZip(t *testing.T) {
+	oldPath := ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("aaa"), "Data/b.txt": []byte("b")})
+	newPath := ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("AAAA"), "Data/Sub/c.txt": []byte("cc")})
+	patch := filepath.Join(t.TempDir(), "patch.zip")
+	if code, _, errOut := runMain(t, "make-patch", oldPath, newPath, "-o", patch); code != ExitOK {
+		t.Fatalf("make-patch failed with code %d: %s", code, errOut)
+	}
+
+	code, out, errOut := runMain(t, "apply-zip", oldPath, patch)
+	want := "not-found Data/Sub/c.txt\nreplaced  Data/a.txt\nReplaced 1 files, added 0, 0 unchanged, 1 not found\n"
+	if code != ExitOK || out != want {
+		t.Errorf("Unexpected apply-zip output (code %d):\n%s%s", code, out, errOut)
+	}
+	code, out, errOut = runMain(t, "apply-zip", "-add", oldPath, patch)
+	if code != ExitOK || !strings.Contains(out, "added     Data/Sub/c.txt\n") {
+		t.Errorf("Unexpected apply-zip -add output (code %d):\n%s%s", code, out, errOut)
+	}
+
+	// Only the removal, which apply-zip doesn't apply, remains
+	code, out, _ = runMain(t, "diff", "-format", "text", oldPath, newPath)
+	if code != ExitOK || out != "removed   Data/b.txt (1)\n" {
+		t.Errorf("Unexpected diff after apply-zip (code %d):\n%s", code, out)
+	}
+}
+
+func TestMain_ApplyZipIndex(t *testing.T) {
+	bundles := map[string]map[string][]byte{"Bundle0": {"data/a.txt": []byte("aaa"), "data/b.txt": []byte("b")}}
+	index := bundletest.WriteIndex(t, t.TempDir(), bundles)
+	zipPath := filepath.Join(t.TempDir(), "mod.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{"data/a.txt": "modded", "data/new.txt": "new"} {
+		w, _ := zw.Create(name)
+		io.WriteString(w, content)
+	}
+	zw.Close()
+	f.Close()
+
+	code, out, errOut := runMain(t, "apply-zip", "-dry-run", index, zipPath)
+	if code != ExitOK || !strings.Contains(out, "replaced  data/a.txt\n") || !strings.Contains(out, "not-found data/new.txt\n") ||
+		!strings.HasSuffix(out, "Would replace 1 files, 1 not found, 0 rejected\n") {
+		t.Errorf("Unexpected dry run output (code %d):\n%s%s", code, out, errOut)
+	}
+	if _, out, _ := runMain(t, "cat", index, "data/a.txt"); out != "aaa" {
+		t.Errorf("Dry run replaced the file: %q", out)
+	}
+
+	code, out, errOut = runMain(t, "apply-zip", "-uncompressed", index, zipPath)
+	if code != ExitOK || !strings.HasSuffix(out, "Replaced 1 files, 1 not found, 0 rejected\n") {
+		t.Errorf("Unexpected apply-zip output (code %d):\n%s%s", code, out, errOut)
+	}
+	if _, out, _ := runMain(t, "cat", index, "data/a.txt"); out != "modded" {
+		t.Errorf("File not replaced: %q", out)
+	}
+	if code, _, _ := runMain(t, "apply-zip", "-add", index, zipPath); code != ExitUsage {
+		t.Errorf("Expected a usage error for -add on an index, got code %d", code)
+	}
+}
+
+func TestMain_Replace(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("aaa"), "Data/same.txt": []byte("same")})
+	mods := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "modded", "same.txt": "same", "Sub/new.txt": "new"} {
+		p := filepath.Join(mods, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		os.WriteFile(p, []byte(content), 0o644)
+	}
+
+	// Go's flag package accepts the double-dash spelling too
+	code, out, errOut := runMain(t, "replace", path, "--from", mods, "--to", "Data")
+	want := "added     Sub/new.txt\nreplaced  a.txt\nReplaced 1 files, added 1, 1 unchanged\n"
+	if code != ExitOK || out != want {
+		t.Errorf("Unexpected replace output (code %d):\n%s%s", code, out, errOut)
+	}
+	if _, out, _ := runMain(t, "cat", path, "Data/Sub/new.txt"); out != "new" {
+		t.Errorf("Unexpected content of the added file: %q", out)
+	}
+	code, out, _ = runMain(t, "replace", path, "-from", mods, "-to", "Data")
+	if code != ExitOK || out != "Replaced 0 files, added 0, 3 unchanged\n" {
+		t.Errorf("Unexpected output of a second replace (code %d):\n%s", code, out)
+	}
+	if code, _, _ := runMain(t, "replace", path); code != ExitUsage {
+		t.Errorf("Expected a usage error without -from, got code %d", code)
+	}
+}
+
+func TestMain_Rm(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{
+		"Data/a.txt":            []byte("aaa"),
+		"Data/b.txt":            []byte("bbb"),
+		"Lang/French/x.txt":     []byte("x"),
+		"Lang/French/Sub/y.txt": []byte("y"),
+		"Lang/English/kept.txt": []byte("kept"),
+	})
+
+	if code, _, _ := runMain(t, "rm", path, "Lang/French"); code != ExitUsage {
+		t.Errorf("Expected a usage error for a directory without -r, got code %d", code)
+	}
+	if code, _, _ := runMain(t, "rm", path, "Data/a.txt", "Data/missing.txt"); code == ExitOK {
+		t.Error("Expected an error for a missing path")
+	}
+	if _, out, _ := runMain(t, "cat", path, "Data/a.txt"); out != "aaa" {
+		t.Errorf("Expected nothing removed after an error, got %q", out)
+	}
+
+	code, out, errOut := runMain(t, "rm", path, "-r", "Lang/French", "Lang/French/x.txt", "Data/a.txt")
+	if want := "Removed 3 files and 2 directories\n"; code != ExitOK || out != want {
+		t.Errorf("Unexpected rm output (code %d):\n%s%s", code, out, errOut)
+	}
+	_, out, _ = runMain(t, "find", path, "*")
+	if want := "Data/b.txt\nLang/English/kept.txt\n"; out != want {
+		t.Errorf("Unexpected tree after rm:\n%s", out)
+	}
+}
@@ -0,0 +1,839 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/user/ggpkgo/internal/source"
+	"github.com/user/ggpkgo/pkg/bundle"
+	"github.com/user/ggpkgo/pkg/bundledggpk"
+	"github.com/user/ggpkgo/pkg/diff"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// commands in the order of the usage text
+var commands = []*Command{
+	{Name: "ls", Args: "[-format f] [path]", Summary: "List the entries of a directory (default: root)", setup: setupLs},
+	{Name: "tree", Args: "[-format f] [path]", Summary: "Print the directory tree below path;\nother formats than text list every entry below path", setup: setupTree},
+	{Name: "cat", Args: "<path>", Summary: "Write the content of a file to stdout", setup: noFlags(cmdCat)},
+	{Name: "extract", Args: "[-out dir] [-include p]... [-exclude p]... [path]", Summary: "Extract a file, a directory (default: root) or all files matching a glob;\n-include/-exclude take globs with ** or re:<regexp> and may be repeated", setup: setupExtract},
+	{Name: "info", Summary: "Show the kind and header fields of the source", setup: noFlags(cmdInfo)},
+	{Name: "verify", Summary: "Check hashes and bundles and print a JSON report;\nexits with 4 if any issue is found", setup: noFlags(cmdVerify)},
+	{Name: "check", Summary: "Check the record structure of a GGPK: tags and lengths, directory entries,\nthe free list and unreachable records; prints a JSON report and exits with 4\nif any issue is found", setup: noFlags(cmdCheck)},
+	{Name: "salvage", Args: "[-out dir]", Summary: "Scan a GGPK record by record, even if its directory tree is damaged, and\nextract every file record found as <offset>_<name>; damaged regions and\nfiles not matching their hash are reported on stderr", setup: setupSalvage, raw: true},
+	{Name: "repair", Args: "[-ref source]", Summary: "Rebuild the directory tree of a damaged GGPK in place: drop broken entries,\nturn damaged bytes into free space and put orphaned files back at the path\nthey have in the reference (a GGPK or bundle index); exits with 1 if any\norphaned file could not be placed", setup: setupRepair, raw: true},
+	{Name: "stat", Args: "<path>", Summary: "Show the offset, size and hash or bundle of a file", setup: noFlags(cmdStat)},
+	{Name: "diff", Args: "[-format json|text] <new source>", Summary: "Compare the source with a newer one of the same family (GGPK or bundles)\nand print the added, removed and modified files", setup: setupDiff},
+	{Name: "make-patch", Args: "[-o patch.zip] <new source>", Summary: "Write the files added or modified in the newer source to a zip,\nwith the removed paths listed in " + source.DeletedManifest, setup: setupMakePatch},
+	{Name: "apply-zip", Args: "[-add] [-dry-run] [-uncompressed] <zip>", Summary: "Write the files of a zip over the files of a GGPK or bundle index;\nGGPK paths match ignoring case and -add creates the files that don't exist;\nbundle files are written to custom bundles, -dry-run only lists them", setup: setupApplyZip, writable: true},
+	{Name: "replace", Args: "-from dir [-to path]", Summary: "Mirror the files below a directory on disk onto a GGPK directory, adding\nmissing ones and skipping those whose SHA-256 already matches", setup: setupReplace, writable: true},
+	{Name: "rm", Args: "[-r] <path>...", Summary: "Remove files from a GGPK, or directories with everything below them with -r;\ntheir space becomes free space", setup: setupRm, writable: true},
+	{Name: "find", Args: "[-format f] <pattern>", Summary: "Print the paths of files whose name matches the glob pattern,\nor whose full path matches if the pattern contains '/'", setup: setupFind},
+}
+
+func noFlags(run runFunc) func(*flag.FlagSet) runFunc {
+	return func(*flag.FlagSet) runFunc { return run }
+}
+
+func optionalPath(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		return "", nil
+	case 1:
+		return args[0], nil
+	default:
+		return "", fmt.Errorf("%w: expected at most one path, got %d arguments", ErrUsage, len(args))
+	}
+}
+
+func requiredArg(args []string, name string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("%w: expected exactly one %s", ErrUsage, name)
+	}
+	return args[0], nil
+}
+
+func noArgs(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("%w: unexpected arguments %s", ErrUsage, strings.Join(args, " "))
+	}
+	return nil
+}
+
+// displayPath returns the path of n as shown to the user, "/" for the root.
+func displayPath(n *source.Node) string {
+	if n.Path == "" {
+		return "/"
+	}
+	return n.Path
+}
+
+// writeFields writes one "Name: value" line per field, with the values aligned.
+func writeFields(w io.Writer, fields []source.Field) {
+	width := 10
+	for _, f := range fields {
+		width = max(width, len(f.Name)+2)
+	}
+	for _, f := range fields {
+		fmt.Fprintf(w, "%-*s%s\n", width, f.Name+":", f.Value)
+	}
+}
+
+func setupLs(fs *flag.FlagSet) runFunc {
+	format := formatFlag(fs)
+	return func(env *Env, src source.Source, args []string) error {
+		lw, err := newListWriter(env.Stdout, *format)
+		if err != nil {
+			return err
+		}
+		p, err := optionalPath(args)
+		if err != nil {
+			return err
+		}
+		node, err := src.Lookup(p)
+		if err != nil {
+			return err
+		}
+		children := []*source.Node{node}
+		if node.IsDir {
+			if children, err = src.Children(node); err != nil {
+				return err
+			}
+		}
+		if lw != nil {
+			for _, child := range children {
+				if err := lw.write(child); err != nil {
+					return err
+				}
+			}
+			return lw.close()
+		}
+		for _, child := range children {
+			if child.IsDir {
+				fmt.Fprintf(env.Stdout, "%s/\n", child.Name)
+			} else {
+				fmt.Fprintln(env.Stdout, child.Name)
+			}
+		}
+		return nil
+	}
+}
+
+func setupTree(fs *flag.FlagSet) runFunc {
+	format := formatFlag(fs)
+	return func(env *Env, src source.Source, args []string) error {
+		lw, err := newListWriter(env.Stdout, *format)
+		if err != nil {
+			return err
+		}
+		p, err := optionalPath(args)
+		if err != nil {
+			return err
+		}
+		node, err := src.Lookup(p)
+		if err != nil {
+			return err
+		}
+		if lw == nil {
+			return source.WriteTree(env.Stdout, src, node)
+		}
+		err = source.Walk(src, node, func(n *source.Node) error {
+			if n.Path == "" {
+				return nil // The root has no path to list
+			}
+			return lw.write(n)
+		})
+		if err != nil {
+			return err
+		}
+		return lw.close()
+	}
+}
+
+func cmdCat(env *Env, src source.Source, args []string) error {
+	p, err := requiredArg(args, "file path")
+	if err != nil {
+		return err
+	}
+	node, err := src.Lookup(p)
+	if err != nil {
+		return err
+	}
+	if node.IsDir {
+		return fmt.Errorf("'%s' is a directory", p)
+	}
+	data, err := src.ReadFile(node)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", p, err)
+	}
+	_, err = env.Stdout.Write(data)
+	return err
+}
+
+// StringList is a flag that can be repeated, collecting every value.
+type StringList []string
+
+func (l *StringList) String() string     { return strings.Join(*l, ",") }
+func (l *StringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func setupExtract(fs *flag.FlagSet) runFunc {
+	outDir := fs.String("out", ".", "Output directory")
+	var includes, excludes StringList
+	fs.Var(&includes, "include", "Only extract files matching this glob (** matches any number of directories)\nor, with the re: prefix, regular expression; may be repeated")
+	fs.Var(&excludes, "exclude", "Skip files and directories matching this glob or re: regular expression; may be repeated")
+	return func(env *Env, src source.Source, args []string) error {
+		pattern, err := optionalPath(args)
+		if err != nil {
+			return err
+		}
+		filter, err := source.NewFilter(includes, excludes)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrUsage, err)
+		}
+
+		var files []*source.Node
+		collect := func(f *source.Node) error {
+			files = append(files, f)
+			return nil
+		}
+		if node, lookupErr := src.Lookup(pattern); lookupErr == nil {
+			if err := filter.WalkFiles(src, node, collect); err != nil {
+				return err
+			}
+			if filter != nil && len(files) == 0 {
+				return fmt.Errorf("no files below '%s' match the filters", displayPath(node))
+			}
+		} else {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%w: invalid glob '%s': %v", ErrUsage, pattern, err)
+			}
+			err := filter.WalkFiles(src, src.Root(), func(f *source.Node) error {
+				if ok, _ := path.Match(pattern, f.Path); ok {
+					files = append(files, f)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if len(files) == 0 {
+				return fmt.Errorf("%w: no files match '%s'", ErrNotFound, pattern)
+			}
+		}
+
+		// Checked before writing anything, so that a bad name doesn't leave a partial extraction
+		outPaths := make([]string, len(files))
+		for i, f := range files {
+			if outPaths[i], err = extractPath(*outDir, f.Path); err != nil {
+				return err
+			}
+		}
+		for i, f := range files {
+			data, err := src.ReadFile(f)
+			if err != nil {
+				return fmt.Errorf("failed to read '%s': %w", f.Path, err)
+			}
+			outPath := outPaths[i]
+			if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+				return fmt.Errorf("failed to create directory for '%s': %w", outPath, err)
+			}
+			if err := os.WriteFile(outPath, data, 0644); err != nil {
+				return fmt.Errorf("failed to write '%s': %w", outPath, err)
+			}
+			fmt.Fprintln(env.Stdout, f.Path)
+		}
+		return nil
+	}
+}
+
+// extractPath returns the path to extract the file at p to below outDir. Names come from
+// the source unchecked, so a path that would escape outDir, like one with a ".." component,
+// is an error.
+func extractPath(outDir, p string) (string, error) {
+	rel := filepath.FromSlash(p)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("refusing to extract '%s' outside the output directory", p)
+	}
+	return filepath.Join(outDir, rel), nil
+}
+
+func cmdInfo(env *Env, src source.Source, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	writeFields(env.Stdout, src.Info())
+	return nil
+}
+
+func cmdVerify(env *Env, src source.Source, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	report, err := src.Verify(env.Context)
+	if report != nil {
+		enc := json.NewEncoder(env.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(report); encErr != nil {
+			return fmt.Errorf("failed to write report: %w", encErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("verification did not complete: %w", err)
+	}
+	if len(report.Issues) > 0 {
+		if source.Index(src) != nil {
+			return fmt.Errorf("%w: %d issue(s) found", bundle.ErrCorrupt, len(report.Issues))
+		}
+		return fmt.Errorf("%w: %d issue(s) found", ggpk.ErrCorrupt, len(report.Issues))
+	}
+	return nil
+}
+
+func cmdCheck(env *Env, src source.Source, args []string) error {
+	if err := noArgs(args); err != nil {
+		return err
+	}
+	gf := source.GGPK(src)
+	if gf == nil {
+		return fmt.Errorf("check is not supported for a %s source", src.Kind())
+	}
+	report, err := ggpk.Check(gf)
+	if err != nil {
+		return fmt.Errorf("check did not complete: %w", err)
+	}
+	enc := json.NewEncoder(env.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if !report.OK() {
+		return fmt.Errorf("%w: %d issue(s) found", ggpk.ErrCorrupt, len(report.Issues))
+	}
+	return nil
+}
+
+func cmdStat(env *Env, src source.Source, args []string) error {
+	p, err := requiredArg(args, "path")
+	if err != nil {
+		return err
+	}
+	node, err := src.Lookup(p)
+	if err != nil {
+		return err
+	}
+	if !node.IsDir {
+		fields := []source.Field{{Name: "Path", Value: displayPath(node)}, {Name: "Type", Value: "file"}}
+		offset := node.Offset
+		if node.Bundle != "" {
+			fields = append(fields, source.Field{Name: "Bundle", Value: node.Bundle})
+			offset = node.BundleOffset
+		}
+		fields = append(fields,
+			source.Field{Name: "Offset", Value: strconv.FormatInt(offset, 10)},
+			source.Field{Name: "Size", Value: strconv.FormatInt(node.Size, 10)})
+		if node.Bundle != "" {
+			fields = append(fields, source.Field{Name: "PathHash", Value: fmt.Sprintf("%016X", node.PathHash)})
+		}
+		if node.Hash != nil {
+			fields = append(fields, source.Field{Name: "SHA256", Value: fmt.Sprintf("%x", node.Hash)})
+		}
+		writeFields(env.Stdout, fields)
+		return nil
+	}
+	count, size := 0, int64(0)
+	err = source.WalkFiles(src, node, func(f *source.Node) error {
+		count++
+		size += f.Size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	writeFields(env.Stdout, []source.Field{
+		{Name: "Path", Value: displayPath(node)},
+		{Name: "Type", Value: "directory"},
+		{Name: "Files", Value: strconv.Itoa(count)},
+		{Name: "Size", Value: strconv.FormatInt(size, 10)},
+	})
+	return nil
+}
+
+func setupFind(fs *flag.FlagSet) runFunc {
+	format := formatFlag(fs)
+	return func(env *Env, src source.Source, args []string) error {
+		lw, err := newListWriter(env.Stdout, *format)
+		if err != nil {
+			return err
+		}
+		pattern, err := requiredArg(args, "pattern")
+		if err != nil {
+			return err
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: invalid glob '%s': %v", ErrUsage, pattern, err)
+		}
+		matchFullPath := strings.Contains(pattern, "/")
+		err = source.WalkFiles(src, src.Root(), func(f *source.Node) error {
+			subject := f.Name
+			if matchFullPath {
+				subject = f.Path
+			}
+			if ok, _ := path.Match(pattern, subject); !ok {
+				return nil
+			}
+			if lw != nil {
+				return lw.write(f)
+			}
+			_, err := fmt.Fprintln(env.Stdout, f.Path)
+			return err
+		})
+		if err != nil || lw == nil {
+			return err
+		}
+		return lw.close()
+	}
+}
+
+// diffReport is the JSON output of diff.
+type diffReport struct {
+	Old     string        `json:"old"`
+	New     string        `json:"new"`
+	Summary diff.Summary  `json:"summary"`
+	Changes []diff.Change `json:"changes"`
+}
+
+func setupDiff(fs *flag.FlagSet) runFunc {
+	format := fs.String("format", formatJSON, "Output format: json or text")
+	return func(env *Env, src source.Source, args []string) error {
+		if *format != formatJSON && *format != formatText {
+			return fmt.Errorf("%w: unknown format '%s'", ErrUsage, *format)
+		}
+		newPath, err := requiredArg(args, "new source")
+		if err != nil {
+			return err
+		}
+		newSrc, err := source.Open(newPath, env.Options)
+		if err != nil {
+			return err
+		}
+		defer newSrc.Close()
+
+		changes, err := source.Diff(env.Context, src, newSrc)
+		if err != nil {
+			return err
+		}
+		if changes == nil {
+			changes = []diff.Change{}
+		}
+		if *format == formatText {
+			for _, c := range changes {
+				switch c.Kind {
+				case diff.Added:
+					fmt.Fprintf(env.Stdout, "added     %s (%d)\n", c.Path, c.NewSize)
+				case diff.Removed:
+					fmt.Fprintf(env.Stdout, "removed   %s (%d)\n", c.Path, c.OldSize)
+				default:
+					fmt.Fprintf(env.Stdout, "modified  %s (%d -> %d)\n", c.Path, c.OldSize, c.NewSize)
+				}
+			}
+			return nil
+		}
+		enc := json.NewEncoder(env.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffReport{Old: src.Path(), New: newSrc.Path(), Summary: diff.Summarize(changes), Changes: changes})
+	}
+}
+
+func setupMakePatch(fs *flag.FlagSet) runFunc {
+	out := fs.String("o", "patch.zip", "Zip file to write")
+	return func(env *Env, src source.Source, args []string) error {
+		newPath, err := requiredArg(args, "new source")
+		if err != nil {
+			return err
+		}
+		newSrc, err := source.Open(newPath, env.Options)
+		if err != nil {
+			return err
+		}
+		defer newSrc.Close()
+
+		changes, err := source.Diff(env.Context, src, newSrc)
+		if err != nil {
+			return err
+		}
+		// Write next to the destination and rename, so that a failure leaves no partial archive
+		f, err := os.CreateTemp(filepath.Dir(*out), ".patch-*.zip")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		written, err := source.WritePatch(env.Context, f, newSrc, changes)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(f.Name(), *out); err != nil {
+			return err
+		}
+		summary := diff.Summarize(changes)
+		fmt.Fprintf(env.Stdout, "Wrote %d files (%d added, %d modified) and %d deletions to %s\n",
+			written, summary.Added, summary.Modified, summary.Removed, *out)
+		return nil
+	}
+}
+
+func setupApplyZip(fs *flag.FlagSet) runFunc {
+	allowAdd := fs.Bool("add", false, "Create files and directories that don't exist (GGPK only)")
+	dryRun := fs.Bool("dry-run", false, "Only print what would be done (bundles only)")
+	uncompressed := fs.Bool("uncompressed", false, "Write bundles without Oodle compression (bundles only)")
+	return func(env *Env, src source.Source, args []string) error {
+		zipPath, err := requiredArg(args, "zip file")
+		if err != nil {
+			return err
+		}
+		idx, gf := source.Index(src), source.GGPK(src)
+		switch {
+		case idx != nil && *allowAdd:
+			return fmt.Errorf("%w: -add is not supported for bundles, which can only replace files", ErrUsage)
+		case idx == nil && (*dryRun || *uncompressed):
+			return fmt.Errorf("%w: -dry-run and -uncompressed only apply to bundles", ErrUsage)
+		case idx == nil && gf == nil:
+			return fmt.Errorf("apply-zip is not supported for a %s source", src.Kind())
+		}
+		zr, err := zip.OpenReader(zipPath)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+
+		// The deletions of a patch made by make-patch aren't files to write
+		files := zr.File[:0:0]
+		for _, f := range zr.File {
+			if f.Name == source.DeletedManifest {
+				fmt.Fprintf(env.Stderr, "Warning: %s is not applied\n", source.DeletedManifest)
+				continue
+			}
+			files = append(files, f)
+		}
+		filtered := &zip.Reader{File: files}
+
+		counts := make(map[string]int)
+		report := func(p, status string) error {
+			counts[status]++
+			_, err := fmt.Fprintf(env.Stdout, "%-10s%s\n", status, p)
+			return err
+		}
+		if idx != nil {
+			if *uncompressed {
+				idx.Compressor = bundle.OodleCompressorNone
+			}
+			_, err = idx.Replace(filtered, *dryRun, func(p string, _ *bundle.IndexFileRecord, status bundle.ReplaceStatus) error {
+				return report(p, string(status))
+			})
+			if err != nil {
+				return err
+			}
+			verb := "Replaced"
+			if *dryRun {
+				verb = "Would replace"
+			}
+			fmt.Fprintf(env.Stdout, "%s %d files, %d not found, %d rejected\n", verb,
+				counts[string(bundle.StatusReplaced)], counts[string(bundle.StatusNotFound)], counts[string(bundle.StatusRejected)])
+			return nil
+		}
+
+		_, err = gf.Replace(nil, filtered, *allowAdd, func(p string, _ *ggpk.FileRecord, status ggpk.ReplaceStatus) error {
+			return report(p, string(status))
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Stdout, "Replaced %d files, added %d, %d unchanged, %d not found\n",
+			counts[string(ggpk.StatusReplaced)], counts[string(ggpk.StatusAdded)],
+			counts[string(ggpk.StatusUnchanged)], counts[string(ggpk.StatusNotFound)])
+		return nil
+	}
+}
+
+func setupReplace(fs *flag.FlagSet) runFunc {
+	from := fs.String("from", "", "Directory on disk holding the files to write (required)")
+	to := fs.String("to", "", "Directory of the GGPK to write them to (default: root)")
+	return func(env *Env, src source.Source, args []string) error {
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		if *from == "" {
+			return fmt.Errorf("%w: -from is required", ErrUsage)
+		}
+		gf := source.GGPK(src)
+		switch {
+		case gf == nil:
+			return fmt.Errorf("replace is not supported for a %s source", src.Kind())
+		case source.Index(src) != nil:
+			return fmt.Errorf("%w: replace writes to the GGPK tree; use apply-zip for bundles, or -kind ggpk", ErrUsage)
+		}
+		node, err := gf.GetNodeByPath(*to)
+		if err != nil {
+			return err
+		}
+		root, ok := node.(*ggpk.DirectoryRecord)
+		if !ok {
+			return fmt.Errorf("'%s' is not a directory", *to)
+		}
+
+		counts := make(map[ggpk.ReplaceStatus]int)
+		_, err = gf.ReplaceFromDirectory(root, *from, true, func(p string, _ *ggpk.FileRecord, status ggpk.ReplaceStatus) error {
+			counts[status]++
+			if status == ggpk.StatusUnchanged {
+				return nil
+			}
+			_, err := fmt.Fprintf(env.Stdout, "%-10s%s\n", status, p)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Stdout, "Replaced %d files, added %d, %d unchanged\n",
+			counts[ggpk.StatusReplaced], counts[ggpk.StatusAdded], counts[ggpk.StatusUnchanged])
+		return nil
+	}
+}
+
+func setupRm(fs *flag.FlagSet) runFunc {
+	recursive := fs.Bool("r", false, "Remove directories and everything below them")
+	return func(env *Env, src source.Source, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("%w: expected at least one path", ErrUsage)
+		}
+		gf := source.GGPK(src)
+		switch {
+		case gf == nil:
+			return fmt.Errorf("rm is not supported for a %s source", src.Kind())
+		case source.Index(src) != nil:
+			return fmt.Errorf("%w: rm removes from the GGPK tree, which holds the bundles; use -kind ggpk", ErrUsage)
+		}
+		// Resolve every path before removing anything
+		nodes := make([]ggpk.TreeNode, len(args))
+		for i, p := range args {
+			node, err := gf.GetNodeByPath(p)
+			if err != nil {
+				return err
+			}
+			if node.GetParent() == nil {
+				return fmt.Errorf("%w: cannot remove the root directory", ErrUsage)
+			}
+			if _, ok := node.(*ggpk.DirectoryRecord); ok && !*recursive {
+				return fmt.Errorf("%w: '%s' is a directory; use -r to remove it", ErrUsage, p)
+			}
+			nodes[i] = node
+		}
+
+		removed := make(map[ggpk.TreeNode]bool)
+		files, dirs := 0, 0
+		for _, node := range nodes {
+			if removedBelow(node, removed) {
+				continue // Already gone with a directory above it
+			}
+			f, d, err := countNodes(gf, node)
+			if err != nil {
+				return err
+			}
+			if err := node.GetParent().Remove(node.GetName(), gf); err != nil {
+				return err
+			}
+			removed[node] = true
+			files, dirs = files+f, dirs+d
+		}
+		fmt.Fprintf(env.Stdout, "Removed %d files and %d directories\n", files, dirs)
+		return nil
+	}
+}
+
+// removedBelow reports whether node or one of its ancestors is in removed.
+func removedBelow(node ggpk.TreeNode, removed map[ggpk.TreeNode]bool) bool {
+	for n := node; n != nil; {
+		if removed[n] {
+			return true
+		}
+		parent := n.GetParent()
+		if parent == nil {
+			break
+		}
+		n = parent
+	}
+	return false
+}
+
+// countNodes returns the number of files and directories at and below node.
+func countNodes(gf *ggpk.GGPKFile, node ggpk.TreeNode) (files, dirs int, err error) {
+	err = ggpk.Walk(gf, node, func(_ string, n ggpk.TreeNode, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, ok := n.(*ggpk.DirectoryRecord); ok {
+			dirs++
+		} else {
+			files++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return files, dirs, nil
+}
+
+func setupSalvage(fs *flag.FlagSet) runFunc {
+	outDir := fs.String("out", ".", "Output directory")
+	return func(env *Env, _ source.Source, args []string) error {
+		ggpkPath, args := args[0], args[1:]
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		f, err := os.Open(ggpkPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := os.MkdirAll(*outDir, 0o755); err != nil {
+			return err
+		}
+
+		files, mismatches, damaged := 0, 0, int64(0)
+		for record, err := range ggpk.ScanRecords(f) {
+			if err := env.Context.Err(); err != nil {
+				return err
+			}
+			var scanErr *ggpk.ScanError
+			if errors.As(err, &scanErr) {
+				damaged += scanErr.Skipped
+				fmt.Fprintf(env.Stderr, "Warning: %v\n", scanErr)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			fr, ok := record.(*ggpk.FileRecord)
+			if !ok {
+				continue
+			}
+			name := fmt.Sprintf("%d_%s", fr.Offset, salvageName(fr.Name))
+			match, err := salvageFile(f, fr, filepath.Join(*outDir, name))
+			if err != nil {
+				return err
+			}
+			if !match {
+				mismatches++
+				fmt.Fprintf(env.Stderr, "Warning: %s does not match its hash\n", name)
+			}
+			files++
+		}
+		fmt.Fprintf(env.Stdout, "Salvaged %d files (%d not matching their hash), skipped %d damaged bytes\n", files, mismatches, damaged)
+		return nil
+	}
+}
+
+func setupRepair(fs *flag.FlagSet) runFunc {
+	ref := fs.String("ref", "", "GGPK or bundle index listing the expected paths")
+	return func(env *Env, _ source.Source, args []string) error {
+		ggpkPath, args := args[0], args[1:]
+		if err := noArgs(args); err != nil {
+			return err
+		}
+		var reference []ggpk.ReferenceFile
+		if *ref != "" {
+			var err error
+			if reference, err = repairReference(*ref, env.Options); err != nil {
+				return err
+			}
+		}
+		report, err := ggpk.Repair(ggpkPath, reference)
+		if err != nil {
+			return err
+		}
+		for _, p := range report.Relinked {
+			fmt.Fprintf(env.Stdout, "relinked    %s\n", p)
+		}
+		for _, o := range report.Unresolved {
+			fmt.Fprintf(env.Stdout, "unresolved  %s at offset %d\n", o.Name, o.Offset)
+		}
+		fmt.Fprintf(env.Stdout, "Freed %d damaged bytes and %d orphaned directories, dropped %d entries", report.DamagedBytes, report.FreedDirectories, report.DroppedEntries)
+		if report.NewRoot {
+			fmt.Fprint(env.Stdout, ", recreated the root directory")
+		}
+		if report.UnusableBytes > 0 {
+			fmt.Fprintf(env.Stdout, ", left %d damaged bytes too few to free", report.UnusableBytes)
+		}
+		fmt.Fprintln(env.Stdout)
+		if len(report.Unresolved) > 0 {
+			return fmt.Errorf("%d orphaned file(s) could not be placed", len(report.Unresolved))
+		}
+		return nil
+	}
+}
+
+// repairReference lists the files of the source at path: the files of a GGPK with their hashes,
+// or the bundles of an index at the place they have in a bundled GGPK.
+func repairReference(path string, opts source.Options) ([]ggpk.ReferenceFile, error) {
+	src, err := source.Open(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if gf := source.GGPK(src); gf != nil {
+		return ggpk.ReferenceFiles(gf)
+	}
+	idx := source.Index(src)
+	if idx == nil {
+		return nil, fmt.Errorf("a %s source can't be used as a reference", src.Kind())
+	}
+	reference := []ggpk.ReferenceFile{{Path: bundledggpk.BundlesDirectory + "/_.index.bin"}}
+	for _, b := range idx.Bundles {
+		reference = append(reference, ggpk.ReferenceFile{Path: bundledggpk.BundlesDirectory + "/" + b.Path + ".bundle.bin"})
+	}
+	return reference, nil
+}
+
+// salvageName makes the name of a scanned record safe to use as a file name.
+func salvageName(name string) string {
+	if name == "" {
+		return "unnamed"
+	}
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// salvageFile copies the data of a scanned file record to path and reports whether it matches
+// the stored hash.
+func salvageFile(f *os.File, fr *ggpk.FileRecord, path string) (bool, error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return false, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, h), io.NewSectionReader(f, fr.DataOffset, int64(fr.DataLength))); err != nil {
+		out.Close()
+		return false, fmt.Errorf("failed to salvage %s: %w", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return false, err
+	}
+	return bytes.Equal(h.Sum(nil), fr.Hash[:]), nil
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/user/ggpkgo/internal/source"
+)
+
+// Output formats of listings
+const (
+	formatText   = "text"   // Human-readable, specific to each command
+	formatJSON   = "json"   // A single JSON array of entries
+	formatNDJSON = "ndjson" // One JSON entry per line
+	formatCSV    = "csv"    // A header row, then one row per entry
+)
+
+// listEntry is a node of a listing in the machine-readable formats.
+// Fields that don't apply to the kind of source are omitted (empty in CSV).
+type listEntry struct {
+	Path         string `json:"path"`
+	Type         string `json:"type"` // "file" or "directory"
+	Size         int64  `json:"size"`
+	Offset       *int64 `json:"offset,omitempty"`        // Record offset in a GGPK
+	SHA256       string `json:"sha256,omitempty"`        // Hash stored in a GGPK
+	Bundle       string `json:"bundle,omitempty"`        // Bundle holding the file
+	BundleOffset *int64 `json:"bundle_offset,omitempty"` // Offset in the decompressed bundle
+}
+
+var csvHeader = []string{"path", "type", "size", "offset", "sha256", "bundle", "bundle_offset"}
+
+func newListEntry(n *source.Node) *listEntry {
+	e := &listEntry{Path: n.Path, Type: "file", Size: n.Size}
+	if n.IsDir {
+		e.Type = "directory"
+	}
+	if n.Hash != nil { // Nodes of a GGPK
+		offset := n.Offset
+		e.Offset = &offset
+		e.SHA256 = hex.EncodeToString(n.Hash)
+	}
+	if n.Bundle != "" {
+		bundleOffset := n.BundleOffset
+		e.Bundle = n.Bundle
+		e.BundleOffset = &bundleOffset
+	}
+	return e
+}
+
+func (e *listEntry) csvRecord() []string {
+	optional := func(v *int64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatInt(*v, 10)
+	}
+	return []string{e.Path, e.Type, strconv.FormatInt(e.Size, 10), optional(e.Offset), e.SHA256, e.Bundle, optional(e.BundleOffset)}
+}
+
+// formatFlag registers the -format flag of the listing commands (ls, tree and find),
+// whose machine-readable formats hold one listEntry per node.
+func formatFlag(fs *flag.FlagSet) *string {
+	return fs.String("format", formatText, "Output format: text, json, ndjson or csv")
+}
+
+// listWriter writes the entries of a listing in a machine-readable format.
+type listWriter struct {
+	w      io.Writer
+	format string
+	count  int
+	csv    *csv.Writer
+	enc    *json.Encoder
+}
+
+// newListWriter returns a writer for format, or nil for formatText.
+func newListWriter(w io.Writer, format string) (*listWriter, error) {
+	lw := &listWriter{w: w, format: format}
+	switch format {
+	case formatText:
+		return nil, nil
+	case formatJSON, formatNDJSON:
+		lw.enc = json.NewEncoder(w)
+	case formatCSV:
+		lw.csv = csv.NewWriter(w)
+		if err := lw.csv.Write(csvHeader); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown format '%s'", ErrUsage, format)
+	}
+	return lw, nil
+}
+
+func (lw *listWriter) write(n *source.Node) error {
+	e := newListEntry(n)
+	lw.count++
+	switch lw.format {
+	case formatCSV:
+		return lw.csv.Write(e.csvRecord())
+	case formatJSON:
+		// The array is written by hand so that long listings are streamed
+		sep := ",\n  "
+		if lw.count == 1 {
+			sep = "[\n  "
+		}
+		if _, err := io.WriteString(lw.w, sep); err != nil {
+			return err
+		}
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = lw.w.Write(b)
+		return err
+	default:
+		return lw.enc.Encode(e)
+	}
+}
+
+// close ends the listing.
+func (lw *listWriter) close() error {
+	switch lw.format {
+	case formatCSV:
+		lw.csv.Flush()
+		return lw.csv.Error()
+	case formatJSON:
+		end := "\n]\n"
+		if lw.count == 0 {
+			end = "[]\n"
+		}
+		_, err := io.WriteString(lw.w, end)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Package ggpktest builds small GGPK files for tests.
+package ggpktest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// HeaderSize is the length of the GGPKRecord written at the start of every built file.
+const HeaderSize = ggpk.RecordHeaderSize + 4 + 8 + 8
+
+type dir struct {
+	name  string
+	dirs  map[string]*dir
+	files map[string][]byte
+}
+
+func newDir(name string) *dir {
+	return &dir{name: name, dirs: make(map[string]*dir), files: make(map[string][]byte)}
+}
+
+// Build returns the bytes of a version 3 GGPK containing the given files, keyed by
+// slash-separated path. Directories are created as needed, all hashes are valid and
+// there are no FreeRecords. Empty directories can be created with a path ending in "/".
+func Build(tb testing.TB, files map[string][]byte) []byte {
+	tb.Helper()
+	root := newDir("")
+	for path, data := range files {
+		parts := strings.Split(path, "/")
+		d := root
+		for _, part := range parts[:len(parts)-1] {
+			if part == "" {
+				continue
+			}
+			sub, ok := d.dirs[part]
+			if !ok {
+				sub = newDir(part)
+				d.dirs[part] = sub
+			}
+			d = sub
+		}
+		if name := parts[len(parts)-1]; name != "" {
+			d.files[name] = data
+		}
+	}
+
+	out := make([]byte, HeaderSize)
+	rootOffset, _ := writeDir(&out, root)
+	binary.LittleEndian.PutUint32(out[0:], HeaderSize)
+	binary.LittleEndian.PutUint32(out[4:], ggpk.GGPKRecordTag)
+	binary.LittleEndian.PutUint32(out[8:], 3)
+	binary.LittleEndian.PutUint64(out[12:], uint64(rootOffset))
+	binary.LittleEndian.PutUint64(out[20:], 0)
+	return out
+}
+
+// WriteFile builds a GGPK like Build and writes it to a temporary file, returning its path.
+func WriteFile(tb testing.TB, files map[string][]byte) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "Content.ggpk")
+	if err := os.WriteFile(path, Build(tb, files), 0o644); err != nil {
+		tb.Fatalf("Failed to write GGPK: %v", err)
+	}
+	return path
+}
+
+func encodeName(name string) []byte {
+	units := utf16.Encode([]rune(name))
+	b := make([]byte, (len(units)+1)*2)
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[i*2:], u)
+	}
+	return b
+}
+
+type entry struct {
+	nameHash uint32
+	offset   int64
+	hash     [ggpk.HashSize]byte
+}
+
+// writeDir appends the children of d and then d itself, returning its offset and hash.
+func writeDir(out *[]byte, d *dir) (int64, [ggpk.HashSize]byte) {
+	var entries []entry
+	for _, name := range sortedKeys(d.files) {
+		data := d.files[name]
+		e := entry{nameHash: ggpk.NameHash(name), offset: int64(len(*out)), hash: sha256.Sum256(data)}
+		nameBytes := encodeName(name)
+		b := *out
+		b = binary.LittleEndian.AppendUint32(b, uint32(ggpk.RecordHeaderSize+4+ggpk.HashSize+len(nameBytes)+len(data)))
+		b = binary.LittleEndian.AppendUint32(b, ggpk.FileRecordTag)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(nameBytes)/2))
+		b = append(b, e.hash[:]...)
+		b = append(b, nameBytes...)
+		*out = append(b, data...)
+		entries = append(entries, e)
+	}
+	for _, name := range sortedKeys(d.dirs) {
+		offset, hash := writeDir(out, d.dirs[name])
+		entries = append(entries, entry{nameHash: ggpk.NameHash(name), offset: offset, hash: hash})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].nameHash < entries[j].nameHash })
+
+	h := sha256.New()
+	for _, e := range entries {
+		h.Write(e.hash[:])
+	}
+	var hash [ggpk.HashSize]byte
+	h.Sum(hash[:0])
+
+	offset := int64(len(*out))
+	nameBytes := encodeName(d.name)
+	b := *out
+	b = binary.LittleEndian.AppendUint32(b, uint32(ggpk.RecordHeaderSize+4+4+ggpk.HashSize+len(nameBytes)+len(entries)*12))
+	b = binary.LittleEndian.AppendUint32(b, ggpk.PDirRecordTag)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(nameBytes)/2))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(entries)))
+	b = append(b, hash[:]...)
+	b = append(b, nameBytes...)
+	for _, e := range entries {
+		b = binary.LittleEndian.AppendUint32(b, e.nameHash)
+		b = binary.LittleEndian.AppendUint64(b, uint64(e.offset))
+	}
+	*out = b
+	return offset, hash
+}
+
+// sortedKeys keeps the layout of built files deterministic.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,24 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/user/ggpkgo/pkg/bundle"
+	"github.com/user/ggpkgo/pkg/diff"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// Diff compares two sources of the same family: two GGPK files with ggpk.Diff, or two
+// indexes (on disk or in a GGPK) with bundle.DiffIndex.
+func Diff(ctx context.Context, oldSrc, newSrc Source) ([]diff.Change, error) {
+	oldGGPK, oldIsGGPK := oldSrc.(*ggpkSource)
+	newGGPK, newIsGGPK := newSrc.(*ggpkSource)
+	if oldIsGGPK && newIsGGPK {
+		return ggpk.Diff(oldGGPK.gf, newGGPK.gf)
+	}
+	if oldIndex, newIndex := Index(oldSrc), Index(newSrc); oldIndex != nil && newIndex != nil {
+		return bundle.DiffIndex(ctx, oldIndex, newIndex)
+	}
+	return nil, fmt.Errorf("cannot compare a %s source with a %s source", oldSrc.Kind(), newSrc.Kind())
+}
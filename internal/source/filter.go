@@ -0,0 +1,197 @@
+package source
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// SkipDir can be returned by the function given to Walk for a directory to skip its children.
+var SkipDir = fs.SkipDir
+
+// RegexpPrefix marks a filter pattern as a regular expression instead of a glob.
+const RegexpPrefix = "re:"
+
+// Filter selects files by path with include and exclude patterns.
+//
+// A pattern is either a glob or, with the "re:" prefix, a regular expression (RE2 syntax)
+// matched against the full path. Globs match full paths segment by segment: '*', '?' and
+// character classes work as in path.Match within a segment, and a "**" segment matches any
+// number of segments, so "Data/**/*.dat64" matches every .dat64 file below Data.
+// Globs ignore case like the GGPK does, since bundle paths are lowercase; regular expressions
+// are case-sensitive unless they use (?i).
+//
+// A file is selected if it matches an include pattern (or there are none) and no exclude
+// pattern. A directory matching an exclude pattern is skipped with everything below it.
+type Filter struct {
+	includes []*pattern
+	excludes []*pattern
+}
+
+type pattern struct {
+	glob []string // Lowercase segments
+	re   *regexp.Regexp
+	// prefix is the literal text every match of re starts with, if re is anchored with '^'
+	prefix string
+}
+
+// NewFilter parses the patterns. It returns nil if there are none, which selects every file.
+func NewFilter(includes, excludes []string) (*Filter, error) {
+	if len(includes) == 0 && len(excludes) == 0 {
+		return nil, nil
+	}
+	f := &Filter{}
+	for _, p := range includes {
+		pat, err := parsePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.includes = append(f.includes, pat)
+	}
+	for _, p := range excludes {
+		pat, err := parsePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.excludes = append(f.excludes, pat)
+	}
+	return f, nil
+}
+
+func parsePattern(p string) (*pattern, error) {
+	if expr, ok := strings.CutPrefix(p, RegexpPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s': %w", expr, err)
+		}
+		return &pattern{re: re, prefix: anchoredPrefix(expr)}, nil
+	}
+	segments := strings.Split(strings.ToLower(strings.Trim(p, "/")), "/")
+	for _, s := range segments {
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob '%s': %w", p, err)
+		}
+	}
+	return &pattern{glob: segments}, nil
+}
+
+// anchoredPrefix returns the literal text at the start of a regular expression beginning with '^'.
+func anchoredPrefix(expr string) string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 || re.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	if lit := re.Sub[1]; lit.Op == syntax.OpLiteral && lit.Flags&syntax.FoldCase == 0 {
+		return string(lit.Rune)
+	}
+	return ""
+}
+
+// match reports whether the pattern matches the path.
+func (p *pattern) match(segments []string, fullPath string) bool {
+	if p.re != nil {
+		return p.re.MatchString(fullPath)
+	}
+	return matchSegments(p.glob, segments, false)
+}
+
+// mayMatchBelow reports whether the pattern may match a path below the directory.
+func (p *pattern) mayMatchBelow(segments []string, dirPath string) bool {
+	if p.re != nil {
+		dir := dirPath + "/"
+		return p.prefix == "" || dirPath == "" || strings.HasPrefix(dir, p.prefix) || strings.HasPrefix(p.prefix, dir)
+	}
+	return matchSegments(p.glob, segments, true)
+}
+
+// matchSegments reports whether the lowercase glob segments match the path segments.
+// With prefix set, it reports whether they may match a path starting with the segments instead.
+func matchSegments(glob, segments []string, prefix bool) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(glob[1:], segments[i:], prefix) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return prefix
+		}
+		if ok, _ := path.Match(glob[0], strings.ToLower(segments[0])); !ok {
+			return false
+		}
+		glob, segments = glob[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// Match reports whether the file at the path is selected.
+func (f *Filter) Match(filePath string) bool {
+	if f == nil {
+		return true
+	}
+	segments := splitPath(filePath)
+	for _, p := range f.excludes {
+		if p.match(segments, filePath) {
+			return false
+		}
+	}
+	if len(f.includes) == 0 {
+		return true
+	}
+	for _, p := range f.includes {
+		if p.match(segments, filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enter reports whether files below the directory at the path may be selected,
+// so that walks can skip the others.
+func (f *Filter) Enter(dirPath string) bool {
+	if f == nil || dirPath == "" {
+		return true
+	}
+	segments := splitPath(dirPath)
+	for _, p := range f.excludes {
+		if p.match(segments, dirPath) {
+			return false
+		}
+	}
+	if len(f.includes) == 0 {
+		return true
+	}
+	for _, p := range f.includes {
+		if p.mayMatchBelow(segments, dirPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// WalkFiles calls fn for every file below node selected by the filter, in path order,
+// without visiting directories that can't contain any.
+func (f *Filter) WalkFiles(src Source, node *Node, fn func(*Node) error) error {
+	return Walk(src, node, func(n *Node) error {
+		if n.IsDir {
+			if !f.Enter(n.Path) {
+				return SkipDir
+			}
+			return nil
+		}
+		if !f.Match(n.Path) {
+			return nil
+		}
+		return fn(n)
+	})
+}
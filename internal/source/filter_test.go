@@ -0,0 +1,69 @@
+package source
+
+import "testing"
+
+func TestFilter_Match(t *testing.T) {
+	for _, tc := range []struct {
+		includes, excludes []string
+		path               string
+		want               bool
+	}{
+		{[]string{"Data/**/*.dat64"}, nil, "Data/mods.dat64", true},
+		{[]string{"Data/**/*.dat64"}, nil, "data/balance/mods.dat64", true},
+		{[]string{"Data/**/*.dat64"}, nil, "Data/mods.dat", false},
+		{[]string{"Data/**/*.dat64"}, nil, "Art/Data/mods.dat64", false},
+		{[]string{"**/*.ogg"}, nil, "Audio/Music/a.ogg", true},
+		{[]string{"*.txt"}, nil, "Data/a.txt", false},
+		{[]string{`re:\.(ogg|wav)$`}, nil, "Audio/a.wav", true},
+		{[]string{`re:^Audio/`}, nil, "audio/a.wav", false},
+		{nil, []string{"Art/**"}, "Art/a.dds", false},
+		{nil, []string{"Art/**"}, "Data/a.dat64", true},
+		{[]string{"**"}, []string{"re:Music"}, "Audio/Music/a.ogg", false},
+	} {
+		f, err := NewFilter(tc.includes, tc.excludes)
+		if err != nil {
+			t.Fatalf("NewFilter(%q, %q) failed: %v", tc.includes, tc.excludes, err)
+		}
+		if got := f.Match(tc.path); got != tc.want {
+			t.Errorf("Filter(%q, %q).Match(%s) = %v, want %v", tc.includes, tc.excludes, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestFilter_Enter(t *testing.T) {
+	for _, tc := range []struct {
+		includes, excludes []string
+		dir                string
+		want               bool
+	}{
+		{[]string{"Data/**/*.dat64"}, nil, "Data", true},
+		{[]string{"Data/**/*.dat64"}, nil, "Data/Balance/Old", true},
+		{[]string{"Data/**/*.dat64"}, nil, "Art", false},
+		{[]string{"Data/*.dat64"}, nil, "Data/Balance", false},
+		{[]string{"**/*.ogg"}, nil, "Art/Textures", true},
+		{[]string{`re:^Audio/Music/`}, nil, "Audio", true},
+		{[]string{`re:^Audio/Music/`}, nil, "Audio/Music/Act1", true},
+		{[]string{`re:^Audio/Music/`}, nil, "Art", false},
+		{[]string{`re:\.ogg$`}, nil, "Art", true}, // Unanchored expressions can't prune
+		{nil, []string{"Art/**"}, "Art", false},
+		{nil, []string{"**/Textures"}, "Art/Textures", false},
+		{nil, []string{"**/Textures"}, "Art/Models", true},
+	} {
+		f, _ := NewFilter(tc.includes, tc.excludes)
+		if got := f.Enter(tc.dir); got != tc.want {
+			t.Errorf("Filter(%q, %q).Enter(%s) = %v, want %v", tc.includes, tc.excludes, tc.dir, got, tc.want)
+		}
+	}
+}
+
+func TestNewFilter_Invalid(t *testing.T) {
+	if _, err := NewFilter([]string{"Data/[a-"}, nil); err == nil {
+		t.Error("Expected an error for an invalid glob")
+	}
+	if _, err := NewFilter(nil, []string{"re:("}); err == nil {
+		t.Error("Expected an error for an invalid regular expression")
+	}
+	if f, err := NewFilter(nil, nil); f != nil || err != nil || !f.Match("anything") {
+		t.Errorf("Expected a nil filter selecting everything, got %v (%v)", f, err)
+	}
+}
@@ -0,0 +1,155 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// ggpkSource is a Content.ggpk read through its own directory tree.
+type ggpkSource struct {
+	path string
+	gf   *ggpk.GGPKFile
+	root *Node
+}
+
+// FromGGPK wraps an opened GGPK, e.g. one read from a bundle, as a source.
+// Closing the source closes gf. path is only used for display.
+func FromGGPK(path string, gf *ggpk.GGPKFile) Source {
+	return &ggpkSource{path: path, gf: gf, root: ggpkNode(gf.Root)}
+}
+
+func ggpkNode(tn ggpk.TreeNode) *Node {
+	n := &Node{Name: tn.GetName(), Path: tn.GetPath(), impl: tn}
+	switch r := tn.(type) {
+	case *ggpk.DirectoryRecord:
+		n.IsDir = true
+		n.Offset = r.Offset
+		n.Hash = r.Hash[:]
+	case *ggpk.FileRecord:
+		n.Size = int64(r.DataLength)
+		n.Offset = r.Offset
+		n.Hash = r.Hash[:]
+	}
+	return n
+}
+
+func (s *ggpkSource) Kind() Kind   { return KindGGPK }
+func (s *ggpkSource) Path() string { return s.path }
+func (s *ggpkSource) Root() *Node  { return s.root }
+func (s *ggpkSource) Close() error { return s.gf.Close() }
+
+func (s *ggpkSource) Lookup(p string) (*Node, error) {
+	if len(splitPath(p)) == 0 {
+		return s.root, nil
+	}
+	tn, err := s.gf.GetNodeByPath(p)
+	if errors.Is(err, ggpk.ErrNotFound) || errors.Is(err, ggpk.ErrNotDirectory) {
+		return nil, fmt.Errorf("'%s' not found: %w", p, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up '%s': %w", p, err)
+	}
+	return ggpkNode(tn), nil
+}
+
+func (s *ggpkSource) Children(dir *Node) ([]*Node, error) {
+	dr, ok := dir.impl.(*ggpk.DirectoryRecord)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a directory", dir.Path)
+	}
+	children, err := dr.GetChildren(s.gf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory '%s': %w", dir.Path, err)
+	}
+	nodes := make([]*Node, len(children))
+	for i, child := range children {
+		nodes[i] = ggpkNode(child)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes, nil
+}
+
+func (s *ggpkSource) ReadFile(file *Node) ([]byte, error) {
+	fr, ok := file.impl.(*ggpk.FileRecord)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is a directory", file.Path)
+	}
+	return s.gf.ReadRawData(fr)
+}
+
+func (s *ggpkSource) Info() []Field {
+	return append([]Field{{"Kind", string(KindGGPK)}, {"Path", s.path}}, ggpkInfo(s.gf)...)
+}
+
+func ggpkInfo(gf *ggpk.GGPKFile) []Field {
+	return []Field{
+		{"Version", strconv.FormatUint(uint64(gf.Header.Version), 10)},
+		{"Root offset", strconv.FormatInt(gf.Header.RootDirectoryOffset, 10)},
+		{"First free offset", strconv.FormatInt(gf.Header.FirstFreeOffset, 10)},
+	}
+}
+
+// Verify checks the SHA-256 of every file against its stored data, and the hash of every
+// directory below the first level against the hashes of its entries. The hashes of the root and
+// its direct children are left as they were by modifications (see ggpk.RenewHashes), so they
+// aren't checked.
+func (s *ggpkSource) Verify(ctx context.Context) (*VerifyReport, error) {
+	report := &VerifyReport{Issues: []Issue{}}
+	add := func(n *Node, kind, format string, args ...any) {
+		report.Issues = append(report.Issues, Issue{Path: n.Path, Kind: kind, Message: fmt.Sprintf(format, args...)})
+	}
+	var verifyNode func(n *Node, depth int) error
+	verifyNode = func(n *Node, depth int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if fr, ok := n.impl.(*ggpk.FileRecord); ok {
+			report.FilesChecked++
+			if sum, err := s.gf.DataHash(fr); err != nil {
+				add(n, IssueUnreadable, "%v", err)
+			} else if sum != fr.Hash {
+				add(n, IssueHashMismatch, "content hash is %x, stored hash is %x", sum, fr.Hash)
+			}
+			return nil
+		}
+
+		dr := n.impl.(*ggpk.DirectoryRecord)
+		children, err := dr.GetChildren(s.gf)
+		if err != nil {
+			add(n, IssueUnreadable, "%v", err)
+			return nil
+		}
+		if depth > 1 {
+			// The directory hash covers the stored hashes of the entries, in entry order
+			h := sha256.New()
+			for _, child := range children {
+				switch c := child.(type) {
+				case *ggpk.FileRecord:
+					h.Write(c.Hash[:])
+				case *ggpk.DirectoryRecord:
+					h.Write(c.Hash[:])
+				}
+			}
+			if sum := h.Sum(nil); !bytes.Equal(sum, dr.Hash[:]) {
+				add(n, IssueHashMismatch, "hash of the entries is %x, stored hash is %x", sum, dr.Hash)
+			}
+		}
+		for _, child := range children {
+			if err := verifyNode(ggpkNode(child), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := verifyNode(s.root, 0); err != nil {
+		return report, err
+	}
+	return report, nil
+}
@@ -0,0 +1,188 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/user/ggpkgo/pkg/bundle"
+	"github.com/user/ggpkgo/pkg/bundledggpk"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// indexSource is a bundle index read through the tree of its parsed paths.
+type indexSource struct {
+	path string
+	idx  *bundle.Index
+	root *Node
+
+	// The bundle of the last file read, since consecutive reads usually hit the same bundle
+	bundle *bundle.Bundle
+}
+
+func openIndex(path string) (Source, error) {
+	idx, err := bundle.OpenIndex(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newIndexSource(path, idx)
+}
+
+func newIndexSource(path string, idx *bundle.Index) (*indexSource, error) {
+	if _, err := idx.ParsePaths(); err != nil {
+		return nil, fmt.Errorf("failed to parse paths of index %s: %w", path, err)
+	}
+	root, err := idx.BuildTree(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tree of index %s: %w", path, err)
+	}
+	return &indexSource{path: path, idx: idx, root: indexNode(root)}, nil
+}
+
+func indexNode(tn bundle.TreeNode) *Node {
+	n := &Node{Name: tn.GetName(), Path: tn.GetPath(), IsDir: tn.IsDirectory(), impl: tn}
+	if f, ok := tn.(*bundle.FileNode); ok {
+		n.Size = int64(f.RecordVal.Size)
+		n.BundleOffset = int64(f.RecordVal.Offset)
+		n.Bundle = f.RecordVal.BundleRecord.Path
+		n.PathHash = f.RecordVal.PathHash
+	}
+	return n
+}
+
+func (s *indexSource) Kind() Kind           { return KindIndex }
+func (s *indexSource) index() *bundle.Index { return s.idx }
+func (s *indexSource) Path() string         { return s.path }
+func (s *indexSource) Root() *Node          { return s.root }
+
+func (s *indexSource) Close() error {
+	if s.bundle != nil {
+		err := s.bundle.Close()
+		s.bundle = nil
+		return err
+	}
+	return nil
+}
+
+func (s *indexSource) Lookup(p string) (*Node, error) {
+	var node bundle.TreeNode = s.root.impl.(*bundle.DirectoryNode)
+	for _, name := range splitPath(p) {
+		dir, ok := node.(*bundle.DirectoryNode)
+		if !ok {
+			return nil, fmt.Errorf("'%s' %w: '%s' is not a directory", p, bundle.ErrNotFound, node.GetPath())
+		}
+		node = nil
+		for _, child := range dir.ChildrenVal {
+			if child.GetName() == name {
+				node = child
+				break
+			}
+		}
+		if node == nil {
+			return nil, fmt.Errorf("'%s' %w", p, bundle.ErrNotFound)
+		}
+	}
+	return indexNode(node), nil
+}
+
+func (s *indexSource) Children(dir *Node) ([]*Node, error) {
+	dn, ok := dir.impl.(*bundle.DirectoryNode)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a directory", dir.Path)
+	}
+	nodes := make([]*Node, len(dn.ChildrenVal))
+	for i, child := range dn.ChildrenVal {
+		nodes[i] = indexNode(child)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes, nil
+}
+
+func (s *indexSource) ReadFile(file *Node) ([]byte, error) {
+	fn, ok := file.impl.(*bundle.FileNode)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is a directory", file.Path)
+	}
+	rec := fn.RecordVal
+	if s.bundle == nil || s.bundle.Record != rec.BundleRecord {
+		s.Close()
+		b, err := s.idx.GetBundleForFileRecord(rec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open bundle %s: %w", rec.BundleRecord.Path, err)
+		}
+		s.bundle = b
+	}
+	return s.bundle.ReadAt(rec.Offset, rec.Size)
+}
+
+func (s *indexSource) Info() []Field {
+	return append([]Field{{"Kind", string(KindIndex)}, {"Path", s.path}}, indexInfo(s.idx)...)
+}
+
+func indexInfo(idx *bundle.Index) []Field {
+	return []Field{
+		{"Bundles", strconv.Itoa(len(idx.Bundles))},
+		{"Files", strconv.Itoa(len(idx.FilesByPathHash))},
+		{"Directories", strconv.Itoa(len(idx.Directories))},
+	}
+}
+
+func (s *indexSource) Verify(ctx context.Context) (*VerifyReport, error) {
+	s.Close() // Verify opens every bundle itself
+	r, err := s.idx.Verify(ctx)
+	if r == nil {
+		return nil, err
+	}
+	report := &VerifyReport{FilesChecked: r.FilesChecked, BundlesChecked: r.BundlesChecked, Issues: []Issue{}}
+	for _, issue := range r.Issues {
+		report.Issues = append(report.Issues, Issue{Path: issue.File, Bundle: issue.Bundle, Kind: string(issue.Kind), Message: issue.Message})
+	}
+	return report, err
+}
+
+// bundledGGPKSource is the index stored in the Bundles2 directory of a GGPK, with the bundles read
+// from the same GGPK. The tree is the one of the index; the GGPK itself is only used for storage.
+type bundledGGPKSource struct {
+	*indexSource
+	gf *ggpk.GGPKFile
+}
+
+func openBundledGGPK(path string, gf *ggpk.GGPKFile) (Source, error) {
+	idx, err := bundledggpk.OpenGGPKIndex(gf)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newIndexSource(path, idx)
+	if err != nil {
+		return nil, err
+	}
+	return &bundledGGPKSource{indexSource: s, gf: gf}, nil
+}
+
+func (s *bundledGGPKSource) Kind() Kind { return KindBundledGGPK }
+
+func (s *bundledGGPKSource) Close() error {
+	s.indexSource.Close()
+	return s.gf.Close()
+}
+
+func (s *bundledGGPKSource) Info() []Field {
+	fields := append([]Field{{"Kind", string(KindBundledGGPK)}, {"Path", s.path}}, ggpkInfo(s.gf)...)
+	return append(fields, indexInfo(s.idx)...)
+}
+
+// Verify checks the GGPK first, then the bundles stored in it.
+func (s *bundledGGPKSource) Verify(ctx context.Context) (*VerifyReport, error) {
+	report, err := FromGGPK(s.path, s.gf).Verify(ctx)
+	if err != nil {
+		return report, err
+	}
+	bundles, err := s.indexSource.Verify(ctx)
+	if bundles != nil {
+		report.FilesChecked += bundles.FilesChecked
+		report.BundlesChecked = bundles.BundlesChecked
+		report.Issues = append(report.Issues, bundles.Issues...)
+	}
+	return report, err
+}
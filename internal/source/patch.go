@@ -0,0 +1,74 @@
+package source
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/user/ggpkgo/pkg/diff"
+)
+
+// DeletedManifest is the entry of a patch archive listing the removed files, one path per line.
+const DeletedManifest = "_deleted.txt"
+
+// WritePatch writes a zip archive to w holding the added and modified files of changes, read
+// from newSrc at their paths, followed by the DeletedManifest entry listing the removed files.
+// The manifest is written even if nothing was removed. It returns the number of files written.
+func WritePatch(ctx context.Context, w io.Writer, newSrc Source, changes []diff.Change) (int, error) {
+	var files []*Node
+	var deleted strings.Builder
+	for _, c := range changes {
+		if c.Kind == diff.Removed {
+			deleted.WriteString(c.Path)
+			deleted.WriteByte('\n')
+			continue
+		}
+		node, err := newSrc.Lookup(c.Path)
+		if err != nil {
+			return 0, err
+		}
+		if node.IsDir {
+			return 0, fmt.Errorf("'%s' is a directory", c.Path)
+		}
+		files = append(files, node)
+	}
+	// Read the files of a bundle together, in the order they are stored
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Bundle != files[j].Bundle {
+			return files[i].Bundle < files[j].Bundle
+		}
+		return files[i].BundleOffset < files[j].BundleOffset
+	})
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		data, err := newSrc.ReadFile(f)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read '%s': %w", f.Path, err)
+		}
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: f.Path, Method: zip.Deflate})
+		if err != nil {
+			return 0, err
+		}
+		if _, err := entry.Write(data); err != nil {
+			return 0, fmt.Errorf("failed to write '%s': %w", f.Path, err)
+		}
+	}
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: DeletedManifest, Method: zip.Deflate})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.WriteString(entry, deleted.String()); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	return len(files), nil
+}
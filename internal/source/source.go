@@ -0,0 +1,294 @@
+// Package source gives the command line tools a common view of the three kinds of
+// installs: a Content.ggpk, a bundle index (_.index.bin) with its bundles on disk,
+// and a Content.ggpk holding the bundles in its Bundles2 directory.
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/ggpkgo/pkg/bundle"
+	"github.com/user/ggpkgo/pkg/bundledggpk"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// Kind identifies the type of a source.
+type Kind string
+
+const (
+	KindGGPK        Kind = "ggpk"         // A Content.ggpk without bundles
+	KindIndex       Kind = "index"        // An _.index.bin with the bundles next to it (Steam/Epic)
+	KindBundledGGPK Kind = "bundled-ggpk" // A Content.ggpk with Bundles2 inside (Standalone client)
+)
+
+// Node is a file or directory of a source.
+// Paths are slash-separated and relative to the root, whose path is "".
+type Node struct {
+	Name  string
+	Path  string
+	IsDir bool
+	Size  int64 // Size of the stored data, 0 for directories
+
+	// Offset is the offset of the record in a GGPK, 0 for index sources.
+	Offset int64
+	// Hash is the SHA-256 stored in a GGPK, nil for index sources.
+	Hash []byte
+	// Bundle is the path of the bundle holding the file, for index sources.
+	Bundle string
+	// BundleOffset is the offset of the file content in its decompressed bundle, for index sources.
+	BundleOffset int64
+	// PathHash is the hash of the path in the bundle index, for index sources.
+	PathHash uint64
+
+	impl any // ggpk.TreeNode or bundle.TreeNode
+}
+
+// Field is a named value describing a source.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Issue is a problem found by Source.Verify.
+type Issue struct {
+	Path    string `json:"path,omitempty"`   // Affected file or directory, if any
+	Bundle  string `json:"bundle,omitempty"` // Affected bundle, for index sources
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Issue kinds of GGPK sources. Index sources use the bundle.VerifyIssueKind values.
+const (
+	IssueHashMismatch = "hash_mismatch" // The stored SHA-256 doesn't match the content
+	IssueUnreadable   = "unreadable"    // The record or its data couldn't be read
+)
+
+// VerifyReport is the result of Source.Verify.
+type VerifyReport struct {
+	FilesChecked   int     `json:"files_checked"`
+	BundlesChecked int     `json:"bundles_checked,omitempty"`
+	Issues         []Issue `json:"issues"`
+}
+
+// Source is an opened install. Sources are not safe for concurrent use.
+type Source interface {
+	Kind() Kind
+	// Path returns the path the source was opened from.
+	Path() string
+	Root() *Node
+	// Lookup returns the node at the slash-separated path; "" and "/" are the root.
+	Lookup(path string) (*Node, error)
+	// Children returns the children of a directory, sorted by name.
+	Children(dir *Node) ([]*Node, error)
+	// ReadFile returns the content of a file.
+	ReadFile(file *Node) ([]byte, error)
+	// Info describes the source.
+	Info() []Field
+	// Verify checks the integrity of the whole source. Problems are collected in the report;
+	// the error is only non-nil if the check couldn't run or ctx was cancelled.
+	Verify(ctx context.Context) (*VerifyReport, error)
+	Close() error
+}
+
+// Options control how Open interprets its argument.
+type Options struct {
+	// Kind forces the kind of the source instead of detecting it.
+	// KindGGPK also opens a GGPK with bundles as a plain GGPK.
+	Kind Kind
+	// Writable opens GGPK files for writing. Changes are flushed by Close.
+	Writable bool
+}
+
+// Open opens a Content.ggpk, an _.index.bin, or an install directory containing one of them.
+// GGPK files with a Bundles2/_.index.bin are opened as KindBundledGGPK unless opts.Kind says otherwise.
+func Open(path string, opts Options) (Source, error) {
+	path, err := FindFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := opts.Kind
+	if kind == "" {
+		isGGPK, err := hasGGPKHeader(path)
+		if err != nil {
+			return nil, err
+		}
+		kind = KindIndex
+		if isGGPK {
+			kind = KindBundledGGPK // Falls back to KindGGPK below if there are no bundles
+		}
+	}
+
+	switch kind {
+	case KindIndex:
+		return openIndex(path)
+	case KindGGPK, KindBundledGGPK:
+		open := ggpk.Open
+		if opts.Writable {
+			open = ggpk.OpenReadWrite
+		}
+		gf, err := open(path)
+		if err != nil {
+			return nil, err
+		}
+		if kind == KindBundledGGPK {
+			if _, err := gf.GetNodeByPath(bundledggpk.BundlesDirectory + "/_.index.bin"); err == nil || opts.Kind == KindBundledGGPK {
+				src, err := openBundledGGPK(path, gf)
+				if err != nil {
+					gf.Close()
+					return nil, err
+				}
+				return src, nil
+			}
+		}
+		return FromGGPK(path, gf), nil
+	default:
+		return nil, fmt.Errorf("unknown source kind '%s'", kind)
+	}
+}
+
+// GGPK returns the GGPK file of a KindGGPK or KindBundledGGPK source, or nil for an index.
+func GGPK(src Source) *ggpk.GGPKFile {
+	switch s := src.(type) {
+	case *ggpkSource:
+		return s.gf
+	case *bundledGGPKSource:
+		return s.gf
+	}
+	return nil
+}
+
+// Index returns the bundle index of a KindIndex or KindBundledGGPK source, or nil for a plain GGPK.
+func Index(src Source) *bundle.Index {
+	if s, ok := src.(interface{ index() *bundle.Index }); ok {
+		return s.index()
+	}
+	return nil
+}
+
+// FindFile returns the file Open reads for path: path itself, or the GGPK or index
+// of an install directory.
+func FindFile(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		return findInDirectory(path)
+	}
+	return path, nil
+}
+
+// findInDirectory returns the GGPK or index of an install directory.
+func findInDirectory(dir string) (string, error) {
+	for _, name := range []string{"Content.ggpk", "_.index.bin", filepath.Join(bundledggpk.BundlesDirectory, "_.index.bin")} {
+		p := filepath.Join(dir, name)
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no Content.ggpk or _.index.bin found in directory %s", dir)
+}
+
+// hasGGPKHeader reports whether the file starts with a GGPKRecord.
+func hasGGPKHeader(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	header := make([]byte, ggpk.RecordHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil // Too short for a GGPK, let the index parser report the error
+		}
+		return false, fmt.Errorf("failed to read header of %s: %w", path, err)
+	}
+	return ggpk.GGPKEndian.Uint32(header[4:]) == ggpk.GGPKRecordTag, nil
+}
+
+// Walk calls fn for node and everything below it, directories before their children
+// and children in name order. If fn returns SkipDir for a directory, its children are
+// skipped; for a file, the remaining entries of its directory are.
+func Walk(src Source, node *Node, fn func(*Node) error) error {
+	err := walk(src, node, fn)
+	if err == SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walk(src Source, node *Node, fn func(*Node) error) error {
+	if err := fn(node); err != nil {
+		if err == SkipDir && node.IsDir {
+			return nil
+		}
+		return err
+	}
+	if !node.IsDir {
+		return nil
+	}
+	children, err := src.Children(node)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := walk(src, child, fn); err != nil {
+			if err == SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkFiles calls fn for every file below node in path order.
+func WalkFiles(src Source, node *Node, fn func(*Node) error) error {
+	return Walk(src, node, func(n *Node) error {
+		if n.IsDir {
+			return nil
+		}
+		return fn(n)
+	})
+}
+
+// WriteTree writes the tree below node to w, indenting each level by two spaces.
+// Directories end with "/" and the root is written as "/".
+func WriteTree(w io.Writer, src Source, node *Node) error {
+	base := depth(node)
+	return Walk(src, node, func(n *Node) error {
+		indent := strings.Repeat("  ", depth(n)-base)
+		var err error
+		switch {
+		case n.Path == "":
+			_, err = fmt.Fprintln(w, "/")
+		case n.IsDir:
+			_, err = fmt.Fprintf(w, "%s%s/\n", indent, n.Name)
+		default:
+			_, err = fmt.Fprintf(w, "%s%s\n", indent, n.Name)
+		}
+		return err
+	})
+}
+
+// depth returns the number of components in the path of n.
+func depth(n *Node) int {
+	if n.Path == "" {
+		return 0
+	}
+	return strings.Count(n.Path, "/") + 1
+}
+
+// splitPath returns the components of a path given to Lookup.
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
@@ -0,0 +1,157 @@
+package source
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/bundletest"
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+var testBundles = map[string]map[string][]byte{
+	"Data/Bundle0": {"data/mods.dat64": []byte("mods")},
+	"Art/Bundle1":  {"art/a.dds": []byte("texture a"), "readme.txt": []byte("hello bundles")},
+}
+
+func open(t *testing.T, path string, opts Options) Source {
+	t.Helper()
+	src, err := Open(path, opts)
+	if err != nil {
+		t.Fatalf("Open(%s) failed: %v", path, err)
+	}
+	t.Cleanup(func() { src.Close() })
+	return src
+}
+
+func readFile(t *testing.T, src Source, path string) string {
+	t.Helper()
+	node, err := src.Lookup(path)
+	if err != nil {
+		t.Fatalf("Lookup(%s) failed: %v", path, err)
+	}
+	data, err := src.ReadFile(node)
+	if err != nil {
+		t.Fatalf("ReadFile(%s) failed: %v", path, err)
+	}
+	return string(data)
+}
+
+func tree(t *testing.T, src Source) string {
+	t.Helper()
+	var sb strings.Builder
+	if err := WriteTree(&sb, src, src.Root()); err != nil {
+		t.Fatalf("WriteTree failed: %v", err)
+	}
+	return sb.String()
+}
+
+func TestOpen_Kinds(t *testing.T) {
+	ggpkPath := ggpktest.WriteFile(t, map[string][]byte{"Data/b.txt": []byte("bbb"), "a.txt": []byte("a")})
+	indexPath := bundletest.WriteIndex(t, t.TempDir(), testBundles)
+	bundledPath := ggpktest.WriteFile(t, bundletest.Files(t, "Bundles2", testBundles))
+	bundlesTree := "/\n  art/\n    a.dds\n  data/\n    mods.dat64\n  readme.txt\n"
+
+	for _, tc := range []struct {
+		name, path string
+		kind       Kind
+		tree       string
+		file, data string
+	}{
+		{"ggpk", ggpkPath, KindGGPK, "/\n  Data/\n    b.txt\n  a.txt\n", "Data/b.txt", "bbb"},
+		{"ggpk directory", filepath.Dir(ggpkPath), KindGGPK, "", "a.txt", "a"},
+		{"index", indexPath, KindIndex, bundlesTree, "art/a.dds", "texture a"},
+		{"index directory", filepath.Dir(indexPath), KindIndex, "", "readme.txt", "hello bundles"},
+		{"bundled ggpk", bundledPath, KindBundledGGPK, bundlesTree, "data/mods.dat64", "mods"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := open(t, tc.path, Options{})
+			if src.Kind() != tc.kind {
+				t.Errorf("Expected kind %s, got %s", tc.kind, src.Kind())
+			}
+			if tc.tree != "" {
+				if got := tree(t, src); got != tc.tree {
+					t.Errorf("Unexpected tree:\n%s\nexpected:\n%s", got, tc.tree)
+				}
+			}
+			if got := readFile(t, src, tc.file); got != tc.data {
+				t.Errorf("Unexpected content of %s: %q", tc.file, got)
+			}
+			if _, err := src.Lookup("missing/file"); err == nil {
+				t.Error("Expected an error for a missing path")
+			}
+			report, err := src.Verify(context.Background())
+			if err != nil || len(report.Issues) != 0 {
+				t.Errorf("Expected a clean report, got %+v (%v)", report, err)
+			}
+		})
+	}
+
+	// The GGPK holding the bundles can still be browsed as a plain GGPK
+	src := open(t, bundledPath, Options{Kind: KindGGPK})
+	if _, err := src.Lookup("Bundles2/_.index.bin"); src.Kind() != KindGGPK || err != nil {
+		t.Errorf("Expected a plain GGPK with Bundles2, got kind %s (%v)", src.Kind(), err)
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	if _, err := Open(t.TempDir(), Options{}); err == nil {
+		t.Error("Expected an error for a directory without GGPK or index")
+	}
+	garbage := filepath.Join(t.TempDir(), "garbage.bin")
+	os.WriteFile(garbage, []byte("not an index"), 0o644)
+	if _, err := Open(garbage, Options{}); err == nil {
+		t.Error("Expected an error for a file that is neither a GGPK nor an index")
+	}
+}
+
+func TestGGPKSource_Verify(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("aaaa"), "Data/b.txt": []byte("bbbb")})
+	src := open(t, path, Options{})
+	node, err := src.Lookup("Data/b.txt")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	src.Close()
+
+	// Corrupt the last byte of b.txt, which ends its record
+	data, _ := os.ReadFile(path)
+	data[node.Offset+int64(binary.LittleEndian.Uint32(data[node.Offset:]))-1] = 'X'
+	os.WriteFile(path, data, 0o644)
+
+	report, err := open(t, path, Options{}).Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if report.FilesChecked != 2 || len(report.Issues) != 1 || report.Issues[0].Path != "Data/b.txt" || report.Issues[0].Kind != IssueHashMismatch {
+		t.Errorf("Expected a hash mismatch for Data/b.txt, got %+v", report)
+	}
+}
+
+func TestGGPKSource_Verify_Modified(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{"Data/Sub/a.txt": []byte("aaaa"), "Data/b.txt": []byte("bbbb")})
+	gf, err := ggpk.OpenReadWrite(path)
+	if err != nil {
+		t.Fatalf("OpenReadWrite failed: %v", err)
+	}
+	fr, err := gf.GetNodeByPath("Data/Sub/a.txt")
+	if err != nil {
+		t.Fatalf("GetNodeByPath failed: %v", err)
+	}
+	if err := gf.WriteFileData(fr.(*ggpk.FileRecord), []byte("modified")); err != nil {
+		t.Fatalf("WriteFileData failed: %v", err)
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The root and Data keep their hashes, Data/Sub has a new one
+	report, err := open(t, path, Options{}).Verify(context.Background())
+	if err != nil || len(report.Issues) != 0 {
+		t.Errorf("Expected a clean report, got %+v (%v)", report, err)
+	}
+}
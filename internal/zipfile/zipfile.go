@@ -0,0 +1,22 @@
+// Package zipfile reads the entries of the zip archives applied by the replace commands.
+package zipfile
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+)
+
+// ReadEntry returns the uncompressed content of a zip entry.
+func ReadEntry(entry *zip.File) ([]byte, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip entry %s: %w", entry.Name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip entry %s: %w", entry.Name, err)
+	}
+	return data, nil
+}
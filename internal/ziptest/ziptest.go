@@ -0,0 +1,31 @@
+// Package ziptest builds small zip archives for tests.
+package ziptest
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// Reader builds a zip archive holding the files in the given order, as pairs of a name and
+// its content.
+func Reader(t *testing.T, files ...string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	return zr
+}
@@ -22,6 +22,8 @@ type Bundle struct {
 	CompressedChunkSizes []int32
 	Record               *IndexBundleRecord // Link back to its record in the main Index, if applicable
 	leaveOpen            bool
+	reader               io.ReadSeeker // File, or the reader given to OpenBundle
+	name                 string        // Path of the bundle, used in errors
 
 	// For caching decompressed content (optional, similar to C#)
 	cachedContent []byte
@@ -35,23 +37,46 @@ func OpenBundleFile(filePath string, record *IndexBundleRecord, leaveOpen bool)
 		return nil, fmt.Errorf("failed to open bundle file %s: %w", filePath, err)
 	}
 
+	b, err := newBundle(f, filePath, record)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	b.File = f
+	b.leaveOpen = leaveOpen
+	return b, nil
+}
+
+// OpenBundle reads a bundle from r, e.g. a bundle stored inside a GGPK.
+// The reader is not closed by Close.
+func OpenBundle(r io.ReadSeeker, record *IndexBundleRecord) (*Bundle, error) {
+	name := "(reader)"
+	if record != nil {
+		name = record.Path
+	}
+	return newBundle(r, name, record)
+}
+
+// newBundle reads the header and chunk sizes of the bundle in r. name is only used in errors.
+func newBundle(r io.ReadSeeker, name string, record *IndexBundleRecord) (*Bundle, error) {
 	b := &Bundle{
-		File:      f,
-		Record:    record,
-		leaveOpen: leaveOpen,
+		Record: record,
+		reader: r,
+		name:   name,
 	}
 
 	// Read header
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to bundle header of %s: %w", name, err)
+	}
 	headerBytes := make([]byte, BundleHeaderSize)
-	if _, err := io.ReadFull(f, headerBytes); err != nil {
-		f.Close()
-		return nil, fmt.Errorf("failed to read bundle header from %s: %w", filePath, err)
+	if _, err := io.ReadFull(r, headerBytes); err != nil {
+		return nil, fmt.Errorf("failed to read bundle header from %s: %w", name, err)
 	}
 
 	reader := bytes.NewReader(headerBytes)
 	if err := binary.Read(reader, binary.LittleEndian, &b.Header); err != nil {
-		f.Close()
-		return nil, fmt.Errorf("failed to parse bundle header from %s: %w", filePath, err)
+		return nil, fmt.Errorf("failed to parse bundle header from %s: %w", name, err)
 	}
 
 	if b.Record != nil {
@@ -59,19 +84,16 @@ func OpenBundleFile(filePath string, record *IndexBundleRecord, leaveOpen bool)
 	}
 
 	if b.Header.ChunkCount < 0 {
-		f.Close()
-		return nil, fmt.Errorf("invalid chunk count %d in bundle %s", b.Header.ChunkCount, filePath)
+		return nil, fmt.Errorf("%w: invalid chunk count %d in bundle %s", ErrCorrupt, b.Header.ChunkCount, name)
 	}
 	if b.Header.ChunkCount > 1000000 {
-		f.Close()
-		return nil, fmt.Errorf("unreasonable chunk count %d in bundle %s", b.Header.ChunkCount, filePath)
+		return nil, fmt.Errorf("%w: unreasonable chunk count %d in bundle %s", ErrCorrupt, b.Header.ChunkCount, name)
 	}
 
 	b.CompressedChunkSizes = make([]int32, b.Header.ChunkCount)
 	if b.Header.ChunkCount > 0 { // Only read if there are chunks
-		if err := binary.Read(f, binary.LittleEndian, &b.CompressedChunkSizes); err != nil {
-			f.Close()
-			return nil, fmt.Errorf("failed to read compressed chunk sizes from %s: %w", filePath, err)
+		if err := binary.Read(r, binary.LittleEndian, &b.CompressedChunkSizes); err != nil {
+			return nil, fmt.Errorf("failed to read compressed chunk sizes from %s: %w", name, err)
 		}
 	}
 
@@ -79,12 +101,17 @@ func OpenBundleFile(filePath string, record *IndexBundleRecord, leaveOpen bool)
 }
 
 // Close closes the bundle file if it wasn't opened with leaveOpen=true.
+// Bundles opened by OpenBundle only stop using their reader.
 func (b *Bundle) Close() error {
 	if b.File != nil && !b.leaveOpen {
 		err := b.File.Close()
 		b.File = nil // Mark as closed
+		b.reader = nil
 		return err
 	}
+	if b.File == nil {
+		b.reader = nil // Bundles from OpenBundle don't own their reader
+	}
 	return nil
 }
 
@@ -98,7 +125,7 @@ func (h *BundleHeader) GetLastChunkUncompressedSize() int32 {
 
 // ReadAt extracts and decompresses data for a specific file entry within this bundle.
 func (b *Bundle) ReadAt(offsetInBundle int32, sizeInBundle int32) ([]byte, error) {
-	if b.File == nil {
+	if b.reader == nil {
 		return nil, fmt.Errorf("bundle file is closed or not opened")
 	}
 	if sizeInBundle == 0 {
@@ -108,7 +135,7 @@ func (b *Bundle) ReadAt(offsetInBundle int32, sizeInBundle int32) ([]byte, error
 		return nil, fmt.Errorf("invalid size for ReadAt: %d", sizeInBundle)
 	}
 	if offsetInBundle < 0 || offsetInBundle+sizeInBundle > b.Header.UncompressedSize {
-		return nil, fmt.Errorf("read offset/size out of bounds (offset: %d, size: %d, uncompressed: %d)",
+		return nil, fmt.Errorf("%w: read offset/size out of bounds (offset: %d, size: %d, uncompressed: %d)", ErrCorrupt,
 			offsetInBundle, sizeInBundle, b.Header.UncompressedSize)
 	}
 
@@ -127,14 +154,14 @@ func (b *Bundle) ReadAt(offsetInBundle int32, sizeInBundle int32) ([]byte, error
 
 // ReadFull reads and decompresses the entire bundle content, using cache if available.
 func (b *Bundle) ReadFull() ([]byte, error) {
-	if b.File == nil {
+	if b.reader == nil {
 		return nil, fmt.Errorf("bundle file is closed or not opened")
 	}
 	if b.Header.UncompressedSize == 0 {
 		return []byte{}, nil
 	}
     if b.Header.UncompressedSize < 0 {
-        return nil, fmt.Errorf("bundle header reports negative uncompressed size: %d", b.Header.UncompressedSize)
+        return nil, fmt.Errorf("%w: bundle header reports negative uncompressed size: %d", ErrCorrupt, b.Header.UncompressedSize)
     }
 
 	if b.cachedContent != nil {
@@ -143,10 +170,10 @@ func (b *Bundle) ReadFull() ([]byte, error) {
 
 	decompressedData := make([]byte, b.Header.UncompressedSize)
 	if b.Header.ChunkCount == 0 && b.Header.UncompressedSize > 0 {
-		return nil, fmt.Errorf("bundle has uncompressed size > 0 but 0 chunks")
+		return nil, fmt.Errorf("%w: bundle has uncompressed size > 0 but 0 chunks", ErrCorrupt)
 	}
     if b.Header.ChunkCount > 0 && len(b.CompressedChunkSizes) != int(b.Header.ChunkCount) {
-        return nil, fmt.Errorf("header chunk count %d does not match length of compressed chunk sizes array %d", b.Header.ChunkCount, len(b.CompressedChunkSizes))
+        return nil, fmt.Errorf("%w: header chunk count %d does not match length of compressed chunk sizes array %d", ErrCorrupt, b.Header.ChunkCount, len(b.CompressedChunkSizes))
     }
 
 	firstChunkDataOffset := int64(BundleHeaderSize + (b.Header.ChunkCount * 4))
@@ -158,7 +185,7 @@ func (b *Bundle) ReadFull() ([]byte, error) {
 	for i := int32(0); i < b.Header.ChunkCount; i++ {
 		compressedChunkSize := b.CompressedChunkSizes[i]
 		if compressedChunkSize < 0  {
-			return nil, fmt.Errorf("invalid negative compressed chunk size %d for chunk %d", compressedChunkSize, i)
+			return nil, b.chunkError(i, fmt.Errorf("%w: invalid negative compressed chunk size %d", ErrCorrupt, compressedChunkSize))
 		}
 
 		uncompressedChunkTargetSize := b.Header.ChunkSize
@@ -167,17 +194,17 @@ func (b *Bundle) ReadFull() ([]byte, error) {
 		}
 
 		if uncompressedChunkTargetSize < 0 {
-             return nil, fmt.Errorf("negative uncompressed target size %d for chunk %d", uncompressedChunkTargetSize, i)
+             return nil, b.chunkError(i, fmt.Errorf("%w: negative uncompressed target size %d", ErrCorrupt, uncompressedChunkTargetSize))
         }
         if uncompressedChunkTargetSize == 0 && compressedChunkSize != 0 {
-            return nil, fmt.Errorf("uncompressed target size is 0 but compressed chunk size is %d for chunk %d", compressedChunkSize, i)
+            return nil, b.chunkError(i, fmt.Errorf("%w: uncompressed target size is 0 but compressed chunk size is %d", ErrCorrupt, compressedChunkSize))
         }
         if uncompressedChunkTargetSize == 0 && compressedChunkSize == 0 {
             currentChunkDataFileOffset += int64(compressedChunkSize)
             continue
         }
         if compressedChunkSize == 0 && uncompressedChunkTargetSize != 0 {
-             return nil, fmt.Errorf("compressed chunk size is 0 but uncompressed target size is %d for chunk %d", uncompressedChunkTargetSize, i)
+             return nil, b.chunkError(i, fmt.Errorf("%w: compressed chunk size is 0 but uncompressed target size is %d", ErrCorrupt, uncompressedChunkTargetSize))
         }
 
 		if int32(cap(compressedChunkBuffer)) < compressedChunkSize {
@@ -186,34 +213,34 @@ func (b *Bundle) ReadFull() ([]byte, error) {
 			compressedChunkBuffer = compressedChunkBuffer[:compressedChunkSize]
 		}
 
-		if _, err := b.File.Seek(currentChunkDataFileOffset, io.SeekStart); err != nil {
-			return nil, fmt.Errorf("failed to seek to chunk %d data at offset %d: %w", i, currentChunkDataFileOffset, err)
+		if _, err := b.reader.Seek(currentChunkDataFileOffset, io.SeekStart); err != nil {
+			return nil, b.chunkError(i, fmt.Errorf("failed to seek to data at offset %d: %w", currentChunkDataFileOffset, err))
 		}
 
-		_, err := io.ReadFull(b.File, compressedChunkBuffer)
+		_, err := io.ReadFull(b.reader, compressedChunkBuffer)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read compressed chunk %d (size %d): %w", i, compressedChunkSize, err)
+			return nil, b.chunkError(i, fmt.Errorf("failed to read %d compressed bytes: %w", compressedChunkSize, err))
 		}
 
 		if outputBufferOffset+uncompressedChunkTargetSize > int32(len(decompressedData)) {
-			return nil, fmt.Errorf("output buffer too small for chunk %d: need %d, have %d remaining from total %d (output offset %d)",
-				i, uncompressedChunkTargetSize, int32(len(decompressedData))-outputBufferOffset, len(decompressedData), outputBufferOffset)
+			return nil, b.chunkError(i, fmt.Errorf("%w: output buffer too small: need %d, have %d remaining from total %d (output offset %d)", ErrCorrupt,
+				uncompressedChunkTargetSize, int32(len(decompressedData))-outputBufferOffset, len(decompressedData), outputBufferOffset))
 		}
 		uncompressedChunkSlice := decompressedData[outputBufferOffset : outputBufferOffset+uncompressedChunkTargetSize]
 
 		if OodleCompressor(b.Header.Compressor) == OodleCompressorNone {
 			if compressedChunkSize != uncompressedChunkTargetSize {
-				return nil, fmt.Errorf("mismatch in chunk size for OodleCompressorNone: expected %d, got %d for chunk %d", uncompressedChunkTargetSize, compressedChunkSize, i)
+				return nil, b.chunkError(i, fmt.Errorf("%w: mismatch in chunk size for OodleCompressorNone: expected %d, got %d", ErrCorrupt, uncompressedChunkTargetSize, compressedChunkSize))
 			}
 			copy(uncompressedChunkSlice, compressedChunkBuffer)
 		} else {
 			decompressedChunk, err := oodle.Decompress(compressedChunkBuffer, int64(uncompressedChunkTargetSize))
 			if err != nil {
-				return nil, fmt.Errorf("failed to decompress Oodle chunk %d (compressor %d, comp size %d, uncomp target %d): %w",
-					i, b.Header.Compressor, compressedChunkSize, uncompressedChunkTargetSize, err)
+				return nil, b.chunkError(i, fmt.Errorf("failed to decompress Oodle chunk (compressor %d, comp size %d, uncomp target %d): %w",
+					b.Header.Compressor, compressedChunkSize, uncompressedChunkTargetSize, err))
 			}
 			if len(decompressedChunk) != int(uncompressedChunkTargetSize) {
-				return nil, fmt.Errorf("Oodle decompression wrote %d bytes for chunk %d, expected %d", len(decompressedChunk), i, uncompressedChunkTargetSize)
+				return nil, b.chunkError(i, fmt.Errorf("%w: Oodle decompression wrote %d bytes, expected %d", ErrCorrupt, len(decompressedChunk), uncompressedChunkTargetSize))
 			}
 			copy(uncompressedChunkSlice, decompressedChunk)
 		}
@@ -226,6 +253,11 @@ func (b *Bundle) ReadFull() ([]byte, error) {
 	return b.cachedContent, nil
 }
 
+// chunkError returns a *ChunkError for chunk i of the bundle.
+func (b *Bundle) chunkError(i int32, err error) error {
+	return &ChunkError{Bundle: b.name, Chunk: int(i), Err: err}
+}
+
 // --- Index related structures and functions ---
 
 type Index struct {
@@ -242,6 +274,10 @@ type Index struct {
 	bundleStreamToWrite io.WriteSeeker
 	maxBundleSize       int32
 	customBundles       []*IndexBundleRecord
+
+	// Compressor of the bundles written by Replace, OodleCompressorLeviathan like the game by default
+	Compressor OodleCompressor
+	files      []*IndexFileRecord // In the order of the index, which Save keeps
 }
 
 type BundleFileFactory interface {
@@ -277,6 +313,7 @@ func (dbf *DriveBundleFactory) CreateBundle(bundlePath string) (*Bundle, error)
     }
     bundle := &Bundle{
         File:      f,
+        reader:    f,
         leaveOpen: false,
 		Header: BundleHeader{
 			HeadSize: 48,
@@ -313,7 +350,25 @@ func OpenIndex(indexPath string, factory BundleFileFactory) (*Index, error) {
 		return nil, fmt.Errorf("failed to open main index bundle %s: %w", indexPath, err)
 	}
 	defer mainIndexBundle.Close()
+	return openIndexFromBundle(mainIndexBundle, indexPath, factory)
+}
+
+// OpenIndexFromReader reads an index bundle from r, e.g. the _.index.bin stored inside a GGPK.
+// A factory is required since there is no directory to look for bundles in.
+func OpenIndexFromReader(r io.ReadSeeker, factory BundleFileFactory) (*Index, error) {
+	if factory == nil {
+		return nil, fmt.Errorf("a bundle factory is required to open an index from a reader")
+	}
+	mainIndexBundle, err := OpenBundle(r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open main index bundle: %w", err)
+	}
+	defer mainIndexBundle.Close()
+	return openIndexFromBundle(mainIndexBundle, "(reader)", factory)
+}
 
+// openIndexFromBundle parses the content of the main index bundle. indexPath is only used in errors.
+func openIndexFromBundle(mainIndexBundle *Bundle, indexPath string, factory BundleFileFactory) (*Index, error) {
 	indexData, err := mainIndexBundle.ReadFull()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read full content of main index bundle %s: %w", indexPath, err)
@@ -324,34 +379,35 @@ func OpenIndex(indexPath string, factory BundleFileFactory) (*Index, error) {
 		FilesByPathHash: make(map[uint64]*IndexFileRecord),
 		bundleFactory:   factory,
 		maxBundleSize:   200 * 1024 * 1024,
+		Compressor:      OodleCompressorLeviathan,
 	}
 
 	reader := bytes.NewReader(indexData)
 	var bundleCount int32
 	if err := binary.Read(reader, binary.LittleEndian, &bundleCount); err != nil {
-		return nil, fmt.Errorf("failed to read bundleCount: %w", err)
+		return nil, fmt.Errorf("%w: failed to read bundleCount: %w", ErrCorrupt, err)
 	}
 	if bundleCount < 0 {
-		return nil, fmt.Errorf("invalid bundleCount: %d", bundleCount)
+		return nil, fmt.Errorf("%w: invalid bundleCount: %d", ErrCorrupt, bundleCount)
 	}
 	idx.Bundles = make([]*IndexBundleRecord, bundleCount)
 
 	for i := int32(0); i < bundleCount; i++ {
 		var pathLength int32
 		if err := binary.Read(reader, binary.LittleEndian, &pathLength); err != nil {
-			return nil, fmt.Errorf("failed to read pathLength for bundle %d: %w", i, err)
+			return nil, fmt.Errorf("%w: failed to read pathLength for bundle %d: %w", ErrCorrupt, i, err)
 		}
 		if pathLength < 0 || pathLength > 1024 {
-			return nil, fmt.Errorf("invalid pathLength %d for bundle %d", pathLength, i)
+			return nil, fmt.Errorf("%w: invalid pathLength %d for bundle %d", ErrCorrupt, pathLength, i)
 		}
 		pathBytes := make([]byte, pathLength)
 		if _, err := io.ReadFull(reader, pathBytes); err != nil {
-			return nil, fmt.Errorf("failed to read path for bundle %d: %w", i, err)
+			return nil, fmt.Errorf("%w: failed to read path for bundle %d: %w", ErrCorrupt, i, err)
 		}
 		path := string(pathBytes)
 		var uncompressedSizeVal int32
 		if err := binary.Read(reader, binary.LittleEndian, &uncompressedSizeVal); err != nil {
-			return nil, fmt.Errorf("failed to read uncompressedSize for bundle %d (%s): %w", i, path, err)
+			return nil, fmt.Errorf("%w: failed to read uncompressedSize for bundle %d (%s): %w", ErrCorrupt, i, path, err)
 		}
 		idx.Bundles[i] = &IndexBundleRecord{
 			Path:             path,
@@ -367,30 +423,30 @@ func OpenIndex(indexPath string, factory BundleFileFactory) (*Index, error) {
 
 	var fileCount int32
 	if err := binary.Read(reader, binary.LittleEndian, &fileCount); err != nil {
-		return nil, fmt.Errorf("failed to read fileCount: %w", err)
+		return nil, fmt.Errorf("%w: failed to read fileCount: %w", ErrCorrupt, err)
 	}
 	if fileCount < 0 {
-		return nil, fmt.Errorf("invalid fileCount: %d", fileCount)
+		return nil, fmt.Errorf("%w: invalid fileCount: %d", ErrCorrupt, fileCount)
 	}
 
 	for i := int32(0); i < fileCount; i++ {
 		var pathHash uint64
 		if err := binary.Read(reader, binary.LittleEndian, &pathHash); err != nil {
-			return nil, fmt.Errorf("failed to read pathHash for file %d: %w", i, err)
+			return nil, fmt.Errorf("%w: failed to read pathHash for file %d: %w", ErrCorrupt, i, err)
 		}
 		var bundleIdxVal int32
 		if err := binary.Read(reader, binary.LittleEndian, &bundleIdxVal); err != nil {
-			return nil, fmt.Errorf("failed to read bundleIndex for file %d (hash %X): %w", i, pathHash, err)
+			return nil, fmt.Errorf("%w: failed to read bundleIndex for file %d (hash %X): %w", ErrCorrupt, i, pathHash, err)
 		}
 		if bundleIdxVal < 0 || bundleIdxVal >= bundleCount {
-			return nil, fmt.Errorf("invalid bundleIndex %d for file %d (hash %X)", bundleIdxVal, i, pathHash)
+			return nil, fmt.Errorf("%w: invalid bundleIndex %d for file %d (hash %X)", ErrCorrupt, bundleIdxVal, i, pathHash)
 		}
 		var offsetVal, sizeVal int32
 		if err := binary.Read(reader, binary.LittleEndian, &offsetVal); err != nil {
-			return nil, fmt.Errorf("failed to read offset for file %d (hash %X): %w", i, pathHash, err)
+			return nil, fmt.Errorf("%w: failed to read offset for file %d (hash %X): %w", ErrCorrupt, i, pathHash, err)
 		}
 		if err := binary.Read(reader, binary.LittleEndian, &sizeVal); err != nil {
-			return nil, fmt.Errorf("failed to read size for file %d (hash %X): %w", i, pathHash, err)
+			return nil, fmt.Errorf("%w: failed to read size for file %d (hash %X): %w", ErrCorrupt, i, pathHash, err)
 		}
 		fileRec := &IndexFileRecord{
 			PathHash:     pathHash,
@@ -399,20 +455,21 @@ func OpenIndex(indexPath string, factory BundleFileFactory) (*Index, error) {
 			Size:         sizeVal,
 		}
 		idx.FilesByPathHash[pathHash] = fileRec
+		idx.files = append(idx.files, fileRec)
 		idx.Bundles[bundleIdxVal].Files = append(idx.Bundles[bundleIdxVal].Files, fileRec)
 	}
 
 	var directoryCount int32
 	if err := binary.Read(reader, binary.LittleEndian, &directoryCount); err != nil {
-		return nil, fmt.Errorf("failed to read directoryCount: %w", err)
+		return nil, fmt.Errorf("%w: failed to read directoryCount: %w", ErrCorrupt, err)
 	}
 	if directoryCount < 0 {
-        return nil, fmt.Errorf("invalid directoryCount: %d", directoryCount)
+        return nil, fmt.Errorf("%w: invalid directoryCount: %d", ErrCorrupt, directoryCount)
     }
 	idx.Directories = make([]IndexDirectoryRecord, directoryCount)
 	for i := int32(0); i < directoryCount; i++ {
 		if err := binary.Read(reader, binary.LittleEndian, &idx.Directories[i]); err != nil {
-			return nil, fmt.Errorf("failed to read directory record %d: %w", i, err)
+			return nil, fmt.Errorf("%w: failed to read directory record %d: %w", ErrCorrupt, i, err)
 		}
 	}
 
@@ -421,7 +478,7 @@ func OpenIndex(indexPath string, factory BundleFileFactory) (*Index, error) {
 		currentPos = 0
 	}
 	if int(currentPos) > len(indexData) {
-		return nil, fmt.Errorf("read past end of index data while parsing directory records")
+		return nil, fmt.Errorf("%w: read past end of index data while parsing directory records", ErrCorrupt)
 	}
 	idx.DirectoryBundleData = indexData[currentPos:]
 	idx.RootNode = DirectoryNode{NameVal: "", PathVal: ""}
@@ -473,7 +530,7 @@ func (idx *Index) NameHash(path string) (uint64, error) {
 	case 0x07E47507B4A92E53:
 		return fnv1a64Hash(utf8Path), nil
 	default:
-		return 0, fmt.Errorf("unknown namehash algorithm (magic: %X)", idx.Directories[0].PathHash)
+		return 0, fmt.Errorf("%w: unknown namehash algorithm (magic: %X)", ErrUnsupportedVersion, idx.Directories[0].PathHash)
 	}
 }
 
@@ -529,7 +586,7 @@ func (idx *Index) GetFileByPath(path string) (*IndexFileRecord, error) {
 				return rec, nil
 			}
 		}
-		return nil, fmt.Errorf("file not found by path '%s' (hash %X not in map, and linear scan failed)", path, hash)
+		return nil, fmt.Errorf("file '%s' (hash %X): %w", path, hash, ErrNotFound)
 	}
 	if fileRec.Path == "" && path != "" {
 		fileRec.Path = path
@@ -0,0 +1,119 @@
+package bundle
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/user/ggpkgo/pkg/diff"
+)
+
+// DiffIndex compares two indexes by the path hashes of their files. Files of different sizes are
+// modified; the content of files with the same size is read from both sides and compared by
+// SHA-256. Paths are taken from ParsePaths if it was called, otherwise files are named by their
+// hash in hexadecimal. The changes are sorted by path.
+// If ctx is cancelled, the changes found so far are returned with the error.
+func DiffIndex(ctx context.Context, oldIndex, newIndex *Index) ([]diff.Change, error) {
+	var changes []diff.Change
+	var candidates []uint64 // Path hashes of the files whose content must be compared
+	for hash, oldRecord := range oldIndex.FilesByPathHash {
+		newRecord, ok := newIndex.FilesByPathHash[hash]
+		switch {
+		case !ok:
+			changes = append(changes, diff.Change{Path: diffPath(oldRecord), Kind: diff.Removed, OldSize: int64(oldRecord.Size)})
+		case oldRecord.Size != newRecord.Size:
+			changes = append(changes, diff.Change{Path: diffPath(newRecord), Kind: diff.Modified, OldSize: int64(oldRecord.Size), NewSize: int64(newRecord.Size)})
+		default:
+			candidates = append(candidates, hash)
+		}
+	}
+	for hash, newRecord := range newIndex.FilesByPathHash {
+		if _, ok := oldIndex.FilesByPathHash[hash]; !ok {
+			changes = append(changes, diff.Change{Path: diffPath(newRecord), Kind: diff.Added, NewSize: int64(newRecord.Size)})
+		}
+	}
+
+	oldHashes, err := hashContents(ctx, oldIndex, candidates, "old")
+	if err == nil {
+		var newHashes map[uint64][sha256.Size]byte
+		if newHashes, err = hashContents(ctx, newIndex, candidates, "new"); err == nil {
+			for _, hash := range candidates {
+				if oldHashes[hash] != newHashes[hash] {
+					oldRecord, newRecord := oldIndex.FilesByPathHash[hash], newIndex.FilesByPathHash[hash]
+					changes = append(changes, diff.Change{Path: diffPath(newRecord), Kind: diff.Modified, OldSize: int64(oldRecord.Size), NewSize: int64(newRecord.Size)})
+				}
+			}
+		}
+	}
+	diff.Sort(changes)
+	return changes, err
+}
+
+// hashContents returns the SHA-256 of the contents of the files of idx with the given path
+// hashes. The files are read in the order of their bundles so that each one is decompressed once.
+// side names the index in errors.
+func hashContents(ctx context.Context, idx *Index, pathHashes []uint64, side string) (map[uint64][sha256.Size]byte, error) {
+	records := make([]*IndexFileRecord, len(pathHashes))
+	for i, hash := range pathHashes {
+		records[i] = idx.FilesByPathHash[hash]
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.BundleRecord.BundleIndex != b.BundleRecord.BundleIndex {
+			return a.BundleRecord.BundleIndex < b.BundleRecord.BundleIndex
+		}
+		return a.Offset < b.Offset
+	})
+	h := &contentHasher{idx: idx}
+	defer h.close()
+	hashes := make(map[uint64][sha256.Size]byte, len(records))
+	for _, record := range records {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sum, err := h.hash(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s file %s: %w", side, diffPath(record), err)
+		}
+		hashes[record.PathHash] = sum
+	}
+	return hashes, nil
+}
+
+// diffPath returns the path of the file, or its hash if paths weren't parsed.
+func diffPath(record *IndexFileRecord) string {
+	if record.Path != "" {
+		return record.Path
+	}
+	return fmt.Sprintf("%016X", record.PathHash)
+}
+
+// contentHasher hashes file contents, keeping the last bundle open.
+type contentHasher struct {
+	idx    *Index
+	bundle *Bundle
+}
+
+func (h *contentHasher) hash(record *IndexFileRecord) ([sha256.Size]byte, error) {
+	if h.bundle == nil || h.bundle.Record != record.BundleRecord {
+		h.close()
+		b, err := h.idx.GetBundleForFileRecord(record)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		h.bundle = b
+	}
+	data, err := h.bundle.ReadAt(record.Offset, record.Size)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+func (h *contentHasher) close() {
+	if h.bundle != nil {
+		h.bundle.Close()
+		h.bundle = nil
+	}
+}
@@ -0,0 +1,90 @@
+package bundle_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/bundletest"
+	"github.com/user/ggpkgo/pkg/bundle"
+	"github.com/user/ggpkgo/pkg/diff"
+)
+
+func TestDiffIndex(t *testing.T) {
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	bundletest.WriteIndex(t, oldDir, map[string]map[string][]byte{
+		"Data": {"data/same.dat64": []byte("same"), "data/mods.dat64": []byte("mods"), "data/removed.dat64": []byte("gone")},
+		"Art":  {"art/a.dds": []byte("aaaa")},
+	})
+	// Files move between bundles and offsets, which isn't a change by itself
+	bundletest.WriteIndex(t, newDir, map[string]map[string][]byte{
+		"Data":  {"data/added.dat64": []byte("new"), "data/mods.dat64": []byte("MODS")},
+		"Other": {"data/same.dat64": []byte("same"), "art/a.dds": []byte("aaaaa")},
+	})
+	oldIndex, newIndex := openTestIndex(t, oldDir), openTestIndex(t, newDir)
+	for _, idx := range []*bundle.Index{oldIndex, newIndex} {
+		if _, err := idx.ParsePaths(); err != nil {
+			t.Fatalf("ParsePaths failed: %v", err)
+		}
+	}
+
+	changes, err := bundle.DiffIndex(context.Background(), oldIndex, newIndex)
+	if err != nil {
+		t.Fatalf("DiffIndex failed: %v", err)
+	}
+	want := []diff.Change{
+		{Path: "art/a.dds", Kind: diff.Modified, OldSize: 4, NewSize: 5},
+		{Path: "data/added.dat64", Kind: diff.Added, NewSize: 3},
+		{Path: "data/mods.dat64", Kind: diff.Modified, OldSize: 4, NewSize: 4},
+		{Path: "data/removed.dat64", Kind: diff.Removed, OldSize: 4},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Unexpected changes:\n%+v\nexpected:\n%+v", changes, want)
+	}
+}
+
+// countingFactory counts the bundles opened.
+type countingFactory struct {
+	*bundle.DriveBundleFactory
+	opened int
+}
+
+func (f *countingFactory) GetBundle(record *bundle.IndexBundleRecord) (*bundle.Bundle, error) {
+	f.opened++
+	return f.DriveBundleFactory.GetBundle(record)
+}
+
+func TestDiffIndex_OpensBundlesOnce(t *testing.T) {
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	// The files of each old bundle are split between the new bundles
+	bundletest.WriteIndex(t, oldDir, map[string]map[string][]byte{
+		"A": {"a/1.txt": []byte("1"), "b/1.txt": []byte("1")},
+		"B": {"a/2.txt": []byte("2"), "b/2.txt": []byte("2")},
+	})
+	bundletest.WriteIndex(t, newDir, map[string]map[string][]byte{
+		"A": {"a/1.txt": []byte("1"), "a/2.txt": []byte("2")},
+		"B": {"b/1.txt": []byte("1"), "b/2.txt": []byte("2")},
+	})
+	var indexes []*bundle.Index
+	var factories []*countingFactory
+	for _, dir := range []string{oldDir, newDir} {
+		f := &countingFactory{DriveBundleFactory: bundle.NewDriveBundleFactory(dir)}
+		idx, err := bundle.OpenIndex(filepath.Join(dir, "_.index.bin"), f)
+		if err != nil {
+			t.Fatalf("OpenIndex failed: %v", err)
+		}
+		indexes = append(indexes, idx)
+		factories = append(factories, f)
+	}
+
+	changes, err := bundle.DiffIndex(context.Background(), indexes[0], indexes[1])
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("DiffIndex returned %v, %v; expected no changes", changes, err)
+	}
+	for i, f := range factories {
+		if f.opened != 2 {
+			t.Errorf("Index %d: opened %d bundles, expected 2", i, f.opened)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors wrapped by the functions of this package, to be tested with errors.Is.
+var (
+	// ErrNotFound means that a path has no file in the index.
+	ErrNotFound = errors.New("not found")
+	// ErrCorrupt means that a bundle or the index holds invalid data.
+	ErrCorrupt = errors.New("corrupt bundle")
+	// ErrUnsupportedVersion means that the index uses a path hash algorithm this package doesn't know.
+	ErrUnsupportedVersion = errors.New("unsupported bundle version")
+)
+
+// ChunkError reports a chunk of a bundle that can't be read or decompressed.
+type ChunkError struct {
+	Bundle string // Path of the bundle, or "(reader)" for bundles opened from a reader without record
+	Chunk  int    // Index of the chunk in the bundle
+	Err    error  // Why the chunk can't be used; wraps ErrCorrupt if its size is invalid
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d of bundle %s: %v", e.Chunk, e.Bundle, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,48 @@
+package bundle_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/bundletest"
+	"github.com/user/ggpkgo/pkg/bundle"
+)
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	bundletest.WriteIndex(t, dir, map[string]map[string][]byte{"Bundle0": {"data/a.txt": []byte("aaa")}})
+	idx := openTestIndex(t, dir)
+	if _, err := idx.GetFileByPath("data/missing.txt"); !errors.Is(err, bundle.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing path, got %v", err)
+	}
+
+	data := bundletest.Bundle([]byte("some content"))
+	for _, tt := range []struct {
+		name    string
+		data    []byte
+		damage  func(b *bundle.Bundle)
+		corrupt bool
+		wrapped error
+	}{
+		{"Truncated", data[:len(data)-1], func(*bundle.Bundle) {}, false, io.ErrUnexpectedEOF},
+		{"ChunkSize", data, func(b *bundle.Bundle) { b.CompressedChunkSizes[0]-- }, true, bundle.ErrCorrupt},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := bundle.OpenBundle(bytes.NewReader(tt.data), &bundle.IndexBundleRecord{Path: "Bundle0"})
+			if err != nil {
+				t.Fatalf("OpenBundle failed: %v", err)
+			}
+			tt.damage(b)
+			_, err = b.ReadFull()
+			var chunkErr *bundle.ChunkError
+			if !errors.As(err, &chunkErr) || chunkErr.Bundle != "Bundle0" || chunkErr.Chunk != 0 {
+				t.Fatalf("Expected a ChunkError for chunk 0 of Bundle0, got %v", err)
+			}
+			if !errors.Is(err, tt.wrapped) || errors.Is(err, bundle.ErrCorrupt) != tt.corrupt {
+				t.Errorf("Unexpected error classification: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package bundle
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/user/ggpkgo/internal/zipfile"
+)
+
+// customBundlePrefix starts the paths of the bundles written by Replace, as with LibBundle3.
+const customBundlePrefix = "LibGGPK3/"
+
+// ReplaceStatus tells what Replace did, or would do in a dry run, with an entry.
+type ReplaceStatus string
+
+const (
+	StatusReplaced ReplaceStatus = "replaced"  // The file now points at the new content
+	StatusNotFound ReplaceStatus = "not-found" // The index has no file at the path; files can't be added
+	StatusRejected ReplaceStatus = "rejected"  // The entry is too large to be stored in a bundle
+)
+
+// ReplaceFunc is called by Replace for each entry with its path and the file record, which is
+// nil for StatusNotFound. Returning an error stops Replace, which returns that error.
+type ReplaceFunc func(path string, fr *IndexFileRecord, status ReplaceStatus) error
+
+// Replace writes the files of a zip archive over the files of the index with the same path,
+// resolved with GetFileByPath. The new contents are appended to the last custom bundle (or new
+// ones once a bundle would exceed the maximum bundle size), and the records of the files are
+// pointed at them; the original bundles are left untouched. The index is saved once at the end.
+// The bundle factory must implement BundleWriter.
+//
+// With dryRun set, nothing is read or written and fn is called with the status each entry
+// would get. Directory entries of the archive are ignored. fn may be nil.
+// It returns the number of files replaced.
+func (idx *Index) Replace(zr *zip.Reader, dryRun bool, fn ReplaceFunc) (int, error) {
+	w, ok := idx.bundleFactory.(BundleWriter)
+	if !ok && !dryRun {
+		return 0, fmt.Errorf("bundle factory %T does not support writing", idx.bundleFactory)
+	}
+	bw := &bundleBuilder{idx: idx, w: w}
+	count := 0
+	for _, entry := range zr.File {
+		if strings.HasSuffix(entry.Name, "/") {
+			continue
+		}
+		status := StatusReplaced
+		fr, err := idx.GetFileByPath(strings.TrimPrefix(entry.Name, "/"))
+		switch {
+		case errors.Is(err, ErrNotFound):
+			fr, status = nil, StatusNotFound
+		case err != nil:
+			return count, err
+		case entry.UncompressedSize64 > uint64(idx.maxBundleSize):
+			status = StatusRejected
+		case !dryRun:
+			data, err := zipfile.ReadEntry(entry)
+			if err != nil {
+				return count, err
+			}
+			if err := bw.add(fr, data); err != nil {
+				return count, err
+			}
+		}
+		if status == StatusReplaced {
+			count++
+		}
+		if fn != nil {
+			if err := fn(entry.Name, fr, status); err != nil {
+				return count, err
+			}
+		}
+	}
+	if dryRun || count == 0 {
+		return count, nil
+	}
+	if err := bw.flush(); err != nil {
+		return count, err
+	}
+	return count, idx.Save()
+}
+
+// bundleBuilder collects new file contents into a custom bundle.
+type bundleBuilder struct {
+	idx     *Index
+	w       BundleWriter
+	record  *IndexBundleRecord // Bundle being built, nil until the first file
+	content []byte
+	pending []pendingFile // Files to point at the bundle once it is written
+}
+
+type pendingFile struct {
+	fr           *IndexFileRecord
+	offset, size int32
+}
+
+// add appends the content of a file, writing the bundle first if it would grow too large.
+func (b *bundleBuilder) add(fr *IndexFileRecord, data []byte) error {
+	if b.record != nil && int64(len(b.content))+int64(len(data)) > int64(b.idx.maxBundleSize) {
+		if err := b.flush(); err != nil {
+			return err
+		}
+		b.record = nil
+	}
+	if b.record == nil {
+		if err := b.start(int64(len(data))); err != nil {
+			return err
+		}
+	}
+	b.pending = append(b.pending, pendingFile{fr: fr, offset: int32(len(b.content)), size: int32(len(data))})
+	b.content = append(b.content, data...)
+	return nil
+}
+
+// start continues the last custom bundle if it has room for size more bytes, or creates a new one.
+func (b *bundleBuilder) start(size int64) error {
+	custom := b.idx.customBundles
+	if n := len(custom); n > 0 && int64(custom[n-1].UncompressedSize)+size <= int64(b.idx.maxBundleSize) {
+		last := custom[n-1]
+		bundle, err := b.idx.bundleFactory.GetBundle(last)
+		if err != nil {
+			return fmt.Errorf("failed to open custom bundle %s: %w", last.Path, err)
+		}
+		content, err := bundle.ReadFull()
+		bundle.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read custom bundle %s: %w", last.Path, err)
+		}
+		b.record = last
+		b.content = append([]byte(nil), content...)
+		return nil
+	}
+	b.record = &IndexBundleRecord{
+		Path:        customBundlePrefix + strconv.Itoa(len(custom)),
+		BundleIndex: len(b.idx.Bundles),
+		ParentIndex: b.idx,
+	}
+	b.content = nil
+	b.idx.Bundles = append(b.idx.Bundles, b.record)
+	b.idx.customBundles = append(b.idx.customBundles, b.record)
+	return nil
+}
+
+// flush writes the bundle being built and points the pending files at it.
+func (b *bundleBuilder) flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	if len(b.content) > math.MaxInt32 {
+		return fmt.Errorf("custom bundle %s is too large: %d bytes", b.record.Path, len(b.content))
+	}
+	data, err := EncodeBundle(b.content, b.idx.Compressor)
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle %s: %w", b.record.Path, err)
+	}
+	if err := b.w.WriteBundle(b.record, data); err != nil {
+		return fmt.Errorf("failed to write bundle %s: %w", b.record.Path, err)
+	}
+	b.record.UncompressedSize = int32(len(b.content))
+	for _, p := range b.pending {
+		p.fr.BundleRecord.removeFile(p.fr)
+		p.fr.BundleRecord = b.record
+		p.fr.Offset = p.offset
+		p.fr.Size = p.size
+		b.record.Files = append(b.record.Files, p.fr)
+	}
+	b.pending = nil
+	return nil
+}
+
+// removeFile removes a file from the files of the bundle.
+func (r *IndexBundleRecord) removeFile(fr *IndexFileRecord) {
+	for i, f := range r.Files {
+		if f == fr {
+			r.Files = append(r.Files[:i], r.Files[i+1:]...)
+			return
+		}
+	}
+}
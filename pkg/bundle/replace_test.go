@@ -0,0 +1,85 @@
+package bundle_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/bundletest"
+	"github.com/user/ggpkgo/internal/ziptest"
+	"github.com/user/ggpkgo/pkg/bundle"
+)
+
+// replace runs Replace with uncompressed bundles and returns the status of each entry.
+func replace(t *testing.T, idx *bundle.Index, zr *zip.Reader, dryRun bool) map[string]bundle.ReplaceStatus {
+	t.Helper()
+	idx.Compressor = bundle.OodleCompressorNone
+	statuses := make(map[string]bundle.ReplaceStatus)
+	_, err := idx.Replace(zr, dryRun, func(p string, fr *bundle.IndexFileRecord, status bundle.ReplaceStatus) error {
+		statuses[p] = status
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	return statuses
+}
+
+func checkFiles(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	idx := openTestIndex(t, dir)
+	for p, content := range want {
+		fr, err := idx.GetFileByPath(p)
+		if err != nil {
+			t.Fatalf("GetFileByPath(%s) failed: %v", p, err)
+		}
+		data, err := idx.ReadFileData(fr)
+		if err != nil {
+			t.Fatalf("ReadFileData(%s) failed: %v", p, err)
+		}
+		if string(data) != content {
+			t.Errorf("Content of %s is %q, expected %q", p, data, content)
+		}
+	}
+}
+
+func TestIndexReplace(t *testing.T) {
+	dir := t.TempDir()
+	indexPath := bundletest.WriteIndex(t, dir, map[string]map[string][]byte{
+		"Data": {"data/a.dat64": []byte("aaaa"), "data/b.dat64": []byte("bbbb")},
+		"Art":  {"art/c.dds": []byte("cccc")},
+	})
+	zr := ziptest.Reader(t, "Data/A.dat64", "new a", "data/unknown.dat64", "x", "data/", "")
+
+	indexBefore, _ := os.ReadFile(indexPath)
+	statuses := replace(t, openTestIndex(t, dir), zr, true)
+	want := map[string]bundle.ReplaceStatus{"Data/A.dat64": bundle.StatusReplaced, "data/unknown.dat64": bundle.StatusNotFound}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Unexpected dry run statuses: %v", statuses)
+	}
+	if indexAfter, _ := os.ReadFile(indexPath); !bytes.Equal(indexBefore, indexAfter) {
+		t.Error("Dry run modified the index")
+	}
+
+	if statuses := replace(t, openTestIndex(t, dir), zr, false); !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+	checkFiles(t, dir, map[string]string{"data/a.dat64": "new a", "data/b.dat64": "bbbb", "art/c.dds": "cccc"})
+
+	// A second replacement goes to the same custom bundle
+	replace(t, openTestIndex(t, dir), ziptest.Reader(t, "art/c.dds", "new c"), false)
+	checkFiles(t, dir, map[string]string{"data/a.dat64": "new a", "data/b.dat64": "bbbb", "art/c.dds": "new c"})
+	idx := openTestIndex(t, dir)
+	if len(idx.Bundles) != 3 || idx.Bundles[2].Path != "LibGGPK3/0" || len(idx.Bundles[2].Files) != 2 {
+		t.Errorf("Expected the replaced files in one custom bundle, got %d bundles", len(idx.Bundles))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "LibGGPK3", "0.bundle.bin")); err != nil {
+		t.Errorf("Custom bundle not written: %v", err)
+	}
+	if report, err := idx.Verify(t.Context()); err != nil || !report.OK() {
+		t.Errorf("Verify after Replace failed: %v %+v", err, report)
+	}
+}
@@ -0,0 +1,177 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// VerifyIssueKind classifies a problem found by Index.Verify.
+type VerifyIssueKind string
+
+const (
+	// IssueMissing means the bundle file doesn't exist.
+	IssueMissing VerifyIssueKind = "missing"
+	// IssueUnreadable means the bundle file exists but couldn't be opened.
+	IssueUnreadable VerifyIssueKind = "unreadable"
+	// IssueTruncated means the bundle file is shorter than its header says.
+	IssueTruncated VerifyIssueKind = "truncated"
+	// IssueSizeMismatch means the bundle file is longer than its header says,
+	// or its chunk sizes don't add up to the compressed size in the header.
+	IssueSizeMismatch VerifyIssueKind = "size_mismatch"
+	// IssueHeader means the header fields are inconsistent with each other or with the index.
+	IssueHeader VerifyIssueKind = "header"
+	// IssueUndecodable means a chunk failed to decompress.
+	IssueUndecodable VerifyIssueKind = "undecodable"
+	// IssueFileOutOfRange means a file of the index points outside the content of its bundle.
+	IssueFileOutOfRange VerifyIssueKind = "file_out_of_range"
+)
+
+// VerifyIssue is a single problem found by Index.Verify.
+type VerifyIssue struct {
+	Bundle  string          `json:"bundle"`         // Path of the bundle as stored in the index
+	Kind    VerifyIssueKind `json:"kind"`           // Category of the problem
+	File    string          `json:"file,omitempty"` // Path (or hash if paths aren't parsed) of the affected file, if any
+	Message string          `json:"message"`
+}
+
+// VerifyReport is the result of Index.Verify.
+type VerifyReport struct {
+	BundlesChecked int           `json:"bundles_checked"`
+	FilesChecked   int           `json:"files_checked"`
+	Issues         []VerifyIssue `json:"issues"`
+}
+
+// OK reports whether no issue was found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// DamagedBundles returns the paths of bundles with at least one issue, in index order.
+func (r *VerifyReport) DamagedBundles() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, issue := range r.Issues {
+		if !seen[issue.Bundle] {
+			seen[issue.Bundle] = true
+			paths = append(paths, issue.Bundle)
+		}
+	}
+	return paths
+}
+
+// Verify checks every bundle of the index for damage: that it exists, that its header is
+// consistent (HeadSize against ChunkCount, the duplicated size fields, the chunk sizes against
+// the file size and the uncompressed size recorded in the index), that every chunk decompresses,
+// and that every file of the index lies within the content of its bundle.
+// Problems are collected in the report rather than returned as errors; the error is only
+// non-nil if ctx is cancelled, in which case the report covers the bundles checked so far.
+func (idx *Index) Verify(ctx context.Context) (*VerifyReport, error) {
+	report := &VerifyReport{Issues: []VerifyIssue{}}
+	if idx.bundleFactory == nil {
+		return nil, fmt.Errorf("bundle factory is not set in index")
+	}
+	for _, record := range idx.Bundles {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		idx.verifyBundle(record, report)
+		report.BundlesChecked++
+		report.FilesChecked += len(record.Files)
+	}
+	return report, nil
+}
+
+func (idx *Index) verifyBundle(record *IndexBundleRecord, report *VerifyReport) {
+	add := func(kind VerifyIssueKind, file string, format string, args ...any) {
+		report.Issues = append(report.Issues, VerifyIssue{Bundle: record.Path, Kind: kind, File: file, Message: fmt.Sprintf(format, args...)})
+	}
+
+	expectedSize := record.UncompressedSize
+	// Opening the bundle overwrites it with the possibly broken header value, even on failure
+	defer func() { record.UncompressedSize = expectedSize }()
+	b, err := idx.bundleFactory.GetBundle(record)
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			add(IssueMissing, "", "%v", err)
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			add(IssueTruncated, "", "%v", err)
+		default:
+			add(IssueUnreadable, "", "%v", err)
+		}
+		return
+	}
+	defer b.Close()
+
+	h := b.Header
+	headerOK := true
+	if h.HeadSize != 48+h.ChunkCount*4 {
+		add(IssueHeader, "", "head size is %d, expected %d for %d chunks", h.HeadSize, 48+h.ChunkCount*4, h.ChunkCount)
+		headerOK = false
+	}
+	if h.UncompressedSizeLong != int64(h.UncompressedSize) {
+		add(IssueHeader, "", "uncompressed sizes differ: %d and %d", h.UncompressedSize, h.UncompressedSizeLong)
+		headerOK = false
+	}
+	if h.CompressedSizeLong != int64(h.CompressedSize) {
+		add(IssueHeader, "", "compressed sizes differ: %d and %d", h.CompressedSize, h.CompressedSizeLong)
+		headerOK = false
+	}
+	if h.UncompressedSize != expectedSize {
+		add(IssueHeader, "", "uncompressed size is %d, but the index expects %d", h.UncompressedSize, expectedSize)
+		headerOK = false
+	}
+	if h.ChunkSize <= 0 {
+		add(IssueHeader, "", "invalid chunk size %d", h.ChunkSize)
+		headerOK = false
+	} else if want := (int64(h.UncompressedSize) + int64(h.ChunkSize) - 1) / int64(h.ChunkSize); int64(h.ChunkCount) != want {
+		add(IssueHeader, "", "chunk count is %d, expected %d for %d bytes in chunks of %d", h.ChunkCount, want, h.UncompressedSize, h.ChunkSize)
+		headerOK = false
+	}
+
+	var compressedSize int64
+	for i, s := range b.CompressedChunkSizes {
+		if s < 0 {
+			add(IssueHeader, "", "chunk %d has negative size %d", i, s)
+			headerOK = false
+		}
+		compressedSize += int64(s)
+	}
+	if compressedSize != int64(h.CompressedSize) {
+		add(IssueSizeMismatch, "", "chunk sizes add up to %d bytes, but the header says %d", compressedSize, h.CompressedSize)
+		headerOK = false
+	}
+
+	size, err := b.reader.Seek(0, io.SeekEnd) // Works for bundles in files and in readers
+	if err != nil {
+		add(IssueUnreadable, "", "failed to get file size: %v", err)
+		return
+	}
+	fileOK := true
+	if want := int64(BundleHeaderSize) + int64(h.ChunkCount)*4 + compressedSize; size < want {
+		add(IssueTruncated, "", "file is %d bytes, expected %d", size, want)
+		fileOK = false
+	} else if size > want {
+		add(IssueSizeMismatch, "", "file is %d bytes, expected %d", size, want)
+	}
+
+	// Decompressing only makes sense when the chunks can be located
+	if headerOK && fileOK {
+		if _, err := b.ReadFull(); err != nil {
+			add(IssueUndecodable, "", "%v", err)
+		}
+	}
+
+	for _, f := range record.Files {
+		if f.Offset < 0 || f.Size < 0 || int64(f.Offset)+int64(f.Size) > int64(expectedSize) {
+			name := f.Path
+			if name == "" {
+				name = fmt.Sprintf("%016X", f.PathHash)
+			}
+			add(IssueFileOutOfRange, name, "range %d+%d exceeds the %d bytes of the bundle", f.Offset, f.Size, expectedSize)
+		}
+	}
+}
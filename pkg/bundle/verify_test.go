@@ -0,0 +1,128 @@
+package bundle_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/bundletest"
+	"github.com/user/ggpkgo/pkg/bundle"
+)
+
+func openTestIndex(t *testing.T, dir string) *bundle.Index {
+	t.Helper()
+	idx, err := bundle.OpenIndex(filepath.Join(dir, "_.index.bin"), nil)
+	if err != nil {
+		t.Fatalf("OpenIndex failed: %v", err)
+	}
+	return idx
+}
+
+func issueKinds(report *bundle.VerifyReport) map[string]bundle.VerifyIssueKind {
+	kinds := make(map[string]bundle.VerifyIssueKind)
+	for _, issue := range report.Issues {
+		if _, ok := kinds[issue.Bundle]; !ok {
+			kinds[issue.Bundle] = issue.Kind
+		}
+	}
+	return kinds
+}
+
+func TestIndex_Verify(t *testing.T) {
+	dir := t.TempDir()
+	bundletest.WriteIndex(t, dir, map[string]map[string][]byte{
+		"Good":      {"data/a.txt": []byte("aaa"), "data/b.txt": []byte("bbbb")},
+		"Missing":   {"art/c.dds": []byte("ccc")},
+		"Truncated": {"art/d.dds": []byte("dddddddd")},
+		"Header":    {"art/e.dds": []byte("eeee")},
+		"Range":     {"art/f.dds": []byte("ffff")},
+	})
+
+	report, err := openTestIndex(t, dir).Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !report.OK() || report.BundlesChecked != 5 || report.FilesChecked != 6 {
+		t.Fatalf("Expected a clean report for 5 bundles and 6 files, got %+v", report)
+	}
+
+	// Damage the bundles
+	if err := os.Remove(filepath.Join(dir, "Missing.bundle.bin")); err != nil {
+		t.Fatal(err)
+	}
+	truncatedPath := filepath.Join(dir, "Truncated.bundle.bin")
+	data, _ := os.ReadFile(truncatedPath)
+	os.WriteFile(truncatedPath, data[:len(data)-3], 0o644)
+	headerPath := filepath.Join(dir, "Header.bundle.bin")
+	data, _ = os.ReadFile(headerPath)
+	data[8]++ // HeadSize
+	os.WriteFile(headerPath, data, 0o644)
+
+	idx := openTestIndex(t, dir)
+	if _, err := idx.ParsePaths(); err != nil {
+		t.Fatalf("ParsePaths failed: %v", err)
+	}
+	for _, b := range idx.Bundles {
+		if b.Path == "Range" {
+			b.Files[0].Size = 100
+		}
+	}
+	report, err = idx.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	want := map[string]bundle.VerifyIssueKind{
+		"Missing":   bundle.IssueMissing,
+		"Truncated": bundle.IssueTruncated,
+		"Header":    bundle.IssueHeader,
+		"Range":     bundle.IssueFileOutOfRange,
+	}
+	got := issueKinds(report)
+	if len(got) != len(want) {
+		t.Errorf("Expected issues for %d bundles, got %+v", len(want), report.Issues)
+	}
+	for bundlePath, kind := range want {
+		if got[bundlePath] != kind {
+			t.Errorf("Expected issue %q for bundle %s, got %q", kind, bundlePath, got[bundlePath])
+		}
+	}
+	for _, issue := range report.Issues {
+		if issue.Kind == bundle.IssueFileOutOfRange && issue.File != "art/f.dds" {
+			t.Errorf("Out of range issue does not name the file: %+v", issue)
+		}
+	}
+}
+
+func TestIndex_Verify_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	bundletest.WriteIndex(t, dir, map[string]map[string][]byte{"Good": {"a.txt": []byte("a")}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := openTestIndex(t, dir).Verify(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestIndex_Verify_KeepsRecord(t *testing.T) {
+	dir := t.TempDir()
+	bundletest.WriteIndex(t, dir, map[string]map[string][]byte{"Corrupt": {"a.txt": []byte("aaaa")}})
+	bundlePath := filepath.Join(dir, "Corrupt.bundle.bin")
+	data, _ := os.ReadFile(bundlePath)
+	data[0] += 10                                   // UncompressedSize
+	copy(data[36:], []byte{0xff, 0xff, 0xff, 0xff}) // Negative ChunkCount
+	os.WriteFile(bundlePath, data, 0o644)
+
+	idx := openTestIndex(t, dir)
+	want := idx.Bundles[0].UncompressedSize
+	report, err := idx.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if got := issueKinds(report)["Corrupt"]; got != bundle.IssueUnreadable {
+		t.Errorf("Expected issue %q, got %+v", bundle.IssueUnreadable, report.Issues)
+	}
+	if got := idx.Bundles[0].UncompressedSize; got != want {
+		t.Errorf("Verify changed the uncompressed size of the record from %d to %d", want, got)
+	}
+}
@@ -0,0 +1,70 @@
+package bundle
+
+import (
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// SkipDir can be returned by a WalkFunc to skip the children of a directory, or the remaining
+// children of the directory of a file.
+var SkipDir = fs.SkipDir
+
+// SkipAll can be returned by a WalkFunc to stop the walk, which then returns nil.
+var SkipAll = fs.SkipAll
+
+// WalkFunc is called by Walk for every node, with path being node.GetPath(), like
+// fs.WalkDirFunc. The tree built by Index.BuildTree is in memory, so err is always nil;
+// it is there to match ggpk.WalkFunc.
+type WalkFunc func(path string, node TreeNode, err error) error
+
+// Walk calls fn for root and everything below it, directories before their children and
+// children in name order. Any error other than SkipDir and SkipAll returned by fn stops the
+// walk and is returned.
+func Walk(root *DirectoryNode, fn WalkFunc) error {
+	return walkTree(root, fn, false)
+}
+
+// WalkPostOrder is like Walk, but calls fn for directories after their children.
+// SkipDir returned for a directory then only ends the walk of its parent like for a file.
+func WalkPostOrder(root *DirectoryNode, fn WalkFunc) error {
+	return walkTree(root, fn, true)
+}
+
+func walkTree(root *DirectoryNode, fn WalkFunc, post bool) error {
+	err := walkNode(root, fn, post)
+	if err == SkipDir || err == SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkNode(node TreeNode, fn WalkFunc, post bool) error {
+	dn, ok := node.(*DirectoryNode)
+	if !ok {
+		return fn(node.GetPath(), node, nil)
+	}
+	if !post {
+		if err := fn(dn.GetPath(), dn, nil); err != nil {
+			if err == SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+	children := slices.SortedFunc(slices.Values(dn.ChildrenVal), func(a, b TreeNode) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+	for _, child := range children {
+		if err := walkNode(child, fn, post); err != nil {
+			if err == SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	if post {
+		return fn(dn.GetPath(), dn, nil)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package bundle_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/user/ggpkgo/pkg/bundle"
+)
+
+// walkFixture builds the tree root/{b.txt, data/{y.dat, x.dat}, art/a.dds}.
+func walkFixture() *bundle.DirectoryNode {
+	root := &bundle.DirectoryNode{}
+	data := &bundle.DirectoryNode{NameVal: "data", PathVal: "data", ParentVal: root}
+	art := &bundle.DirectoryNode{NameVal: "art", PathVal: "art", ParentVal: root}
+	root.AddChild(&bundle.FileNode{NameVal: "b.txt", ParentVal: root})
+	root.AddChild(data)
+	root.AddChild(art)
+	data.AddChild(&bundle.FileNode{NameVal: "y.dat", ParentVal: data})
+	data.AddChild(&bundle.FileNode{NameVal: "x.dat", ParentVal: data})
+	art.AddChild(&bundle.FileNode{NameVal: "a.dds", ParentVal: art})
+	return root
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		name string
+		post bool
+		stop map[string]error
+		want []string
+	}{
+		{name: "pre-order", want: []string{"", "art", "art/a.dds", "b.txt", "data", "data/x.dat", "data/y.dat"}},
+		{name: "post-order", post: true, want: []string{"art/a.dds", "art", "b.txt", "data/x.dat", "data/y.dat", "data", ""}},
+		{
+			name: "SkipDir",
+			stop: map[string]error{"art": bundle.SkipDir, "data/x.dat": bundle.SkipDir},
+			want: []string{"", "art", "b.txt", "data", "data/x.dat"},
+		},
+		{
+			name: "SkipAll",
+			stop: map[string]error{"b.txt": bundle.SkipAll},
+			want: []string{"", "art", "art/a.dds", "b.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			walk := bundle.Walk
+			if tt.post {
+				walk = bundle.WalkPostOrder
+			}
+			err := walk(walkFixture(), func(p string, node bundle.TreeNode, err error) error {
+				got = append(got, p)
+				return tt.stop[p]
+			})
+			if err != nil {
+				t.Fatalf("Walk failed: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
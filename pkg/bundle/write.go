@@ -0,0 +1,140 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/new-world-tools/go-oodle"
+)
+
+// ChunkSize is the uncompressed size of the chunks of written bundles.
+const ChunkSize = 262144
+
+// BundleWriter is implemented by bundle factories that can store the bundles and the index
+// written by Index.Replace and Index.Save.
+type BundleWriter interface {
+	// WriteBundle stores the encoded bytes of the bundle, creating it if it doesn't exist.
+	WriteBundle(record *IndexBundleRecord, data []byte) error
+	// WriteIndex stores the encoded bytes of the index bundle.
+	WriteIndex(data []byte) error
+}
+
+// WriteBundle writes the bundle file, replacing it atomically if it exists.
+func (dbf *DriveBundleFactory) WriteBundle(record *IndexBundleRecord, data []byte) error {
+	return writeFileAtomic(filepath.Join(dbf.basePath, filepath.FromSlash(record.Path)+".bundle.bin"), data)
+}
+
+// WriteIndex writes the _.index.bin of the directory, replacing it atomically.
+func (dbf *DriveBundleFactory) WriteIndex(data []byte) error {
+	return writeFileAtomic(filepath.Join(dbf.basePath, "_.index.bin"), data)
+}
+
+// writeFileAtomic writes to a temporary file next to the destination and renames it,
+// so that a failed write never leaves a truncated bundle or index behind.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(f.Name()) // Fails harmlessly after the rename
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// EncodeBundle returns the bytes of a bundle holding data, split into chunks of ChunkSize
+// that are compressed with the given compressor. OodleCompressorNone stores them as they are,
+// which doesn't need the Oodle library.
+func EncodeBundle(data []byte, compressor OodleCompressor) ([]byte, error) {
+	chunkCount := (len(data) + ChunkSize - 1) / ChunkSize
+	chunks := make([][]byte, chunkCount)
+	compressedSize := 0
+	for i := range chunks {
+		chunk := data[i*ChunkSize : min((i+1)*ChunkSize, len(data))]
+		if compressor != OodleCompressorNone {
+			compressed, err := oodle.Compress(chunk, int(compressor), oodle.CompressionLevelNormal)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compress chunk %d: %w", i, err)
+			}
+			chunk = compressed
+		}
+		chunks[i] = chunk
+		compressedSize += len(chunk)
+	}
+
+	header := BundleHeader{
+		UncompressedSize:     int32(len(data)),
+		CompressedSize:       int32(compressedSize),
+		HeadSize:             int32(48 + chunkCount*4),
+		Compressor:           int32(compressor),
+		Unknown1:             1,
+		UncompressedSizeLong: int64(len(data)),
+		CompressedSizeLong:   int64(compressedSize),
+		ChunkCount:           int32(chunkCount),
+		ChunkSize:            ChunkSize,
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, BundleHeaderSize+chunkCount*4+compressedSize))
+	if err := binary.Write(buf, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to serialize bundle header: %w", err)
+	}
+	for _, chunk := range chunks {
+		binary.Write(buf, binary.LittleEndian, int32(len(chunk)))
+	}
+	for _, chunk := range chunks {
+		buf.Write(chunk)
+	}
+	return buf.Bytes(), nil
+}
+
+// encode serializes the records of the index, the content of its bundle.
+func (idx *Index) encode() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, int32(len(idx.Bundles)))
+	for _, b := range idx.Bundles {
+		binary.Write(&buf, binary.LittleEndian, int32(len(b.Path)))
+		buf.WriteString(b.Path)
+		binary.Write(&buf, binary.LittleEndian, b.UncompressedSize)
+	}
+	binary.Write(&buf, binary.LittleEndian, int32(len(idx.files)))
+	for _, f := range idx.files {
+		binary.Write(&buf, binary.LittleEndian, f.PathHash)
+		binary.Write(&buf, binary.LittleEndian, int32(f.BundleRecord.BundleIndex))
+		binary.Write(&buf, binary.LittleEndian, f.Offset)
+		binary.Write(&buf, binary.LittleEndian, f.Size)
+	}
+	binary.Write(&buf, binary.LittleEndian, int32(len(idx.Directories)))
+	binary.Write(&buf, binary.LittleEndian, idx.Directories)
+	buf.Write(idx.DirectoryBundleData)
+	return buf.Bytes()
+}
+
+// Save writes the index through its bundle factory, which must implement BundleWriter.
+// The index bundle is compressed with Compressor.
+func (idx *Index) Save() error {
+	w, ok := idx.bundleFactory.(BundleWriter)
+	if !ok {
+		return fmt.Errorf("bundle factory %T does not support writing", idx.bundleFactory)
+	}
+	data, err := EncodeBundle(idx.encode(), idx.Compressor)
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	if err := w.WriteIndex(data); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
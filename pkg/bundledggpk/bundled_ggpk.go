@@ -47,7 +47,7 @@ func OpenBundledGGPK(idx *bundle.Index, pathInBundle string) (*ggpk.GGPKFile, er
 	}
 
 	if ggpkFileRecord == nil {
-		return nil, fmt.Errorf("GGPK file '%s' not found in bundle index", pathInBundle)
+		return nil, fmt.Errorf("GGPK file '%s' in bundle index: %w", pathInBundle, bundle.ErrNotFound)
 	}
 
 	// 2. Extract the byte content of the GGPK file from its bundle.
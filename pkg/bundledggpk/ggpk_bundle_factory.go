@@ -0,0 +1,82 @@
+package bundledggpk
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/user/ggpkgo/pkg/bundle"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// BundlesDirectory is the directory of a GGPK holding the bundles and their index,
+// as in the Content.ggpk of the Standalone client.
+const BundlesDirectory = "Bundles2"
+
+// GGPKBundleFactory reads bundles stored in a directory of a GGPK file.
+// Bundles read from it must not be used after the GGPK is closed.
+// Creating and deleting bundles is not supported.
+type GGPKBundleFactory struct {
+	GGPK *ggpk.GGPKFile
+	Dir  string // Path of the directory in the GGPK, usually BundlesDirectory
+}
+
+// NewGGPKBundleFactory returns a factory reading bundles from the Bundles2 directory of gf.
+func NewGGPKBundleFactory(gf *ggpk.GGPKFile) *GGPKBundleFactory {
+	return &GGPKBundleFactory{GGPK: gf, Dir: BundlesDirectory}
+}
+
+// GetBundle opens the bundle of record from the GGPK without copying its data.
+func (gbf *GGPKBundleFactory) GetBundle(record *bundle.IndexBundleRecord) (*bundle.Bundle, error) {
+	p := gbf.Dir + "/" + record.Path + ".bundle.bin"
+	node, err := gbf.GGPK.GetNodeByPath(p)
+	if errors.Is(err, ggpk.ErrNotFound) {
+		return nil, fmt.Errorf("bundle %s not found in GGPK: %w: %w", p, fs.ErrNotExist, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up bundle %s in GGPK: %w", p, err)
+	}
+	fr, ok := node.(*ggpk.FileRecord)
+	if !ok {
+		return nil, fmt.Errorf("bundle %s in GGPK is a directory", p)
+	}
+	r, err := gbf.GGPK.DataReader(fr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle %s in GGPK: %w", p, err)
+	}
+	return bundle.OpenBundle(r, record)
+}
+
+// CreateBundle is not supported; bundles in a GGPK can only be read.
+func (gbf *GGPKBundleFactory) CreateBundle(bundlePath string) (*bundle.Bundle, error) {
+	return nil, fmt.Errorf("creating bundle %s in a GGPK is not supported", bundlePath)
+}
+
+// DeleteBundle is not supported; bundles in a GGPK can only be read.
+func (gbf *GGPKBundleFactory) DeleteBundle(bundlePath string) error {
+	return fmt.Errorf("deleting bundle %s from a GGPK is not supported", bundlePath)
+}
+
+// OpenGGPKIndex opens the Bundles2/_.index.bin stored in gf, with a GGPKBundleFactory
+// reading the bundles from the same GGPK.
+func OpenGGPKIndex(gf *ggpk.GGPKFile) (*bundle.Index, error) {
+	factory := NewGGPKBundleFactory(gf)
+	p := factory.Dir + "/_.index.bin"
+	node, err := gf.GetNodeByPath(p)
+	if err != nil {
+		return nil, fmt.Errorf("index %s not found in GGPK: %w", p, err)
+	}
+	fr, ok := node.(*ggpk.FileRecord)
+	if !ok {
+		return nil, fmt.Errorf("index %s in GGPK is a directory", p)
+	}
+	r, err := gf.DataReader(fr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index %s in GGPK: %w", p, err)
+	}
+	idx, err := bundle.OpenIndexFromReader(r, factory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index %s in GGPK: %w", p, err)
+	}
+	return idx, nil
+}
@@ -0,0 +1,95 @@
+package bundledggpk
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/bundletest"
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/bundle"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+func TestOpenGGPKIndex(t *testing.T) {
+	files := bundletest.Files(t, BundlesDirectory, map[string]map[string][]byte{
+		"Data/Bundle0": {"data/mods.dat64": []byte("mods")},
+		"Art/Bundle1":  {"art/a.dds": []byte("texture a"), "art/b.dds": []byte("texture b")},
+	})
+	gf, err := ggpk.Open(ggpktest.WriteFile(t, files))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+
+	idx, err := OpenGGPKIndex(gf)
+	if err != nil {
+		t.Fatalf("OpenGGPKIndex failed: %v", err)
+	}
+	rec, err := idx.GetFileByPath("art/b.dds")
+	if err != nil {
+		t.Fatalf("GetFileByPath failed: %v", err)
+	}
+	data, err := idx.ReadFileData(rec)
+	if err != nil {
+		t.Fatalf("ReadFileData failed: %v", err)
+	}
+	if string(data) != "texture b" {
+		t.Errorf("Unexpected content %q", data)
+	}
+
+	report, err := idx.Verify(context.Background())
+	if err != nil || !report.OK() {
+		t.Errorf("Expected a clean report, got %+v (%v)", report, err)
+	}
+
+	_, err = NewGGPKBundleFactory(gf).GetBundle(&bundle.IndexBundleRecord{Path: "Missing"})
+	if !errors.Is(err, fs.ErrNotExist) || !errors.Is(err, ggpk.ErrNotFound) {
+		t.Errorf("Expected fs.ErrNotExist for a missing bundle, got %v", err)
+	}
+}
+
+func TestGGPKBundleFactory_CorruptRecord(t *testing.T) {
+	path := ggpktest.WriteFile(t, bundletest.Files(t, BundlesDirectory, map[string]map[string][]byte{
+		"Bundle0": {"a.txt": []byte("a")},
+	}))
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	node, err := gf.GetNodeByPath(BundlesDirectory + "/Bundle0.bundle.bin")
+	if err != nil {
+		t.Fatalf("GetNodeByPath failed: %v", err)
+	}
+	offset := node.(*ggpk.FileRecord).Offset
+	gf.Close()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("JUNK"), offset+4) // Smash the tag of the bundle's FileRecord
+	f.Close()
+
+	gf, err = ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+	_, err = NewGGPKBundleFactory(gf).GetBundle(&bundle.IndexBundleRecord{Path: "Bundle0"})
+	if !errors.Is(err, ggpk.ErrCorrupt) || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected ErrCorrupt and not fs.ErrNotExist for a corrupt record, got %v", err)
+	}
+}
+
+func TestOpenGGPKIndex_NoBundles(t *testing.T) {
+	gf, err := ggpk.Open(ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("a")}))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+	if _, err := OpenGGPKIndex(gf); err == nil {
+		t.Error("Expected an error for a GGPK without Bundles2/_.index.bin")
+	}
+}
@@ -0,0 +1,174 @@
+package bundledggpk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/ggpkgo/pkg/bundle"
+)
+
+// ServerBundleFactory is a bundle.DriveBundleFactory that downloads bundles missing on the
+// drive from the patch CDN (see patch.GetPatchCdnURL) and caches them in the base directory.
+type ServerBundleFactory struct {
+	*bundle.DriveBundleFactory
+
+	// BaseDir is the path of "Bundles2" (parent of _.index.bin) on the drive.
+	BaseDir string
+	// CdnURL is the base URL of the patch CDN, under which "Bundles2/" is requested.
+	CdnURL string
+	// HTTPClient is used for downloads. nil means http.DefaultClient.
+	HTTPClient *http.Client
+	// Context cancels the downloads of GetBundle, which the bundle.BundleFileFactory interface
+	// gives no context. nil means context.Background().
+	Context context.Context
+}
+
+var _ bundle.BundleFileFactory = (*ServerBundleFactory)(nil)
+
+// NewServerBundleFactory creates a ServerBundleFactory caching bundles in baseDir.
+func NewServerBundleFactory(baseDir, cdnURL string) *ServerBundleFactory {
+	return &ServerBundleFactory{
+		DriveBundleFactory: bundle.NewDriveBundleFactory(baseDir),
+		BaseDir:            baseDir,
+		CdnURL:             cdnURL,
+	}
+}
+
+// GetBundle opens the bundle of the record from the drive, downloading it first if it doesn't exist.
+// A downloaded bundle is only kept if its header and size agree with the record.
+// Downloads are cancelled with sbf.Context.
+func (sbf *ServerBundleFactory) GetBundle(record *bundle.IndexBundleRecord) (*bundle.Bundle, error) {
+	ctx := sbf.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return sbf.GetBundleContext(ctx, record)
+}
+
+// GetBundleContext is GetBundle with a context cancelling the download.
+func (sbf *ServerBundleFactory) GetBundleContext(ctx context.Context, record *bundle.IndexBundleRecord) (*bundle.Bundle, error) {
+	bundlePath := record.Path + ".bundle.bin"
+	if err := checkLocal(bundlePath); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(sbf.BaseDir, filepath.FromSlash(bundlePath))); errors.Is(err, fs.ErrNotExist) {
+		expectedSize := record.UncompressedSize // OpenBundleFile overwrites it with the header value
+		err := sbf.download(ctx, bundlePath, func(tmpPath string) error {
+			return validateBundle(tmpPath, expectedSize)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sbf.DriveBundleFactory.GetBundle(record)
+}
+
+// DownloadIndex downloads "Bundles2/_.index.bin" and saves it to BaseDir, replacing any existing one.
+func (sbf *ServerBundleFactory) DownloadIndex(ctx context.Context) error {
+	return sbf.download(ctx, "_.index.bin", func(tmpPath string) error {
+		return validateBundle(tmpPath, -1)
+	})
+}
+
+// download fetches Bundles2/<relPath> into BaseDir. The data is written to a temporary file first
+// and only moved into place once validate accepts it, so a failed download never leaves a broken cache.
+func (sbf *ServerBundleFactory) download(ctx context.Context, relPath string, validate func(tmpPath string) error) error {
+	if err := checkLocal(relPath); err != nil {
+		return err
+	}
+	segments := strings.Split(relPath, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	u := strings.TrimSuffix(sbf.CdnURL, "/") + "/Bundles2/" + strings.Join(segments, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", u, err)
+	}
+	client := sbf.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download file (%s): %s", resp.Status, relPath)
+	}
+
+	fullPath := filepath.Join(sbf.BaseDir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", fullPath, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), filepath.Base(fullPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", fullPath, err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op after a successful rename
+
+	_, err = io.Copy(tmp, resp.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", relPath, err)
+	}
+	if err := validate(tmpPath); err != nil {
+		return fmt.Errorf("downloaded %s is invalid: %w", relPath, err)
+	}
+	if err := os.Rename(tmpPath, fullPath); err != nil {
+		return fmt.Errorf("failed to move downloaded %s into place: %w", relPath, err)
+	}
+	return nil
+}
+
+// checkLocal rejects a path from the index that would lead outside BaseDir, like one with ".."
+// components, since the index is downloaded from the CDN.
+func checkLocal(relPath string) error {
+	if !filepath.IsLocal(filepath.FromSlash(relPath)) {
+		return fmt.Errorf("invalid bundle path '%s': outside of the bundle directory", relPath)
+	}
+	return nil
+}
+
+// validateBundle checks that the file at path is a complete bundle whose uncompressed size is
+// expectedSize (skipped if negative). The bundle files carry no checksum, so the sizes in the
+// header are what a truncated or wrong download is detected by.
+func validateBundle(path string, expectedSize int32) error {
+	b, err := bundle.OpenBundleFile(path, nil, false)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	fi, err := b.File.Stat()
+	if err != nil {
+		return err
+	}
+	var compressedSize int64
+	for _, s := range b.CompressedChunkSizes {
+		compressedSize += int64(s)
+	}
+	if compressedSize != int64(b.Header.CompressedSize) {
+		return fmt.Errorf("chunk sizes add up to %d bytes, but the header says %d", compressedSize, b.Header.CompressedSize)
+	}
+	if want := int64(bundle.BundleHeaderSize) + int64(b.Header.ChunkCount)*4 + compressedSize; fi.Size() != want {
+		return fmt.Errorf("file is %d bytes, expected %d", fi.Size(), want)
+	}
+	if expectedSize >= 0 && b.Header.UncompressedSize != expectedSize {
+		return fmt.Errorf("uncompressed size is %d, but the index expects %d", b.Header.UncompressedSize, expectedSize)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package bundledggpk
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/user/ggpkgo/pkg/bundle"
+)
+
+// uncompressedBundle returns a single-chunk bundle stored with OodleCompressorNone.
+func uncompressedBundle(data []byte) []byte {
+	size := int32(len(data))
+	header := bundle.BundleHeader{
+		UncompressedSize:     size,
+		CompressedSize:       size,
+		HeadSize:             48 + 4,
+		Compressor:           int32(bundle.OodleCompressorNone),
+		Unknown1:             1,
+		UncompressedSizeLong: int64(size),
+		CompressedSizeLong:   int64(size),
+		ChunkCount:           1,
+		ChunkSize:            262144,
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &header)
+	binary.Write(&buf, binary.LittleEndian, size)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func newTestCDN(t *testing.T, files map[string][]byte) (*httptest.Server, *[]string) {
+	t.Helper()
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestServerBundleFactory_GetBundle(t *testing.T) {
+	content := []byte("bundle content")
+	srv, requests := newTestCDN(t, map[string][]byte{
+		"/4.0/Bundles2/Folder/My Bundle.bundle.bin": uncompressedBundle(content),
+	})
+	baseDir := t.TempDir()
+	factory := NewServerBundleFactory(baseDir, srv.URL+"/4.0/")
+	factory.HTTPClient = srv.Client()
+
+	record := &bundle.IndexBundleRecord{Path: "Folder/My Bundle", UncompressedSize: int32(len(content))}
+	for i := 0; i < 2; i++ {
+		b, err := factory.GetBundle(record)
+		if err != nil {
+			t.Fatalf("GetBundle failed: %v", err)
+		}
+		data, err := b.ReadFull()
+		b.Close()
+		if err != nil {
+			t.Fatalf("ReadFull failed: %v", err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Errorf("Bundle content is %q, expected %q", data, content)
+		}
+	}
+	if len(*requests) != 1 {
+		t.Errorf("Expected the bundle to be downloaded once and then cached, got requests %v", *requests)
+	}
+	if _, err := os.Stat(filepath.Join(baseDir, "Folder", "My Bundle.bundle.bin")); err != nil {
+		t.Errorf("Downloaded bundle was not cached: %v", err)
+	}
+}
+
+func TestServerBundleFactory_GetBundle_Invalid(t *testing.T) {
+	truncated := uncompressedBundle([]byte("bundle content"))
+	srv, _ := newTestCDN(t, map[string][]byte{
+		"/Bundles2/WrongSize.bundle.bin": uncompressedBundle([]byte("other content")),
+		"/Bundles2/Truncated.bundle.bin": truncated[:len(truncated)-1],
+	})
+	baseDir := t.TempDir()
+	factory := NewServerBundleFactory(baseDir, srv.URL)
+	factory.HTTPClient = srv.Client()
+
+	for _, name := range []string{"WrongSize", "Truncated", "Missing"} {
+		if _, err := factory.GetBundle(&bundle.IndexBundleRecord{Path: name, UncompressedSize: 14}); err == nil {
+			t.Errorf("Expected error for bundle %s, got nil", name)
+		}
+	}
+	if entries, _ := os.ReadDir(baseDir); len(entries) != 0 {
+		t.Errorf("Invalid downloads were left in the base directory: %v", entries)
+	}
+}
+
+func TestServerBundleFactory_GetBundle_Outside(t *testing.T) {
+	srv, requests := newTestCDN(t, map[string][]byte{
+		"/x.bundle.bin": uncompressedBundle([]byte("bundle content")),
+	})
+	parent := t.TempDir()
+	baseDir := filepath.Join(parent, "Bundles2")
+	factory := NewServerBundleFactory(baseDir, srv.URL)
+	factory.HTTPClient = srv.Client()
+
+	for _, p := range []string{"../x", "../../x", "/x", "a/../../x"} {
+		if _, err := factory.GetBundle(&bundle.IndexBundleRecord{Path: p, UncompressedSize: 14}); err == nil {
+			t.Errorf("Expected error for bundle path %s, got nil", p)
+		}
+	}
+	if len(*requests) != 0 {
+		t.Errorf("Expected no download, got requests %v", *requests)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "x.bundle.bin")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing written outside the base directory, got %v", err)
+	}
+}
+
+func TestServerBundleFactory_GetBundleContext(t *testing.T) {
+	srv, requests := newTestCDN(t, map[string][]byte{
+		"/Bundles2/B.bundle.bin": uncompressedBundle([]byte("bundle content")),
+	})
+	factory := NewServerBundleFactory(t.TempDir(), srv.URL)
+	factory.HTTPClient = srv.Client()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	factory.Context = ctx
+	if _, err := factory.GetBundle(&bundle.IndexBundleRecord{Path: "B", UncompressedSize: 14}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if len(*requests) != 0 {
+		t.Errorf("Expected no download, got requests %v", *requests)
+	}
+}
+
+func TestServerBundleFactory_DownloadIndex(t *testing.T) {
+	index := uncompressedBundle([]byte("index data"))
+	srv, _ := newTestCDN(t, map[string][]byte{"/Bundles2/_.index.bin": index})
+	baseDir := t.TempDir()
+	factory := NewServerBundleFactory(baseDir, srv.URL+"/")
+	factory.HTTPClient = srv.Client()
+
+	if err := factory.DownloadIndex(t.Context()); err != nil {
+		t.Fatalf("DownloadIndex failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(baseDir, "_.index.bin"))
+	if err != nil {
+		t.Fatalf("Index was not saved: %v", err)
+	}
+	if !bytes.Equal(data, index) {
+		t.Error("Saved index differs from the downloaded one")
+	}
+}
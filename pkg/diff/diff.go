@@ -0,0 +1,55 @@
+// Package diff holds the result type shared by the comparisons of GGPK files (ggpk.Diff)
+// and bundle indexes (bundle.DiffIndex).
+package diff
+
+import "sort"
+
+// Kind is the kind of a change.
+type Kind string
+
+const (
+	Added    Kind = "added"
+	Removed  Kind = "removed"
+	Modified Kind = "modified"
+)
+
+// Change is a file that differs between the old and the new version.
+type Change struct {
+	Path    string `json:"path"`
+	Kind    Kind   `json:"kind"`
+	OldSize int64  `json:"old_size"` // 0 for added files
+	NewSize int64  `json:"new_size"` // 0 for removed files
+}
+
+// Summary counts the changes of each kind.
+type Summary struct {
+	Added    int `json:"added"`
+	Removed  int `json:"removed"`
+	Modified int `json:"modified"`
+}
+
+// Summarize counts the changes of each kind.
+func Summarize(changes []Change) Summary {
+	var s Summary
+	for _, c := range changes {
+		switch c.Kind {
+		case Added:
+			s.Added++
+		case Removed:
+			s.Removed++
+		case Modified:
+			s.Modified++
+		}
+	}
+	return s
+}
+
+// Sort sorts changes by path, and removals before additions of the same path.
+func Sort(changes []Change) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Path != changes[j].Path {
+			return changes[i].Path < changes[j].Path
+		}
+		return changes[i].Kind == Removed && changes[j].Kind != Removed
+	})
+}
@@ -0,0 +1,103 @@
+package ggpk
+
+import "container/list"
+
+// CacheMode selects the records a GGPKFile keeps in memory once it has read them.
+type CacheMode int
+
+const (
+	// CacheAll keeps every record read and the children of every directory listed, so repeated
+	// lookups are free but a full walk keeps the whole tree in memory until Close or DropCache.
+	CacheAll CacheMode = iota
+	// CacheLRU keeps the Options.MaxCachedRecords most recently used records.
+	CacheLRU
+	// CacheDirectories keeps directory records only; file records are parsed again when needed.
+	CacheDirectories
+)
+
+// DefaultMaxCachedRecords is the limit of CacheLRU when Options.MaxCachedRecords is 0.
+const DefaultMaxCachedRecords = 10000
+
+func (m CacheMode) String() string {
+	switch m {
+	case CacheAll:
+		return "all"
+	case CacheLRU:
+		return "lru"
+	case CacheDirectories:
+		return "directories"
+	}
+	return "unknown"
+}
+
+// recordLRU tracks the order in which cached records were used under CacheLRU.
+type recordLRU struct {
+	order *list.List              // Offsets, most recently used first
+	elems map[int64]*list.Element // Elements of order by offset
+	max   int
+}
+
+func newRecordLRU(max int) *recordLRU {
+	return &recordLRU{order: list.New(), elems: make(map[int64]*list.Element), max: max}
+}
+
+// cachedRecord returns the cached record at offset, if any.
+func (gf *GGPKFile) cachedRecord(offset int64) (interface{}, bool) {
+	record, ok := gf.recordCache[offset]
+	if ok && gf.lru != nil {
+		if e := gf.lru.elems[offset]; e != nil {
+			gf.lru.order.MoveToFront(e)
+		}
+	}
+	return record, ok
+}
+
+// cacheRecord keeps a record just parsed at offset if the cache mode allows it,
+// evicting the least recently used records beyond the limit of CacheLRU.
+func (gf *GGPKFile) cacheRecord(offset int64, record interface{}) {
+	switch gf.options.Cache {
+	case CacheDirectories:
+		if _, ok := record.(*DirectoryRecord); !ok {
+			return
+		}
+	case CacheLRU:
+		if e := gf.lru.elems[offset]; e != nil {
+			gf.lru.order.MoveToFront(e)
+		} else {
+			gf.lru.elems[offset] = gf.lru.order.PushFront(offset)
+		}
+		for gf.lru.order.Len() > gf.lru.max {
+			oldest := gf.lru.order.Remove(gf.lru.order.Back()).(int64)
+			delete(gf.lru.elems, oldest)
+			delete(gf.recordCache, oldest)
+		}
+	}
+	gf.recordCache[offset] = record
+}
+
+// keepsChildren reports whether directories keep their children once listed.
+// Only CacheAll does; the other modes would keep the whole tree through them.
+func (gf *GGPKFile) keepsChildren() bool {
+	return gf.options.Cache == CacheAll
+}
+
+// DropCache forgets the records read so far, except the header and Root, so that their memory
+// can be reclaimed; they are parsed again when needed. Nodes obtained before stay usable.
+// It does nothing on a file opened with OpenReadWrite, whose nodes must stay unique while
+// they can be modified.
+func (gf *GGPKFile) DropCache() {
+	if gf.writable {
+		return
+	}
+	header := gf.recordCache[0]
+	gf.recordCache = make(map[int64]interface{})
+	gf.recordCache[0] = header
+	if gf.lru != nil {
+		gf.lru = newRecordLRU(gf.lru.max)
+	}
+	if gf.Root != nil {
+		gf.recordCache[gf.Root.Offset] = gf.Root
+		gf.Root.Children = nil
+		gf.Root.childRecordsDirty = true
+	}
+}
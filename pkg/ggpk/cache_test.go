@@ -0,0 +1,63 @@
+package ggpk_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+func TestOpenWithOptions_Cache(t *testing.T) {
+	files := make(map[string][]byte)
+	for i := range 20 {
+		files[fmt.Sprintf("Dir%d/file%d.txt", i%4, i)] = []byte(fmt.Sprintf("content %d", i))
+	}
+	path := ggpktest.WriteFile(t, files)
+
+	tests := []struct {
+		opts ggpk.Options
+		max  int // Records expected in the cache after reading every file
+	}{
+		{ggpk.Options{}, 1 + 1 + 4 + 20},                                 // Header, root, directories and files
+		{ggpk.Options{Cache: ggpk.CacheLRU, MaxCachedRecords: 3}, 1 + 3}, // The header is kept apart
+		{ggpk.Options{Cache: ggpk.CacheDirectories}, 1 + 1 + 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.opts.Cache.String(), func(t *testing.T) {
+			gf, err := ggpk.OpenWithOptions(path, tt.opts)
+			if err != nil {
+				t.Fatalf("OpenWithOptions failed: %v", err)
+			}
+			defer gf.Close()
+			// Twice, so that records evicted or not cached are parsed again
+			for range 2 {
+				for p, content := range files {
+					data, err := gf.ReadFileData(getFile(t, gf, p))
+					if err != nil {
+						t.Fatalf("ReadFileData(%s) failed: %v", p, err)
+					}
+					if !bytes.Equal(data, content) {
+						t.Errorf("Content of %s is %q, expected %q", p, data, content)
+					}
+				}
+			}
+			if n := ggpk.CachedRecords(gf); n != tt.max {
+				t.Errorf("Expected %d cached records, got %d", tt.max, n)
+			}
+
+			gf.DropCache()
+			if n := ggpk.CachedRecords(gf); n != 2 {
+				t.Errorf("Expected the header and root to stay cached, got %d records", n)
+			}
+			if data, err := gf.ReadFileData(getFile(t, gf, "Dir1/file5.txt")); err != nil || string(data) != "content 5" {
+				t.Errorf("Reading after DropCache returned %q, %v", data, err)
+			}
+		})
+	}
+
+	if _, err := ggpk.OpenWithOptions(path, ggpk.Options{Cache: ggpk.CacheLRU, MaxCachedRecords: -1}); err == nil {
+		t.Errorf("Expected an error for a negative MaxCachedRecords")
+	}
+}
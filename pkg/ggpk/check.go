@@ -0,0 +1,248 @@
+package ggpk
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// CheckIssueKind classifies a structural problem found by Check.
+type CheckIssueKind string
+
+const (
+	// IssueBadRecord means a record has an unknown tag, an invalid length or can't be parsed.
+	IssueBadRecord CheckIssueKind = "bad_record"
+	// IssueBadHeader means the GGPK header points at something that isn't the root directory or a FreeRecord.
+	IssueBadHeader CheckIssueKind = "bad_header"
+	// IssueBadEntry means a directory entry doesn't point at the start of a FILE or PDIR record,
+	// or points at a record that is already referenced elsewhere.
+	IssueBadEntry CheckIssueKind = "bad_entry"
+	// IssueEntryOrder means the entries of a directory aren't in strictly ascending NameHash order.
+	IssueEntryOrder CheckIssueKind = "entry_order"
+	// IssueOverlap means a reference points into the middle of another record.
+	IssueOverlap CheckIssueKind = "overlap"
+	// IssueFreeChain means the free list has a cycle or links something that isn't a FreeRecord.
+	IssueFreeChain CheckIssueKind = "free_chain"
+	// IssueOrphan means a record is neither reachable from Root nor in the free list.
+	IssueOrphan CheckIssueKind = "orphan"
+)
+
+// CheckIssue is a single problem found by Check.
+type CheckIssue struct {
+	Offset  int64          `json:"offset"`         // Offset of the affected record or reference
+	Kind    CheckIssueKind `json:"kind"`           // Category of the problem
+	Path    string         `json:"path,omitempty"` // Directory holding a bad entry, or the affected node
+	Message string         `json:"message"`
+}
+
+// CheckReport is the result of Check.
+type CheckReport struct {
+	RecordsScanned int          `json:"records_scanned"`
+	Files          int          `json:"files"`
+	Directories    int          `json:"directories"`
+	FreeRecords    int          `json:"free_records"`
+	Issues         []CheckIssue `json:"issues"`
+}
+
+// OK reports whether no issue was found.
+func (r *CheckReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Check validates the structure of the file: it scans every record linearly from offset 0,
+// validating its tag and length, then follows the tree from Root and the free list, checking
+// that every reference points at the start of a record of the right type, that directory entries
+// are sorted by NameHash, that the free list has no cycle and that every record is either
+// reachable from Root or free. File contents and hashes aren't checked.
+// Problems are collected in the report; the error is only non-nil if the file can't be read.
+func Check(gf *GGPKFile) (*CheckReport, error) {
+	c := &checker{gf: gf, report: &CheckReport{Issues: []CheckIssue{}}, records: make(map[int64]scannedRecord), reached: make(map[int64]bool)}
+	if err := c.scan(); err != nil {
+		return c.report, err
+	}
+	if c.refer(gf.Header.RootDirectoryOffset, IssueBadHeader, "", "root directory", PDirRecordTag) {
+		c.walk(gf.Root, "")
+	}
+	c.followFreeList()
+	for _, offset := range c.starts {
+		if r := c.records[offset]; offset != 0 && !c.reached[offset] {
+			c.add(offset, IssueOrphan, "", "%s record of %d bytes is neither reachable from the root nor in the free list", tagName(r.tag), r.length)
+		}
+	}
+	return c.report, nil
+}
+
+type scannedRecord struct {
+	tag    uint32
+	length int32
+}
+
+type checker struct {
+	gf      *GGPKFile
+	report  *CheckReport
+	records map[int64]scannedRecord // Records found by the linear scan, by offset
+	starts  []int64                 // Offsets of records, ascending
+	scanEnd int64                   // End of the last record the scan could read
+	reached map[int64]bool          // Records referenced by the tree or the free list
+}
+
+func (c *checker) add(offset int64, kind CheckIssueKind, path, format string, args ...any) {
+	c.report.Issues = append(c.report.Issues, CheckIssue{Offset: offset, Kind: kind, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// scan reads the header of every record from offset 0, stopping at the first invalid one
+// since the records after it can't be located.
+func (c *checker) scan() error {
+	offset := int64(0)
+	for offset < c.gf.fileSize {
+		if c.gf.fileSize-offset < RecordHeaderSize {
+			c.add(offset, IssueBadRecord, "", "%d trailing bytes are too short for a record", c.gf.fileSize-offset)
+			break
+		}
+		length, tag, err := c.gf.readRecordHeaderAndSeek(offset)
+		if err != nil {
+			return fmt.Errorf("failed to read record header at offset %d: %w", offset, err)
+		}
+		if msg := validateRecord(tag, length, offset, c.gf.fileSize); msg != "" {
+			c.add(offset, IssueBadRecord, "", "%s; records after it can't be scanned", msg)
+			break
+		}
+		c.records[offset] = scannedRecord{tag: tag, length: length}
+		c.starts = append(c.starts, offset)
+		offset += int64(length)
+	}
+	c.scanEnd = offset
+	c.report.RecordsScanned = len(c.starts)
+	return nil
+}
+
+// validateRecord returns why a record header is invalid, or "" if it is valid.
+func validateRecord(tag uint32, length int32, offset, fileSize int64) string {
+	minLength := int32(RecordHeaderSize)
+	switch tag {
+	case GGPKRecordTag:
+		minLength = RecordHeaderSize + 4 + 8 + 8
+	case FreeRecordTag:
+		minLength = minFreeRecordLength
+	case FileRecordTag:
+		minLength = RecordHeaderSize + 4 + HashSize
+	case PDirRecordTag:
+		minLength = RecordHeaderSize + 4 + 4 + HashSize
+	default:
+		return fmt.Sprintf("unknown record tag %X", tag)
+	}
+	if length < minLength {
+		return fmt.Sprintf("%s record length %d is shorter than the minimum of %d", tagName(tag), length, minLength)
+	}
+	if offset+int64(length) > fileSize {
+		return fmt.Sprintf("%s record of %d bytes exceeds the end of the file at %d", tagName(tag), length, fileSize)
+	}
+	return ""
+}
+
+// refer checks a reference to a record with one of the given tags and marks the record as
+// reached. It reports problems with the given kind and returns whether the record can be followed.
+func (c *checker) refer(offset int64, kind CheckIssueKind, path, what string, tags ...uint32) bool {
+	if offset < 0 || offset >= c.gf.fileSize {
+		c.add(offset, kind, path, "%s points outside the file at offset %d", what, offset)
+		return false
+	}
+	r, ok := c.records[offset]
+	if !ok && offset < c.scanEnd {
+		i := sort.Search(len(c.starts), func(i int) bool { return c.starts[i] > offset }) - 1
+		start := c.starts[i]
+		c.add(offset, IssueOverlap, path, "%s at offset %d points into the %s record at %d", what, offset, tagName(c.records[start].tag), start)
+		return false
+	}
+	if !ok {
+		// Beyond an invalid record, so not scanned
+		length, tag, err := c.gf.readRecordHeaderAndSeek(offset)
+		if err != nil {
+			c.add(offset, IssueBadRecord, path, "%s at offset %d can't be read: %v", what, offset, err)
+			return false
+		}
+		if msg := validateRecord(tag, length, offset, c.gf.fileSize); msg != "" {
+			c.add(offset, IssueBadRecord, path, "%s at offset %d: %s", what, offset, msg)
+			return false
+		}
+		r = scannedRecord{tag: tag, length: length}
+	}
+	if !slices.Contains(tags, r.tag) {
+		c.add(offset, kind, path, "%s at offset %d points at a %s record", what, offset, tagName(r.tag))
+		return false
+	}
+	if c.reached[offset] {
+		c.add(offset, kind, path, "%s at offset %d points at a record that is already referenced", what, offset)
+		return false
+	}
+	c.reached[offset] = true
+	return true
+}
+
+// walk checks the entries of a directory and the records below it.
+func (c *checker) walk(dr *DirectoryRecord, path string) {
+	c.report.Directories++
+	for i, e := range dr.Entries {
+		if i > 0 && e.NameHash <= dr.Entries[i-1].NameHash {
+			c.add(dr.Offset, IssueEntryOrder, path, "entry %d has NameHash %08X after %08X", i, e.NameHash, dr.Entries[i-1].NameHash)
+		}
+		if !c.refer(e.Offset, IssueBadEntry, path, fmt.Sprintf("entry %d", i), FileRecordTag, PDirRecordTag) {
+			continue
+		}
+		record, err := c.gf.ReadRecordAt(e.Offset)
+		if err != nil {
+			c.add(e.Offset, IssueBadRecord, path, "entry %d: %v", i, err)
+			continue
+		}
+		switch r := record.(type) {
+		case *FileRecord:
+			c.report.Files++
+		case *DirectoryRecord:
+			c.walk(r, joinPath(path, r.Name))
+		}
+	}
+}
+
+func joinPath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// followFreeList checks the linked list of FreeRecords from the header.
+func (c *checker) followFreeList() {
+	seen := make(map[int64]bool)
+	for offset := c.gf.Header.FirstFreeOffset; offset != 0; {
+		if seen[offset] {
+			c.add(offset, IssueFreeChain, "", "free list has a cycle at offset %d", offset)
+			return
+		}
+		seen[offset] = true
+		if !c.refer(offset, IssueFreeChain, "", "free list element", FreeRecordTag) {
+			return
+		}
+		record, err := c.gf.ReadRecordAt(offset)
+		if err != nil {
+			c.add(offset, IssueBadRecord, "", "free list element: %v", err)
+			return
+		}
+		c.report.FreeRecords++
+		offset = record.(*FreeRecord).NextFreeOffset
+	}
+}
+
+// tagName returns the four characters of a record tag.
+func tagName(tag uint32) string {
+	switch tag {
+	case GGPKRecordTag:
+		return "GGPK"
+	case FreeRecordTag:
+		return "FREE"
+	case FileRecordTag:
+		return "FILE"
+	case PDirRecordTag:
+		return "PDIR"
+	}
+	return fmt.Sprintf("%08X", tag)
+}
@@ -0,0 +1,163 @@
+package ggpk_test
+
+import (
+	"encoding/binary"
+	"maps"
+	"os"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// patchFile overwrites bytes of the file at path.
+func patchFile(t *testing.T, path string, offset int64, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(data, offset); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+}
+
+func int64Bytes(v int64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, uint64(v))
+}
+
+// checkFixture builds a GGPK with a FreeRecord and returns its path, the offset of the
+// FreeRecord and the offset of the entries of Art.
+func checkFixture(t *testing.T) (path string, freeOffset, entriesOffset int64) {
+	t.Helper()
+	path = ggpktest.WriteFile(t, map[string][]byte{
+		"Art/a.txt": []byte("short"),
+		"Art/b.txt": []byte("other file"),
+		"Art/c.txt": []byte("last file"),
+	})
+	gf := openReadWrite(t, path)
+	freeOffset = getFile(t, gf, "Art/a.txt").Offset
+	if err := gf.WriteFileData(getFile(t, gf, "Art/a.txt"), []byte("content that no longer fits")); err != nil {
+		t.Fatalf("WriteFileData failed: %v", err)
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+	art := getDir(t, gf, "Art")
+	entriesOffset = art.Offset + int64(art.Length) - int64(len(art.Entries))*12
+	return path, freeOffset, entriesOffset
+}
+
+func runCheck(t *testing.T, path string) *ggpk.CheckReport {
+	t.Helper()
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+	report, err := ggpk.Check(gf)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	return report
+}
+
+func issueKinds(r *ggpk.CheckReport) map[ggpk.CheckIssueKind]int {
+	kinds := make(map[ggpk.CheckIssueKind]int)
+	for _, issue := range r.Issues {
+		kinds[issue.Kind]++
+	}
+	return kinds
+}
+
+func TestCheck(t *testing.T) {
+	path, _, _ := checkFixture(t)
+	report := runCheck(t, path)
+	if !report.OK() {
+		t.Fatalf("Expected no issues, got %+v", report.Issues)
+	}
+	// GGPK, root, Art, three files and the FreeRecord
+	if report.RecordsScanned != 7 || report.Files != 3 || report.Directories != 2 || report.FreeRecords != 1 {
+		t.Errorf("Unexpected counts: %+v", report)
+	}
+}
+
+func TestCheck_Broken(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch func(t *testing.T, path string, freeOffset, entriesOffset int64)
+		want  map[ggpk.CheckIssueKind]int
+	}{
+		{
+			name: "orphan",
+			patch: func(t *testing.T, path string, freeOffset, _ int64) {
+				patchFile(t, path, 20, int64Bytes(0)) // Drop the free list
+			},
+			want: map[ggpk.CheckIssueKind]int{ggpk.IssueOrphan: 1},
+		},
+		{
+			name: "free list cycle",
+			patch: func(t *testing.T, path string, freeOffset, _ int64) {
+				patchFile(t, path, freeOffset+8, int64Bytes(freeOffset))
+			},
+			want: map[ggpk.CheckIssueKind]int{ggpk.IssueFreeChain: 1},
+		},
+		{
+			name: "entry order",
+			patch: func(t *testing.T, path string, _, entriesOffset int64) {
+				gf, _ := ggpk.Open(path)
+				art := getDir(t, gf, "Art")
+				first, second := art.Entries[0], art.Entries[1]
+				gf.Close()
+				b := binary.LittleEndian.AppendUint32(nil, second.NameHash)
+				b = binary.LittleEndian.AppendUint64(b, uint64(second.Offset))
+				b = binary.LittleEndian.AppendUint32(b, first.NameHash)
+				b = binary.LittleEndian.AppendUint64(b, uint64(first.Offset))
+				patchFile(t, path, entriesOffset, b)
+			},
+			want: map[ggpk.CheckIssueKind]int{ggpk.IssueEntryOrder: 1},
+		},
+		{
+			name: "overlap",
+			patch: func(t *testing.T, path string, _, entriesOffset int64) {
+				gf, _ := ggpk.Open(path)
+				offset := getDir(t, gf, "Art").Entries[0].Offset
+				gf.Close()
+				patchFile(t, path, entriesOffset+4, int64Bytes(offset+4))
+			},
+			// The file the entry pointed at is orphaned
+			want: map[ggpk.CheckIssueKind]int{ggpk.IssueOverlap: 1, ggpk.IssueOrphan: 1},
+		},
+		{
+			name: "entry pointing at free space",
+			patch: func(t *testing.T, path string, freeOffset, entriesOffset int64) {
+				patchFile(t, path, entriesOffset+4, int64Bytes(freeOffset))
+			},
+			want: map[ggpk.CheckIssueKind]int{ggpk.IssueBadEntry: 1, ggpk.IssueOrphan: 1},
+		},
+		{
+			name: "bad record",
+			patch: func(t *testing.T, path string, freeOffset, _ int64) {
+				patchFile(t, path, freeOffset+4, []byte("JUNK"))
+			},
+			// The scan stops there, and the free list points at the broken record
+			want: map[ggpk.CheckIssueKind]int{ggpk.IssueBadRecord: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, freeOffset, entriesOffset := checkFixture(t)
+			tt.patch(t, path, freeOffset, entriesOffset)
+			report := runCheck(t, path)
+			if kinds := issueKinds(report); !maps.Equal(kinds, tt.want) {
+				t.Errorf("Expected issues %v, got %+v", tt.want, report.Issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package ggpk
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+// DecompressionMode selects how data stored with an LZ4 size prefix is decoded:
+// the uncompressed size as a little-endian uint32, followed by an LZ4 block.
+type DecompressionMode int
+
+const (
+	// DecompressByExtension decodes files whose extension is in Options.LZ4Extensions like
+	// DecompressAlways, and returns the stored data of the others. It is the default.
+	DecompressByExtension DecompressionMode = iota
+	// DecompressNever returns the stored data, byte for byte.
+	DecompressNever
+	// DecompressAuto decompresses data whose prefix is a plausible size and whose block decodes
+	// to exactly that size, and returns the stored data otherwise. This is a guess, which
+	// uncompressed data that happens to decode defeats, so it is only used when asked for.
+	DecompressAuto
+	// DecompressAlways requires data with an LZ4 size prefix and fails on anything else.
+	// Data whose prefix is its own size is returned without the prefix, as stored uncompressed.
+	DecompressAlways
+)
+
+// DefaultLZ4Extensions are the extensions of the files stored with an LZ4 size prefix,
+// used by DecompressByExtension when Options.LZ4Extensions is nil.
+var DefaultLZ4Extensions = []string{".dds"}
+
+func (m DecompressionMode) String() string {
+	switch m {
+	case DecompressAuto:
+		return "auto"
+	case DecompressNever:
+		return "never"
+	case DecompressAlways:
+		return "always"
+	case DecompressByExtension:
+		return "extension"
+	}
+	return "unknown"
+}
+
+func (m DecompressionMode) valid() bool {
+	return m >= DecompressByExtension && m <= DecompressAlways
+}
+
+// DecodeReport tells how ReadDecodedData decoded the data of a file.
+type DecodeReport struct {
+	Mode         DecompressionMode `json:"mode"`         // The mode asked for
+	Decompressed bool              `json:"decompressed"` // Whether the data was LZ4-decompressed
+	StoredSize   int64             `json:"stored_size"`
+	Size         int64             `json:"size"`   // Size of the returned data
+	Reason       string            `json:"reason"` // Why the data was decompressed or not
+}
+
+// ReadDecodedData reads the data of a FileRecord, decoding it as selected by mode,
+// and reports what was done. Under DecompressNever it returns what ReadRawData returns.
+// Data that must be decompressed but isn't valid LZ4 with a size prefix fails with an error
+// wrapping ErrCorrupt; data that would decompress beyond Options.MaxFileSize fails too.
+func (gf *GGPKFile) ReadDecodedData(fileRecord *FileRecord, mode DecompressionMode) ([]byte, *DecodeReport, error) {
+	if !mode.valid() {
+		return nil, nil, fmt.Errorf("unknown decompression mode %d", mode)
+	}
+	rawData, err := gf.DataView(fileRecord)
+	if err != nil {
+		return nil, nil, err
+	}
+	report := &DecodeReport{Mode: mode, StoredSize: int64(len(rawData))}
+	data, err := gf.decompress(fileRecord, rawData, mode, report)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !report.Decompressed && gf.Mapped() {
+		data = bytes.Clone(data) // The caller owns the result, unlike a view of the mapping
+	}
+	report.Size = int64(len(data))
+	return data, report, nil
+}
+
+// hasLZ4Extension reports whether the name of fileRecord has one of Options.LZ4Extensions,
+// or DefaultLZ4Extensions if nil.
+func (gf *GGPKFile) hasLZ4Extension(fileRecord *FileRecord) bool {
+	exts := gf.options.LZ4Extensions
+	if exts == nil {
+		exts = DefaultLZ4Extensions
+	}
+	ext := path.Ext(fileRecord.Name)
+	return ext != "" && slices.ContainsFunc(exts, func(e string) bool {
+		return strings.EqualFold(e, ext)
+	})
+}
+
+// decompress decodes the stored data of fileRecord following mode, recording why in report.
+func (gf *GGPKFile) decompress(fileRecord *FileRecord, rawData []byte, mode DecompressionMode, report *DecodeReport) ([]byte, error) {
+	switch mode {
+	case DecompressNever:
+		report.Reason = "decompression disabled"
+		return rawData, nil
+	case DecompressByExtension:
+		if !gf.hasLZ4Extension(fileRecord) {
+			report.Reason = "extension not stored as LZ4"
+			return rawData, nil
+		}
+		mode = DecompressAlways
+	}
+	strict := mode == DecompressAlways
+
+	if len(rawData) < 4 {
+		if strict {
+			return nil, recordError(fileRecord.Offset, fileRecord.Tag, "data of %s is too short for an LZ4 size prefix", fileRecord.Name)
+		}
+		report.Reason = "too short for a size prefix"
+		return rawData, nil
+	}
+	uncompressedSize := GGPKEndian.Uint32(rawData[0:4])
+	compressedData := rawData[4:]
+
+	if uncompressedSize == uint32(len(compressedData)) {
+		if !strict {
+			// Uncompressed data may well start with its own length, so it is kept whole
+			report.Reason = "size prefix matches the stored size"
+			return rawData, nil
+		}
+		// Output size is same as input size (minus prefix): it was stored uncompressed with the prefix.
+		report.Reason = "stored uncompressed after a size prefix"
+		return compressedData, nil
+	}
+	if int64(uncompressedSize) > gf.maxFileSize() {
+		if strict {
+			return nil, fmt.Errorf("data of %s decompresses to %d bytes, more than the limit of %d", fileRecord.Name, uncompressedSize, gf.maxFileSize())
+		}
+		report.Reason = "size prefix over the limit"
+		return rawData, nil
+	}
+	if uncompressedSize == 0 {
+		if strict {
+			return nil, recordError(fileRecord.Offset, fileRecord.Tag, "data of %s has an LZ4 size prefix of 0", fileRecord.Name)
+		}
+		report.Reason = "size prefix of 0"
+		return rawData, nil
+	}
+
+	decompressedData := make([]byte, uncompressedSize)
+	n, err := lz4.UncompressBlock(compressedData, decompressedData)
+	if err == nil && n != int(uncompressedSize) {
+		err = fmt.Errorf("decompressed %d bytes instead of %d", n, uncompressedSize)
+	}
+	if err != nil {
+		if strict {
+			return nil, recordError(fileRecord.Offset, fileRecord.Tag, "failed to decompress data of %s: %v", fileRecord.Name, err)
+		}
+		// Raw data that happens to start with bytes that look like a size prefix
+		gf.logger().Debug("returning data as stored", "file", fileRecord.GetPath(), "error", err)
+		report.Reason = "not valid LZ4"
+		return rawData, nil
+	}
+	report.Decompressed = true
+	report.Reason = "decompressed LZ4"
+	return decompressedData, nil
+}
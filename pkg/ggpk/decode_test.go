@@ -0,0 +1,89 @@
+package ggpk_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+func TestReadDecodedData(t *testing.T) {
+	content := bytes.Repeat([]byte("compressible "), 100)
+	compressed := lz4Data(t, content)
+	path := ggpktest.WriteFile(t, map[string][]byte{
+		"compressed.dat": compressed,
+		"compressed.bin": compressed, // Same bytes, but not of a format stored as LZ4
+		"plain.txt":      []byte("plain text"),
+		"garbage.txt":    {100, 0, 0, 0, 0xff, 0xff},
+		"texture.dds":    compressed,
+	})
+	gf, err := ggpk.OpenWithOptions(path, ggpk.Options{LZ4Extensions: []string{".DAT"}})
+	if err != nil {
+		t.Fatalf("OpenWithOptions failed: %v", err)
+	}
+	defer gf.Close()
+
+	for _, p := range []string{"compressed.dat", "compressed.bin"} {
+		if data, err := gf.ReadRawData(getFile(t, gf, p)); err != nil || !bytes.Equal(data, compressed) {
+			t.Errorf("ReadRawData(%s) = %q, %v, expected the stored data", p, data, err)
+		}
+	}
+
+	tests := []struct {
+		path         string
+		mode         ggpk.DecompressionMode
+		want         []byte
+		decompressed bool
+	}{
+		{"compressed.dat", ggpk.DecompressByExtension, content, true},
+		{"compressed.bin", ggpk.DecompressByExtension, compressed, false},
+		{"compressed.bin", ggpk.DecompressAuto, content, true},
+		{"compressed.bin", ggpk.DecompressNever, compressed, false},
+		{"plain.txt", ggpk.DecompressAuto, []byte("plain text"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+"/"+tt.mode.String(), func(t *testing.T) {
+			data, report, err := gf.ReadDecodedData(getFile(t, gf, tt.path), tt.mode)
+			if err != nil {
+				t.Fatalf("ReadDecodedData failed: %v", err)
+			}
+			if !bytes.Equal(data, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, data)
+			}
+			want := ggpk.DecodeReport{
+				Mode:         tt.mode,
+				Decompressed: tt.decompressed,
+				StoredSize:   int64(getFile(t, gf, tt.path).DataLength),
+				Size:         int64(len(tt.want)),
+				Reason:       report.Reason,
+			}
+			if *report != want || report.Reason == "" {
+				t.Errorf("Expected report %+v, got %+v", want, *report)
+			}
+		})
+	}
+
+	// DefaultLZ4Extensions apply without LZ4Extensions
+	gf, err = ggpk.OpenWithOptions(path, ggpk.Options{})
+	if err != nil {
+		t.Fatalf("OpenWithOptions failed: %v", err)
+	}
+	defer gf.Close()
+	for p, want := range map[string][]byte{"texture.dds": content, "compressed.dat": compressed} {
+		if data, _, err := gf.ReadDecodedData(getFile(t, gf, p), ggpk.DecompressByExtension); err != nil || !bytes.Equal(data, want) {
+			t.Errorf("ReadDecodedData(%s) = %q, %v, expected %q", p, data, err, want)
+		}
+	}
+
+	// A known format must decode
+	gf, err = ggpk.OpenWithOptions(path, ggpk.Options{LZ4Extensions: []string{".txt"}})
+	if err != nil {
+		t.Fatalf("OpenWithOptions failed: %v", err)
+	}
+	defer gf.Close()
+	if _, _, err := gf.ReadDecodedData(getFile(t, gf, "garbage.txt"), ggpk.DecompressByExtension); !errors.Is(err, ggpk.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package ggpk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/user/ggpkgo/pkg/diff"
+)
+
+// Diff compares two GGPK files by the stored hashes of their files, without reading any data.
+// Directories with the same hash in both files are skipped entirely, except the root and its
+// direct children, whose hashes aren't always kept up to date (see RenewHashes).
+// Entries are matched by name ignoring case, and the changes are sorted by path.
+func Diff(oldFile, newFile *GGPKFile) ([]diff.Change, error) {
+	var changes []diff.Change
+	if err := diffDirectories(oldFile, oldFile.Root, newFile, newFile.Root, 0, &changes); err != nil {
+		return nil, err
+	}
+	diff.Sort(changes)
+	return changes, nil
+}
+
+func diffDirectories(oldFile *GGPKFile, oldDir *DirectoryRecord, newFile *GGPKFile, newDir *DirectoryRecord, depth int, changes *[]diff.Change) error {
+	if depth > 1 && oldDir.Hash == newDir.Hash {
+		return nil
+	}
+	oldChildren, err := oldDir.GetChildren(oldFile)
+	if err != nil {
+		return fmt.Errorf("failed to read old directory '%s': %w", oldDir.GetPath(), err)
+	}
+	newChildren, err := newDir.GetChildren(newFile)
+	if err != nil {
+		return fmt.Errorf("failed to read new directory '%s': %w", newDir.GetPath(), err)
+	}
+
+	newByName := make(map[string]TreeNode, len(newChildren))
+	for _, child := range newChildren {
+		newByName[strings.ToLower(child.GetName())] = child
+	}
+	for _, oldChild := range oldChildren {
+		name := strings.ToLower(oldChild.GetName())
+		newChild, ok := newByName[name]
+		if !ok {
+			if err := addAll(oldFile, oldChild, diff.Removed, changes); err != nil {
+				return err
+			}
+			continue
+		}
+		delete(newByName, name) // The remaining ones are additions
+
+		oldRecord, oldIsFile := oldChild.(*FileRecord)
+		newRecord, newIsFile := newChild.(*FileRecord)
+		switch {
+		case oldIsFile && newIsFile:
+			if oldRecord.Hash != newRecord.Hash {
+				*changes = append(*changes, diff.Change{Path: newRecord.GetPath(), Kind: diff.Modified, OldSize: int64(oldRecord.DataLength), NewSize: int64(newRecord.DataLength)})
+			}
+		case !oldIsFile && !newIsFile:
+			if err := diffDirectories(oldFile, oldChild.(*DirectoryRecord), newFile, newChild.(*DirectoryRecord), depth+1, changes); err != nil {
+				return err
+			}
+		default: // A file replaced by a directory or the other way around
+			if err := addAll(oldFile, oldChild, diff.Removed, changes); err != nil {
+				return err
+			}
+			if err := addAll(newFile, newChild, diff.Added, changes); err != nil {
+				return err
+			}
+		}
+	}
+	for _, newChild := range newChildren {
+		if _, ok := newByName[strings.ToLower(newChild.GetName())]; ok {
+			if err := addAll(newFile, newChild, diff.Added, changes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addAll appends a change of the given kind for node and every file below it.
+func addAll(gf *GGPKFile, node TreeNode, kind diff.Kind, changes *[]diff.Change) error {
+	return Walk(gf, node, func(p string, node TreeNode, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to read directory '%s': %w", p, err)
+		}
+		fr, ok := node.(*FileRecord)
+		if !ok {
+			return nil
+		}
+		c := diff.Change{Path: p, Kind: kind}
+		if kind == diff.Removed {
+			c.OldSize = int64(fr.DataLength)
+		} else {
+			c.NewSize = int64(fr.DataLength)
+		}
+		*changes = append(*changes, c)
+		return nil
+	})
+}
@@ -0,0 +1,56 @@
+package ggpk_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/diff"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+func openGGPK(t *testing.T, files map[string][]byte) *ggpk.GGPKFile {
+	t.Helper()
+	gf, err := ggpk.Open(ggpktest.WriteFile(t, files))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { gf.Close() })
+	return gf
+}
+
+func TestDiff(t *testing.T) {
+	oldFile := openGGPK(t, map[string][]byte{
+		"Data/Balance/same.dat": []byte("same"),
+		"Data/mods.dat":         []byte("old mods"),
+		"Data/removed.dat":      []byte("gone"),
+		"Art/swap":              []byte("file"),
+		"Art/Old/a.dds":         []byte("a"),
+	})
+	newFile := openGGPK(t, map[string][]byte{
+		"Data/Balance/same.dat": []byte("same"),
+		"Data/mods.dat":         []byte("new mods!"),
+		"Data/added.dat":        []byte("new"),
+		"Art/swap/inner.txt":    []byte("now a directory"),
+		"Art/Old/a.dds":         []byte("a"),
+	})
+
+	changes, err := ggpk.Diff(oldFile, newFile)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	want := []diff.Change{
+		{Path: "Art/swap", Kind: diff.Removed, OldSize: 4},
+		{Path: "Art/swap/inner.txt", Kind: diff.Added, NewSize: 15},
+		{Path: "Data/added.dat", Kind: diff.Added, NewSize: 3},
+		{Path: "Data/mods.dat", Kind: diff.Modified, OldSize: 8, NewSize: 9},
+		{Path: "Data/removed.dat", Kind: diff.Removed, OldSize: 4},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Unexpected changes:\n%+v\nexpected:\n%+v", changes, want)
+	}
+
+	if changes, err := ggpk.Diff(oldFile, oldFile); err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes between identical files, got %+v (%v)", changes, err)
+	}
+}
@@ -0,0 +1,61 @@
+package ggpk
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors wrapped by the functions of this package, to be tested with errors.Is.
+var (
+	// ErrNotFound means that a name or path has no node in the tree.
+	ErrNotFound = errors.New("not found")
+	// ErrNotDirectory means that a path goes through a file where a directory is expected.
+	ErrNotDirectory = errors.New("not a directory")
+	// ErrCorrupt means that the structure of the GGPK is invalid. Every *RecordError matches it.
+	ErrCorrupt = errors.New("corrupt GGPK")
+	// ErrUnsupportedVersion means that the GGPK header has a version this package can't read.
+	ErrUnsupportedVersion = errors.New("unsupported GGPK version")
+	// ErrJournalPending means that a commit was interrupted and its journal must be recovered by
+	// OpenReadWrite or Repair before the GGPK can be opened read-only.
+	ErrJournalPending = errors.New("GGPK has a pending journal")
+)
+
+// RecordError reports an invalid record, or a reference to a record that isn't there.
+type RecordError struct {
+	Offset int64  // Offset of the record
+	Tag    uint32 // Tag found at Offset, 0 if it couldn't be read
+	Err    error  // What is wrong with the record
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes every RecordError match ErrCorrupt.
+func (e *RecordError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// recordError returns a *RecordError with a formatted description.
+func recordError(offset int64, tag uint32, format string, args ...any) error {
+	return &RecordError{Offset: offset, Tag: tag, Err: fmt.Errorf(format, args...)}
+}
+
+// tagOf returns the tag of a record returned by ReadRecordAt.
+func tagOf(record any) uint32 {
+	switch r := record.(type) {
+	case *GGPKRecord:
+		return r.Tag
+	case *FreeRecord:
+		return r.Tag
+	case *FileRecord:
+		return r.Tag
+	case *DirectoryRecord:
+		return r.Tag
+	}
+	return 0
+}
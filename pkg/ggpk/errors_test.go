@@ -0,0 +1,56 @@
+package ggpk_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+func TestErrors(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{"Art/a.txt": []byte("aaa")})
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+
+	if _, err := gf.GetNodeByPath("Art/missing.txt"); !errors.Is(err, ggpk.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing path, got %v", err)
+	}
+	if _, err := gf.GetNodeByPath("Art/a.txt/b.txt"); !errors.Is(err, ggpk.ErrNotDirectory) {
+		t.Errorf("Expected ErrNotDirectory for a path through a file, got %v", err)
+	}
+	// Offset 1 is in the middle of the header, so it doesn't start a known record
+	_, err = gf.ReadRecordAt(1)
+	var recordErr *ggpk.RecordError
+	if !errors.As(err, &recordErr) || recordErr.Offset != 1 || !errors.Is(err, ggpk.ErrCorrupt) {
+		t.Errorf("Expected a RecordError at offset 1 matching ErrCorrupt, got %v", err)
+	}
+	if _, err := gf.ReadRecordAt(1 << 40); !errors.Is(err, ggpk.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for an offset outside the file, got %v", err)
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		offset int64
+		value  uint32
+		want   error
+	}{
+		{"Tag", 4, 0x12345678, ggpk.ErrCorrupt},
+		{"Version", 8, 99, ggpk.ErrUnsupportedVersion},
+		{"Root", 12, 1, ggpk.ErrCorrupt},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ggpktest.WriteFile(t, map[string][]byte{"a.txt": []byte("aaa")})
+			patchFile(t, path, tt.offset, binary.LittleEndian.AppendUint32(nil, tt.value))
+			if _, err := ggpk.Open(path); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package ggpk
+
+import "os"
+
+// CrashAfterJournal commits like Flush up to writing the journal, then closes the file
+// as if the process died before applying it.
+func CrashAfterJournal(gf *GGPKFile) error {
+	if err := gf.RenewHashes(false); err != nil {
+		return err
+	}
+	t := gf.reader.(*txFile)
+	if err := t.writeJournal(); err != nil {
+		return err
+	}
+	return t.f.Close()
+}
+
+// CrashDuringJournal commits like Flush but writes only half of the journal,
+// then closes the file as if the process died while writing it.
+func CrashDuringJournal(gf *GGPKFile) error {
+	if err := gf.RenewHashes(false); err != nil {
+		return err
+	}
+	t := gf.reader.(*txFile)
+	data := encodeJournal(t.baseSize, t.pending)
+	if err := os.WriteFile(t.journalPath, data[:len(data)/2], 0644); err != nil {
+		return err
+	}
+	return t.f.Close()
+}
+
+// CachedRecords returns the number of records in the cache of gf.
+func CachedRecords(gf *GGPKFile) int {
+	return len(gf.recordCache)
+}
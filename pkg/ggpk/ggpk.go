@@ -2,13 +2,13 @@ package ggpk
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 
 	"strings"
 
-	"github.com/pierrec/lz4/v4"
 	encunicode "golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/encoding/unicode/utf32" // Specific import for UTF-32
 	"golang.org/x/text/transform"
@@ -24,18 +24,26 @@ type GGPKFile struct {
 	stringReadBuf   []byte // Reusable buffer for string reading
 	utf16LEDecoder  transform.Transformer
 	utf32LEDecoder  transform.Transformer
+
+	// Write support, only used when opened by OpenReadWrite
+	writable       bool
+	freeList       []*FreeRecord // FreeRecords in linked-list order, loaded on first use
+	freeListLoaded bool
+	dirtyHashes    map[*DirectoryRecord]struct{} // Directories whose hash must be renewed by Flush
+
+	options Options    // As given to OpenWithOptions
+	lru     *recordLRU // Use order of recordCache under CacheLRU
 }
 
 // initGGPKFile initializes common fields for a GGPKFile.
 // It's an internal helper for Open and OpenFromReader.
-func initGGPKFile(rs io.ReadSeeker, size int64) (*GGPKFile, error) {
-	ggpkFile := &GGPKFile{
-		reader:         rs,
-		fileSize:       size,
-		recordCache:    make(map[int64]interface{}),
-		stringReadBuf:  make([]byte, 1024), // Initial size, can grow
-		utf16LEDecoder: encunicode.UTF16(encunicode.LittleEndian, encunicode.IgnoreBOM).NewDecoder(),
-		utf32LEDecoder: utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM).NewDecoder(),
+func initGGPKFile(rs io.ReadSeeker, size int64, opts Options) (*GGPKFile, error) {
+	ggpkFile := newGGPKFile(rs, size)
+	if err := opts.apply(ggpkFile); err != nil {
+		if f, ok := rs.(*os.File); ok {
+			f.Close()
+		}
+		return nil, err
 	}
 
 	// The GGPKRecord is always at offset 0
@@ -58,6 +66,12 @@ func initGGPKFile(rs io.ReadSeeker, size int64) (*GGPKFile, error) {
 		}
 		return nil, fmt.Errorf("invalid GGPK file: magic tag not found. Expected %X, got %X", GGPKRecordTag, ggpkFile.Header.Tag)
 	}
+	if v := ggpkFile.Header.Version; v < 2 || v > 4 {
+		if f, ok := rs.(*os.File); ok {
+			f.Close()
+		}
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, v)
+	}
 
 	// Parse the root directory
 	root, err := ggpkFile.ReadDirectoryRecordAt(ggpkFile.Header.RootDirectoryOffset, nil, "")
@@ -71,40 +85,58 @@ func initGGPKFile(rs io.ReadSeeker, size int64) (*GGPKFile, error) {
 	return ggpkFile, nil
 }
 
-// Open opens a GGPK file from disk, reads its header, and returns a GGPKFile struct.
-func Open(filepath string) (*GGPKFile, error) {
-	f, err := os.Open(filepath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s: %w", filepath, err)
-	}
-
-	fi, err := f.Stat()
-	if err != nil {
-		f.Close()
-		return nil, fmt.Errorf("failed to get file info for %s: %w", filepath, err)
+// newGGPKFile returns a GGPKFile reading from rs, without reading anything yet.
+func newGGPKFile(rs io.ReadSeeker, size int64) *GGPKFile {
+	return &GGPKFile{
+		reader:         rs,
+		fileSize:       size,
+		recordCache:    make(map[int64]interface{}),
+		dirtyHashes:    make(map[*DirectoryRecord]struct{}),
+		stringReadBuf:  make([]byte, 1024), // Initial size, can grow
+		utf16LEDecoder: encunicode.UTF16(encunicode.LittleEndian, encunicode.IgnoreBOM).NewDecoder(),
+		utf32LEDecoder: utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM).NewDecoder(),
 	}
+}
 
-	return initGGPKFile(f, fi.Size())
+// Open opens a GGPK file from disk, reads its header, and returns a GGPKFile struct.
+// If a commit of OpenReadWrite was interrupted, it fails with ErrJournalPending without
+// touching the file: OpenReadWrite or Repair recover it.
+func Open(filepath string) (*GGPKFile, error) {
+	return OpenWithOptions(filepath, Options{})
 }
 
 // OpenFromReader opens a GGPK file from an io.ReadSeeker (e.g., an in-memory buffer).
 // The fileSize is required to correctly interpret offsets and boundaries.
 func OpenFromReader(rs io.ReadSeeker, fileSize int64) (*GGPKFile, error) {
-	if fileSize <= 0 {
-		return nil, fmt.Errorf("fileSize must be positive for OpenFromReader")
-	}
-	return initGGPKFile(rs, fileSize)
+	return OpenFromReaderWithOptions(rs, fileSize, Options{})
 }
 
 
 // Close closes the underlying file handle if it was opened from a file.
 // If opened from a reader, the caller is responsible for managing the reader's lifecycle.
+// Pending directory hash changes are flushed first when the file is writable.
 func (gf *GGPKFile) Close() error {
+	if err := gf.Flush(); err != nil {
+		if f, ok := gf.reader.(*os.File); ok && f != nil {
+			f.Close()
+		}
+		if t, ok := gf.reader.(*txFile); ok {
+			t.abort()
+			t.Close()
+		}
+		return err
+	}
 	if f, ok := gf.reader.(*os.File); ok {
 		if f != nil {
 			return f.Close()
 		}
 	}
+	if t, ok := gf.reader.(*txFile); ok {
+		return t.Close()
+	}
+	if m, ok := gf.reader.(*mappedFile); ok {
+		return m.Close()
+	}
 	// For other io.ReadSeeker types, we don't close them here.
 	return nil
 }
@@ -136,7 +168,7 @@ func (gf *GGPKFile) parseGGPKRecordBody(offset int64) (*GGPKRecord, error) {
 	}
 
 	if tag != GGPKRecordTag {
-		return nil, fmt.Errorf("expected GGPKRecord tag %X at offset %d, but got %X", GGPKRecordTag, offset, tag)
+		return nil, recordError(offset, tag, "expected GGPKRecord tag %X, but got %X", GGPKRecordTag, tag)
 	}
 
 	record := &GGPKRecord{
@@ -161,19 +193,22 @@ func (gf *GGPKFile) parseGGPKRecordBody(offset int64) (*GGPKRecord, error) {
 	return record, nil
 }
 
+// charSize returns the size of a character of the record names: 4 for UTF-32, 2 for UTF-16.
+func (gf *GGPKFile) charSize() int64 {
+	if gf.Header.Version == 4 { // Mac version uses UTF-32
+		return 4
+	}
+	return 2
+}
+
 // readUTF16String reads a null-terminated UTF-16LE string of nameLength characters.
 func (gf *GGPKFile) readUTF16String(nameLengthChars uint32) (string, error) {
 	if nameLengthChars == 0 {
 		return "", nil
 	}
 	numBytes := int(nameLengthChars * 2) // UTF-16 uses 2 bytes per character
-	if cap(gf.stringReadBuf) < numBytes {
-		gf.stringReadBuf = make([]byte, numBytes)
-	} else {
-		gf.stringReadBuf = gf.stringReadBuf[:numBytes]
-	}
-
-	if _, err := io.ReadFull(gf.reader, gf.stringReadBuf); err != nil {
+	buf, err := gf.readBytes(numBytes)
+	if err != nil {
 		return "", fmt.Errorf("failed to read UTF-16 string bytes: %w", err)
 	}
 
@@ -183,9 +218,9 @@ func (gf *GGPKFile) readUTF16String(nameLengthChars uint32) (string, error) {
 	// Here, nameLengthChars *already* includes the null terminator.
 	// So we read (nameLengthChars * 2) bytes. The actual string is (nameLengthChars-1) chars.
 
-	actualStringBytes := gf.stringReadBuf
+	actualStringBytes := buf
 	if nameLengthChars > 0 { // Ensure there's a null terminator to slice off
-		actualStringBytes = gf.stringReadBuf[:(nameLengthChars-1)*2]
+		actualStringBytes = buf[:(nameLengthChars-1)*2]
 	}
 
 
@@ -202,19 +237,14 @@ func (gf *GGPKFile) readUTF32String(nameLengthChars uint32) (string, error) {
 		return "", nil
 	}
 	numBytes := int(nameLengthChars * 4) // UTF-32 uses 4 bytes per character
-	if cap(gf.stringReadBuf) < numBytes {
-		gf.stringReadBuf = make([]byte, numBytes)
-	} else {
-		gf.stringReadBuf = gf.stringReadBuf[:numBytes]
-	}
-
-	if _, err := io.ReadFull(gf.reader, gf.stringReadBuf); err != nil { // Use gf.reader
+	buf, err := gf.readBytes(numBytes)
+	if err != nil {
 		return "", fmt.Errorf("failed to read UTF-32 string bytes: %w", err)
 	}
 
-	actualStringBytes := gf.stringReadBuf
+	actualStringBytes := buf
 	if nameLengthChars > 0 {
-		actualStringBytes = gf.stringReadBuf[:(nameLengthChars-1)*4]
+		actualStringBytes = buf[:(nameLengthChars-1)*4]
 	}
 
 	utf8Bytes, _, err := transform.Bytes(gf.utf32LEDecoder, actualStringBytes)
@@ -233,6 +263,9 @@ func (gf *GGPKFile) parseFileRecordBody(offset int64, baseRecord BaseRecord) (*F
 	if _, err := io.ReadFull(gf.reader, record.Hash[:]); err != nil { // Use gf.reader
 		return nil, fmt.Errorf("failed to read FileRecord Hash: %w", err)
 	}
+	if int64(RecordHeaderSize+4+HashSize)+int64(record.NameLength)*gf.charSize() > int64(record.Length) {
+		return nil, recordError(offset, record.Tag, "FileRecord name of %d characters exceeds the record length %d", record.NameLength, record.Length)
+	}
 
 	var nameString string
 	var err error
@@ -283,6 +316,9 @@ func (gf *GGPKFile) parseDirectoryRecordBody(offset int64, baseRecord BaseRecord
 	if _, err := io.ReadFull(gf.reader, record.Hash[:]); err != nil { // Use gf.reader
 		return nil, fmt.Errorf("failed to read DirectoryRecord Hash: %w", err)
 	}
+	if int64(RecordHeaderSize+4+4+HashSize)+int64(record.NameLength)*gf.charSize()+int64(record.EntryCount)*12 > int64(record.Length) {
+		return nil, recordError(offset, record.Tag, "DirectoryRecord name of %d characters and %d entries exceed the record length %d", record.NameLength, record.EntryCount, record.Length)
+	}
 
 	if assignedNameIfRoot != "" && record.NameLength == 0 { // Special case for root dir which has no name in record
 	    record.Name = assignedNameIfRoot
@@ -344,10 +380,13 @@ func (gf *GGPKFile) parseFreeRecordBody(offset int64, baseRecord BaseRecord) (*F
 // ReadRecordAt attempts to read and identify a record at a given offset.
 // It uses a cache to avoid re-parsing known records.
 func (gf *GGPKFile) ReadRecordAt(offset int64) (interface{}, error) {
-	if cachedRecord, found := gf.recordCache[offset]; found {
+	if cachedRecord, found := gf.cachedRecord(offset); found {
 		return cachedRecord, nil
 	}
 
+	if offset < 0 || offset+RecordHeaderSize > gf.fileSize {
+		return nil, recordError(offset, 0, "offset is outside the file of %d bytes", gf.fileSize)
+	}
 	length, tag, err := gf.readRecordHeaderAndSeek(offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read record header at offset %d: %w", offset, err)
@@ -377,14 +416,14 @@ func (gf *GGPKFile) ReadRecordAt(offset int64) (interface{}, error) {
 		if seekErr != nil {
 			return nil, fmt.Errorf("unknown record tag %X at offset %d and failed to seek past it: %w", tag, offset, seekErr)
 		}
-		return nil, fmt.Errorf("unknown record tag %X at offset %d (skipped)", tag, offset)
+		return nil, recordError(offset, tag, "unknown record tag %X (skipped)", tag)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	gf.recordCache[offset] = parsedRecord
+	gf.cacheRecord(offset, parsedRecord)
 	return parsedRecord, nil
 }
 
@@ -393,7 +432,7 @@ func (gf *GGPKFile) ReadRecordAt(offset int64) (interface{}, error) {
 // It sets the parent and, if known (e.g. for root), the name.
 func (gf *GGPKFile) ReadDirectoryRecordAt(offset int64, parent *DirectoryRecord, assignedName string) (*DirectoryRecord, error) {
     if offset == 0 { // Safety check, PDIR shouldn't be at 0 normally
-        return nil, fmt.Errorf("invalid directory offset 0")
+        return nil, recordError(offset, 0, "invalid directory offset 0")
     }
 	record, err := gf.ReadRecordAt(offset)
 	if err != nil {
@@ -401,7 +440,7 @@ func (gf *GGPKFile) ReadDirectoryRecordAt(offset int64, parent *DirectoryRecord,
 	}
 	dirRecord, ok := record.(*DirectoryRecord)
 	if !ok {
-		return nil, fmt.Errorf("expected DirectoryRecord at offset %d, but got %T", offset, record)
+		return nil, recordError(offset, tagOf(record), "expected DirectoryRecord, but got %T", record)
 	}
 
 	if assignedName != "" && dirRecord.Name == "" { // For root, name is not in record
@@ -414,7 +453,7 @@ func (gf *GGPKFile) ReadDirectoryRecordAt(offset int64, parent *DirectoryRecord,
 // ReadFileRecordAt is a specialized version for files.
 func (gf *GGPKFile) ReadFileRecordAt(offset int64, parent *DirectoryRecord) (*FileRecord, error) {
     if offset == 0 { // Safety check, FILE shouldn't be at 0
-        return nil, fmt.Errorf("invalid file offset 0")
+        return nil, recordError(offset, 0, "invalid file offset 0")
     }
 	record, err := gf.ReadRecordAt(offset)
 	if err != nil {
@@ -422,7 +461,7 @@ func (gf *GGPKFile) ReadFileRecordAt(offset int64, parent *DirectoryRecord) (*Fi
 	}
 	fileRecord, ok := record.(*FileRecord)
 	if !ok {
-		return nil, fmt.Errorf("expected FileRecord at offset %d, but got %T", offset, record)
+		return nil, recordError(offset, tagOf(record), "expected FileRecord, but got %T", record)
 	}
 	fileRecord.SetParent(parent)
 	return fileRecord, nil
@@ -437,49 +476,68 @@ func (dr *DirectoryRecord) GetChildren(gf *GGPKFile) ([]TreeNode, error) {
 		return dr.Children, nil
 	}
 
-	dr.Children = make([]TreeNode, dr.EntryCount)
-	for i, entry := range dr.Entries {
-		// Determine if it's a directory or file by looking at the tag of the record at entry.Offset
-		// This requires reading the header of the child record.
-		// We need to save and restore current seek position if readRecordHeaderAndSeek changes it
-		// on the shared gf.reader, or ensure readRecordHeaderAndSeek doesn't affect future reads
-		// for this loop if it's only reading headers.
-		// currentOffsetBeforeChildRead, _ := gf.reader.Seek(0, io.SeekCurrent)
-
-		_, tag, err := gf.readRecordHeaderAndSeek(entry.Offset) // This will seek gf.reader
+	children := make([]TreeNode, 0, dr.EntryCount)
+	for _, entry := range dr.Entries {
+		childNode, err := gf.readChild(dr, entry)
 		if err != nil {
-			return nil, fmt.Errorf("error reading child record header for entry %s (hash %X) at offset %d: %w", dr.Name, entry.NameHash, entry.Offset, err)
-		}
-		// After readRecordHeaderAndSeek, gf.reader is positioned after the child's header.
-		// This is fine as ReadDirectoryRecordAt/ReadFileRecordAt will re-seek.
-
-		var childNode TreeNode
-		switch tag {
-		case PDirRecordTag:
-			childNode, err = gf.ReadDirectoryRecordAt(entry.Offset, dr, "") // Name will be parsed from record
-		case FileRecordTag:
-			childNode, err = gf.ReadFileRecordAt(entry.Offset, dr)
-		default:
-			// This case should ideally not happen if GGPK is well-formed and entry points to valid FILE/PDIR
-			// Or it could be a FreeRecord, which we might want to handle or log
-			// gf.reader.Seek(entry.Offset+RecordHeaderSize, io.SeekStart) // Reset seek to after header for next potential read
-			// No need to seek back, ReadRecordAt called by ReadDirectoryRecordAt/ReadFileRecordAt will handle seeking.
-			return nil, fmt.Errorf("child entry %s (hash %X) at offset %d has unexpected tag %X", dr.Name, entry.NameHash, entry.Offset, tag)
+			if gf.options.SkipBadRecords && errors.Is(err, ErrCorrupt) {
+				gf.logger().Warn("skipping bad record", "directory", dr.GetPath(), "offset", entry.Offset, "error", err)
+				continue
+			}
+			return nil, err
 		}
+		children = append(children, childNode)
+	}
+	if len(children) < len(dr.Entries) {
+		// Not cached, so that the children stay aligned with the entries
+		return children, nil
+	}
+	if gf.keepsChildren() {
+		dr.Children = children
+		dr.childRecordsDirty = false
+	}
+	return children, nil
+}
 
-		if err != nil {
-			return nil, fmt.Errorf("error parsing child node for entry %s (hash %X) at offset %d: %w", dr.Name, entry.NameHash, entry.Offset, err)
-		}
-		dr.Children[i] = childNode
+// readChild reads the record of a child of dr from its entry.
+func (gf *GGPKFile) readChild(dr *DirectoryRecord, entry DirectoryEntry) (TreeNode, error) {
+	if entry.Offset < 0 || entry.Offset >= gf.fileSize {
+		return nil, recordError(entry.Offset, 0, "child entry %s (hash %X) points outside the file", dr.Name, entry.NameHash)
+	}
+	// Determine if it's a directory or file by looking at the tag of the record at entry.Offset.
+	// ReadDirectoryRecordAt/ReadFileRecordAt re-seek, so the position left here doesn't matter.
+	_, tag, err := gf.readRecordHeaderAndSeek(entry.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("error reading child record header for entry %s (hash %X) at offset %d: %w", dr.Name, entry.NameHash, entry.Offset, err)
+	}
+
+	var childNode TreeNode
+	switch tag {
+	case PDirRecordTag:
+		childNode, err = gf.ReadDirectoryRecordAt(entry.Offset, dr, "") // Name will be parsed from record
+	case FileRecordTag:
+		childNode, err = gf.ReadFileRecordAt(entry.Offset, dr)
+	default:
+		// This case should ideally not happen if GGPK is well-formed and entry points to valid FILE/PDIR
+		return nil, recordError(entry.Offset, tag, "child entry %s (hash %X) has unexpected tag %X", dr.Name, entry.NameHash, tag)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing child node for entry %s (hash %X) at offset %d: %w", dr.Name, entry.NameHash, entry.Offset, err)
 	}
-	dr.childRecordsDirty = false
-	return dr.Children, nil
+	return childNode, nil
 }
 
-// ReadFileData reads the data for a given FileRecord.
-// It attempts to handle LZ4 decompression if the data appears to be prefixed
-// with an uncompressed size (a common GGPK convention for compressed files).
+// ReadFileData reads the data for a given FileRecord, decoded as selected by
+// Options.Decompression like ReadDecodedData. By default that is DecompressByExtension, so
+// only files with one of the LZ4 extensions are decompressed; use ReadRawData for the data
+// exactly as stored.
 func (gf *GGPKFile) ReadFileData(fileRecord *FileRecord) ([]byte, error) {
+	data, _, err := gf.ReadDecodedData(fileRecord, gf.options.Decompression)
+	return data, err
+}
+
+// ReadRawData reads the data of a FileRecord exactly as stored, matching its hash.
+func (gf *GGPKFile) ReadRawData(fileRecord *FileRecord) ([]byte, error) {
 	if fileRecord == nil {
 		return nil, fmt.Errorf("FileRecord is nil")
 	}
@@ -487,7 +545,7 @@ func (gf *GGPKFile) ReadFileData(fileRecord *FileRecord) ([]byte, error) {
 		return []byte{}, nil // Empty file
 	}
 	if fileRecord.DataLength < 0 {
-		return nil, fmt.Errorf("FileRecord has negative DataLength: %d for file %s", fileRecord.DataLength, fileRecord.Name)
+		return nil, recordError(fileRecord.Offset, fileRecord.Tag, "FileRecord has negative DataLength: %d for file %s", fileRecord.DataLength, fileRecord.Name)
 	}
 
 	rawData := make([]byte, fileRecord.DataLength)
@@ -499,49 +557,41 @@ func (gf *GGPKFile) ReadFileData(fileRecord *FileRecord) ([]byte, error) {
 	if _, err := io.ReadFull(gf.reader, rawData); err != nil { // Use gf.reader
 		return nil, fmt.Errorf("failed to read raw data for file %s: %w", fileRecord.Name, err)
 	}
+	return rawData, nil
+}
 
-	// Attempt LZ4 decompression if data length is sufficient for the prefix
-	// and the uncompressed size makes sense.
-	// This is a heuristic. Some files might not be compressed or use other schemes.
-	if fileRecord.DataLength >= 4 {
-		uncompressedSize := GGPKEndian.Uint32(rawData[0:4])
-		compressedData := rawData[4:]
-
-		// Heuristic: If uncompressedSize is vastly different from DataLength-4,
-		// or if uncompressedSize is 0 but DataLength > 4, it might not be this LZ4 format.
-		// Or if uncompressed size is same as compressed size, it's effectively uncompressed.
-		if uncompressedSize == uint32(len(compressedData)) {
-			// Data is "compressed" but output size is same as input size (minus prefix).
-			// This means it was stored uncompressed with the prefix.
-			return compressedData, nil
-		}
-
-		// Avoid excessively large allocations if uncompressedSize is unreasonable.
-		// Max typical file size in GGPK, e.g. 500MB. If bigger, likely not this format or corrupt.
-		// This limit should be configurable or based on more specific file type knowledge.
-		const reasonableMaxSize = 500 * 1024 * 1024
-		if uncompressedSize > 0 && uncompressedSize <= reasonableMaxSize {
-			// Check if the file name suggests it shouldn't be decompressed (e.g. specific text files)
-			// For now, we'll try to decompress if the prefix looks valid.
-			// A more robust system might check file extensions.
-			// Example: !strings.HasSuffix(fileRecord.Name, ".txt") && !strings.HasSuffix(fileRecord.Name, ".lua")
-
-			decompressedData := make([]byte, uncompressedSize)
-			n, err := lz4.UncompressBlock(compressedData, decompressedData)
-			if err == nil && n == int(uncompressedSize) {
-				return decompressedData, nil // Successfully decompressed
-			}
-			// If decompression fails, or size doesn't match, fall through to return rawData.
-			// This could happen if the file isn't actually LZ4 compressed in this way,
-			// or if it's a different compression or just raw data that happens to start with bytes
-			// that look like a size prefix.
-		}
+// DataReader returns a reader over the stored data of a file, without any decoding.
+// Reads go to the underlying file directly, so the reader stays valid until Close.
+// If the underlying reader doesn't implement io.ReaderAt, reads through the returned
+// reader move the shared seek position and must not run concurrently with other reads.
+func (gf *GGPKFile) DataReader(fileRecord *FileRecord) (*io.SectionReader, error) {
+	if fileRecord == nil {
+		return nil, fmt.Errorf("FileRecord is nil")
+	}
+	if fileRecord.DataLength < 0 {
+		return nil, recordError(fileRecord.Offset, fileRecord.Tag, "FileRecord has negative DataLength: %d for file %s", fileRecord.DataLength, fileRecord.Name)
 	}
+	ra, ok := gf.reader.(io.ReaderAt)
+	if !ok {
+		ra = seekReaderAt{gf.reader}
+	}
+	return io.NewSectionReader(ra, fileRecord.DataOffset, int64(fileRecord.DataLength)), nil
+}
 
-	// If not decompressed (or decompression failed, or not applicable), return the raw data.
-	// This might be the correct uncompressed data for some files, or still compressed for others
-	// if our LZ4 heuristic didn't apply/work.
-	return rawData, nil
+// seekReaderAt implements io.ReaderAt by seeking, for readers that only support io.ReadSeeker.
+type seekReaderAt struct {
+	rs io.ReadSeeker
+}
+
+func (s seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF // io.ReaderAt reports a short read at the end as io.EOF
+	}
+	return n, err
 }
 
 // FindChildByName searches for a direct child (file or directory) by its name.
@@ -560,7 +610,7 @@ func (dr *DirectoryRecord) FindChildByName(name string, gf *GGPKFile) (TreeNode,
 			return child, nil
 		}
 	}
-	return nil, fmt.Errorf("child node '%s' not found in directory '%s'", name, dr.GetPath())
+	return nil, fmt.Errorf("child node '%s' in directory '%s': %w", name, dr.GetPath(), ErrNotFound)
 }
 
 // GetNodeByPath traverses the GGPK structure from the root to find a node (file or directory)
@@ -580,7 +630,7 @@ func (gf *GGPKFile) GetNodeByPath(path string) (TreeNode, error) {
 
 		dirNode, ok := currentNode.(*DirectoryRecord)
 		if !ok {
-			return nil, fmt.Errorf("path component '%s' encountered a file node, expected a directory at '%s'", part, strings.Join(parts[:i], "/"))
+			return nil, fmt.Errorf("path component '%s' encountered a file node at '%s': %w", part, strings.Join(parts[:i], "/"), ErrNotDirectory)
 		}
 
 		childNode, err := dirNode.FindChildByName(part, gf)
@@ -380,8 +380,11 @@ func TestOpenAndTraverse(t *testing.T) {
 		t.Fatalf("Expected 'file2_lz4.dat' to be a FileRecord, got %T", nodeLz4)
 	}
 
-	// Read file2_lz4.dat data (should be decompressed)
-	dataLz4, err := gf.ReadFileData(fileNodeLz4)
+	// Read file2_lz4.dat data, stored as is since .dat isn't one of the LZ4 extensions
+	if raw, err := gf.ReadFileData(fileNodeLz4); err != nil || len(raw) != int(fileNodeLz4.DataLength) {
+		t.Errorf("Expected the stored data of 'file2_lz4.dat' by default, got %d bytes (%v)", len(raw), err)
+	}
+	dataLz4, _, err := gf.ReadDecodedData(fileNodeLz4, DecompressAlways)
 	if err != nil {
 		t.Fatalf("ReadFileData for 'file2_lz4.dat' failed: %v", err)
 	}
@@ -504,9 +507,19 @@ func TestReadFileData_UncompressedWithLZ4Prefix(t *testing.T) {
 		DataLength: int32(len(rawData)),
 	}
 
-	data, err := gf.ReadFileData(fileRec)
+	// Kept whole unless the caller says the data has a size prefix
+	for _, mode := range []DecompressionMode{DecompressNever, DecompressAuto} {
+		data, _, err := gf.ReadDecodedData(fileRec, mode)
+		if err != nil {
+			t.Fatalf("ReadDecodedData(%s) failed: %v", mode, err)
+		}
+		if !bytes.Equal(data, rawData) {
+			t.Errorf("Expected the stored data with %s, got '%s'", mode, string(data))
+		}
+	}
+	data, _, err := gf.ReadDecodedData(fileRec, DecompressAlways)
 	if err != nil {
-		t.Fatalf("ReadFileData failed: %v", err)
+		t.Fatalf("ReadDecodedData failed: %v", err)
 	}
 	if string(data) != string(payload) {
 		t.Errorf("Expected data '%s', got '%s'", string(payload), string(data))
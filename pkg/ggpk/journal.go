@@ -0,0 +1,451 @@
+package ggpk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// JournalSuffix is appended to the path of a GGPK to name the journal of its pending commit.
+const JournalSuffix = ".journal"
+
+// journalMagic starts every journal file.
+var journalMagic = [8]byte{'G', 'G', 'P', 'K', 'J', 'R', 'N', 'L'}
+
+const journalVersion = 1
+
+// Modifications of a writable GGPK form a transaction that starts with the first write and is
+// committed by Flush. While it runs, new records are written where nothing refers to them: at the
+// end of the file or into space that was already free when the transaction began. The updates
+// of the records the committed file refers to (directory entry offsets, hashes, the header and
+// the free list) are kept in memory, and reads see them. Committing saves these updates to a
+// journal next to the GGPK before applying them, so that a crash at any point leaves either the
+// old or the new state once the journal is recovered by the next OpenReadWrite or Repair.
+// Read-only opens never recover it, since a writer may still be committing.
+
+// txFile is the file of a GGPK opened by OpenReadWrite.
+type txFile struct {
+	f           *os.File
+	journalPath string
+	pos         int64 // For Read and Seek
+
+	// State of the running transaction
+	active    bool
+	baseSize  int64      // Size of the file when the transaction began
+	free      [][2]int64 // Start and end of the FreeRecords when the transaction began
+	pending   []journalEntry
+	journaled bool // The journal holds pending and must be applied before the file is used
+}
+
+type journalEntry struct {
+	offset int64
+	data   []byte
+}
+
+func (t *txFile) Read(p []byte) (int, error) {
+	n, err := t.ReadAt(p, t.pos)
+	t.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (t *txFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += t.pos
+	case io.SeekEnd:
+		size, err := t.size()
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative seek offset %d", offset)
+	}
+	t.pos = offset
+	return offset, nil
+}
+
+// ReadAt reads the file with the pending updates applied.
+func (t *txFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := t.f.ReadAt(p, off)
+	end := off + int64(len(p))
+	for _, e := range t.pending {
+		eEnd := e.offset + int64(len(e.data))
+		if eEnd <= off || e.offset >= end {
+			continue
+		}
+		start := max(e.offset, off)
+		copy(p[start-off:], e.data[start-e.offset:min(eEnd, end)-e.offset])
+		if covered := int(min(eEnd, end) - off); covered > n {
+			n = covered // An update past the end of the file
+		}
+	}
+	if n == len(p) {
+		err = nil
+	}
+	return n, err
+}
+
+// size returns the size of the file once the pending updates are applied.
+func (t *txFile) size() (int64, error) {
+	fi, err := t.f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := fi.Size()
+	for _, e := range t.pending {
+		size = max(size, e.offset+int64(len(e.data)))
+	}
+	return size, nil
+}
+
+// writeAt writes data straight to the file if nothing committed refers to that place,
+// or keeps it for the commit otherwise.
+func (t *txFile) writeAt(offset int64, data []byte) error {
+	if !t.direct(offset, int64(len(data))) {
+		t.pending = append(t.pending, journalEntry{offset: offset, data: bytes.Clone(data)})
+		return nil
+	}
+	_, err := t.f.WriteAt(data, offset)
+	return err
+}
+
+// direct reports whether the committed file doesn't refer to the bytes at [offset, offset+length):
+// they are past the end of the file or in the body of a FreeRecord that existed when the
+// transaction began. The header of such a FreeRecord is still part of the free list.
+// Bytes under a pending update aren't, since applying it on commit would overwrite them.
+func (t *txFile) direct(offset, length int64) bool {
+	for _, e := range t.pending {
+		if e.offset < offset+length && offset < e.offset+int64(len(e.data)) {
+			return false
+		}
+	}
+	if offset >= t.baseSize {
+		return true
+	}
+	for _, r := range t.free {
+		if offset >= r[0]+minFreeRecordLength && offset+length <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// reusable reports whether a record may be written over the space at [offset, offset+length)
+// without touching anything the committed file refers to, other than a FreeRecord header.
+func (t *txFile) reusable(offset, length int64) bool {
+	if !t.active || offset >= t.baseSize {
+		return true
+	}
+	for _, r := range t.free {
+		if offset >= r[0] && offset+length <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Truncate shrinks the file. Only space appended by the transaction may be cut off.
+func (t *txFile) Truncate(size int64) error {
+	if t.active && size < t.baseSize {
+		return fmt.Errorf("cannot truncate to %d bytes during a transaction that began at %d bytes", size, t.baseSize)
+	}
+	return t.f.Truncate(size)
+}
+
+func (t *txFile) Close() error {
+	return t.f.Close()
+}
+
+// begin starts a transaction on a file of the given size and FreeRecords, if none is running.
+func (gf *GGPKFile) begin() error {
+	t, ok := gf.reader.(*txFile)
+	if !ok {
+		return fmt.Errorf("GGPK file is opened read-only")
+	}
+	if t.active {
+		return nil
+	}
+	if err := gf.loadFreeList(); err != nil {
+		return err
+	}
+	t.free = t.free[:0]
+	for _, f := range gf.freeList {
+		t.free = append(t.free, [2]int64{f.Offset, f.Offset + int64(f.Length)})
+	}
+	t.baseSize = gf.fileSize
+	t.active = true
+	return nil
+}
+
+// direct reports whether the bytes at [offset, offset+length) may be overwritten right away.
+func (gf *GGPKFile) direct(offset, length int64) bool {
+	t, ok := gf.reader.(*txFile)
+	return ok && t.active && t.direct(offset, length)
+}
+
+// reusable reports whether allocate may place a record of the given length at the start of a
+// FreeRecord. Space freed by the running transaction is still referenced by the committed file.
+func (gf *GGPKFile) reusable(offset int64, length int32) bool {
+	t, ok := gf.reader.(*txFile)
+	return !ok || t.reusable(offset, int64(length))
+}
+
+// canTruncate reports whether the file may be shrunk to size.
+func (gf *GGPKFile) canTruncate(size int64) bool {
+	t, ok := gf.reader.(*txFile)
+	return !ok || !t.active || size >= t.baseSize
+}
+
+// commit makes the running transaction durable and ends it.
+func (t *txFile) commit() error {
+	if !t.active {
+		return nil
+	}
+	if len(t.pending) > 0 {
+		if err := t.writeJournal(); err != nil {
+			return err
+		}
+		if err := t.apply(); err != nil {
+			return err
+		}
+	}
+	t.end()
+	return nil
+}
+
+// writeJournal saves the pending updates next to the GGPK, after the records they refer to.
+func (t *txFile) writeJournal() error {
+	if err := t.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync GGPK before commit: %w", err)
+	}
+	if err := writeSynced(t.journalPath, encodeJournal(t.baseSize, t.pending)); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	t.journaled = true
+	return nil
+}
+
+// apply writes the pending updates into the GGPK and removes the journal.
+func (t *txFile) apply() error {
+	if err := applyJournal(t.f, t.pending); err != nil {
+		return err
+	}
+	if err := os.Remove(t.journalPath); err != nil {
+		return fmt.Errorf("failed to remove journal after commit: %w", err)
+	}
+	return nil
+}
+
+func (t *txFile) end() {
+	t.active = false
+	t.journaled = false
+	t.pending = nil
+	t.free = t.free[:0]
+}
+
+// abort ends a transaction whose commit failed. Unless its journal is complete, in which case
+// the next Open finishes the commit, the records appended by the transaction are cut off.
+func (t *txFile) abort() {
+	if t.active && !t.journaled {
+		t.f.Truncate(t.baseSize)
+	}
+	t.end()
+}
+
+// Rollback discards the modifications made since the last Flush and reloads the header and the
+// root directory. Records obtained before must not be used anymore.
+func (gf *GGPKFile) Rollback() error {
+	t, ok := gf.reader.(*txFile)
+	if !ok || !t.active {
+		return nil
+	}
+	baseSize := t.baseSize
+	t.end()
+	if err := t.f.Truncate(baseSize); err != nil {
+		return fmt.Errorf("failed to discard appended records: %w", err)
+	}
+	gf.fileSize = baseSize
+	gf.recordCache = make(map[int64]interface{})
+	gf.dirtyHashes = make(map[*DirectoryRecord]struct{})
+	gf.freeList = nil
+	gf.freeListLoaded = false
+
+	header, err := gf.parseGGPKRecordBody(0)
+	if err != nil {
+		return fmt.Errorf("failed to reload GGPK header: %w", err)
+	}
+	gf.Header = *header
+	gf.recordCache[0] = header
+	root, err := gf.ReadDirectoryRecordAt(gf.Header.RootDirectoryOffset, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to reload root directory: %w", err)
+	}
+	gf.Root = root
+	return nil
+}
+
+// encodeJournal serializes the updates of a transaction on a file of baseSize bytes,
+// followed by the SHA-256 of everything before, which marks the journal as complete.
+func encodeJournal(baseSize int64, entries []journalEntry) []byte {
+	var buf bytes.Buffer
+	buf.Write(journalMagic[:])
+	binary.Write(&buf, binary.LittleEndian, uint32(journalVersion))
+	binary.Write(&buf, binary.LittleEndian, baseSize)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(entries)))
+	for _, e := range entries {
+		binary.Write(&buf, binary.LittleEndian, e.offset)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(e.data)))
+		buf.Write(e.data)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes()
+}
+
+// errIncompleteJournal is returned by decodeJournal for journals whose commit didn't finish
+// writing them; baseSize is still valid if the start of the journal was written.
+var errIncompleteJournal = errors.New("incomplete journal")
+
+func decodeJournal(data []byte) (baseSize int64, entries []journalEntry, err error) {
+	const headerSize = 8 + 4 + 8 + 4
+	if len(data) < headerSize || !bytes.Equal(data[:8], journalMagic[:]) {
+		return -1, nil, errIncompleteJournal
+	}
+	if v := binary.LittleEndian.Uint32(data[8:]); v != journalVersion {
+		return -1, nil, fmt.Errorf("unsupported journal version %d", v)
+	}
+	baseSize = int64(binary.LittleEndian.Uint64(data[12:]))
+	if len(data) < headerSize+sha256.Size {
+		return baseSize, nil, errIncompleteJournal
+	}
+	body, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if sha256.Sum256(body) != [sha256.Size]byte(sum) {
+		return baseSize, nil, errIncompleteJournal
+	}
+	count := binary.LittleEndian.Uint32(data[20:])
+	r := bytes.NewReader(body[headerSize:])
+	for i := uint32(0); i < count; i++ {
+		var e journalEntry
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &e.offset); err != nil {
+			return baseSize, nil, fmt.Errorf("corrupt journal entry %d: %w", i, err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return baseSize, nil, fmt.Errorf("corrupt journal entry %d: %w", i, err)
+		}
+		if int64(length) > int64(r.Len()) {
+			return baseSize, nil, fmt.Errorf("corrupt journal entry %d: %d bytes past the end", i, length)
+		}
+		e.data = make([]byte, length)
+		io.ReadFull(r, e.data)
+		entries = append(entries, e)
+	}
+	return baseSize, entries, nil
+}
+
+// applyJournal writes the updates into the file and syncs it.
+func applyJournal(f *os.File, entries []journalEntry) error {
+	for _, e := range entries {
+		if _, err := f.WriteAt(e.data, e.offset); err != nil {
+			return fmt.Errorf("failed to apply journal entry at offset %d: %w", e.offset, err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync GGPK after applying journal: %w", err)
+	}
+	return nil
+}
+
+// recoverJournal finishes or undoes the commit interrupted on the GGPK at path, if any.
+// A complete journal is applied (rolled forward); an incomplete one means the commit never
+// touched the records in use, so only the records appended by the transaction are cut off.
+func recoverJournal(path string) error {
+	journalPath := path + JournalSuffix
+	data, err := os.ReadFile(journalPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read journal %s: %w", journalPath, err)
+	}
+	baseSize, entries, err := decodeJournal(data)
+	if err != nil && !errors.Is(err, errIncompleteJournal) {
+		return fmt.Errorf("failed to recover %s: %w", journalPath, err)
+	}
+
+	f, openErr := os.OpenFile(path, os.O_RDWR, 0)
+	if openErr != nil {
+		return fmt.Errorf("failed to open %s to recover its journal: %w", path, openErr)
+	}
+	defer f.Close()
+	if err == nil {
+		if err := applyJournal(f, entries); err != nil {
+			return err
+		}
+	} else if fi, statErr := f.Stat(); statErr == nil && baseSize >= ggpkHeaderSize && fi.Size() > baseSize {
+		if err := f.Truncate(baseSize); err != nil {
+			return fmt.Errorf("failed to roll back %s: %w", path, err)
+		}
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync %s after roll back: %w", path, err)
+		}
+	}
+	if err := os.Remove(journalPath); err != nil {
+		return fmt.Errorf("failed to remove journal %s: %w", journalPath, err)
+	}
+	return nil
+}
+
+// checkNoJournal returns ErrJournalPending if the GGPK at path has a journal to recover.
+func checkNoJournal(path string) error {
+	journalPath := path + JournalSuffix
+	_, err := os.Stat(journalPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check for journal %s: %w", journalPath, err)
+	}
+	return fmt.Errorf("%s: %w, open it for writing to recover it", path, ErrJournalPending)
+}
+
+// ggpkHeaderSize is the length of the GGPKRecord, the smallest possible GGPK.
+const ggpkHeaderSize = RecordHeaderSize + 4 + 8 + 8
+
+// writeSynced writes a new file and syncs it and its directory.
+func writeSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync() // Not supported everywhere; the journal content is checked on recovery anyway
+		dir.Close()
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package ggpk_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/internal/ziptest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// modify grows a.txt and adds a file, which moves records and rewrites directory entries.
+func modify(t *testing.T, gf *ggpk.GGPKFile) {
+	t.Helper()
+	if err := gf.WriteFileData(getFile(t, gf, "Art/Sub/a.txt"), []byte("grown content of a")); err != nil {
+		t.Fatalf("WriteFileData failed: %v", err)
+	}
+	if _, err := gf.Replace(nil, ziptest.Reader(t, "Art/Sub/new.txt", "added"), true, nil); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+}
+
+func journalFiles() map[string][]byte {
+	return map[string][]byte{
+		"Art/Sub/a.txt": []byte("old a"),
+		"Art/b.txt":     []byte("old b"),
+	}
+}
+
+func checkNoJournal(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path + ggpk.JournalSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected the journal to be removed, got %v", err)
+	}
+}
+
+func TestJournal_RollForward(t *testing.T) {
+	files := journalFiles()
+	path := ggpktest.WriteFile(t, files)
+
+	gf := openReadWrite(t, path)
+	modify(t, gf)
+	// Reads see the modifications before they are committed
+	if data, err := gf.ReadFileData(getFile(t, gf, "Art/Sub/new.txt")); err != nil || string(data) != "added" {
+		t.Fatalf("ReadFileData before commit returned %q, %v", data, err)
+	}
+	if err := ggpk.CrashAfterJournal(gf); err != nil {
+		t.Fatalf("CrashAfterJournal failed: %v", err)
+	}
+
+	// Read-only opens leave the journal alone
+	if _, err := ggpk.Open(path); !errors.Is(err, ggpk.ErrJournalPending) {
+		t.Fatalf("Expected ErrJournalPending, got %v", err)
+	}
+	if _, err := os.Stat(path + ggpk.JournalSuffix); err != nil {
+		t.Fatalf("Expected the journal to be kept, got %v", err)
+	}
+	if err := openReadWrite(t, path).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	files["Art/Sub/a.txt"] = []byte("grown content of a")
+	files["Art/Sub/new.txt"] = []byte("added")
+	checkContent(t, path, files, "Art/Sub")
+	checkNoJournal(t, path)
+}
+
+func TestJournal_RollBack(t *testing.T) {
+	files := journalFiles()
+	path := ggpktest.WriteFile(t, files)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	gf := openReadWrite(t, path)
+	modify(t, gf)
+	if err := ggpk.CrashDuringJournal(gf); err != nil {
+		t.Fatalf("CrashDuringJournal failed: %v", err)
+	}
+	if fileSize(t, path) == int64(len(original)) {
+		t.Fatal("Expected the transaction to append records before the commit")
+	}
+
+	gf = openReadWrite(t, path)
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, original) {
+		t.Errorf("Expected recovery to restore the original file (err %v)", err)
+	}
+	checkNoJournal(t, path)
+}
+
+func TestRollback(t *testing.T) {
+	files := journalFiles()
+	path := ggpktest.WriteFile(t, files)
+
+	gf := openReadWrite(t, path)
+	modify(t, gf)
+	if err := gf.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if _, err := gf.GetNodeByPath("Art/Sub/new.txt"); err == nil {
+		t.Error("Expected the added file to be gone after Rollback")
+	}
+	// The file stays usable for a new transaction
+	if err := gf.WriteFileData(getFile(t, gf, "Art/b.txt"), []byte("new b")); err != nil {
+		t.Fatalf("WriteFileData after Rollback failed: %v", err)
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	files["Art/b.txt"] = []byte("new b")
+	checkContent(t, path, files, "Art/Sub")
+	checkNoJournal(t, path)
+}
@@ -0,0 +1,105 @@
+package ggpk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// mappedFile reads a file mapped into memory by mmapFile.
+type mappedFile struct {
+	*bytes.Reader
+	data []byte
+	f    *os.File
+}
+
+// openMapped maps f, returning an error if the system doesn't support it.
+func openMapped(f *os.File, size int64) (*mappedFile, error) {
+	data, err := mmapFile(f, size)
+	if err != nil {
+		return nil, err
+	}
+	return &mappedFile{Reader: bytes.NewReader(data), data: data, f: f}, nil
+}
+
+func (m *mappedFile) Close() error {
+	err := munmap(m.data)
+	m.data = nil
+	if cerr := m.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Mapped reports whether the file is memory-mapped, making DataView zero-copy.
+func (gf *GGPKFile) Mapped() bool {
+	_, ok := gf.reader.(*mappedFile)
+	return ok
+}
+
+// view returns the n bytes at offset of a mapped file without copying them.
+func (gf *GGPKFile) view(offset, n int64) ([]byte, bool) {
+	m, ok := gf.reader.(*mappedFile)
+	if !ok || offset < 0 || n < 0 || offset+n > int64(len(m.data)) {
+		return nil, false
+	}
+	return m.data[offset : offset+n : offset+n], true
+}
+
+// readBytes reads n bytes at the current position, into gf.stringReadBuf unless the file
+// is mapped. The result is only valid until the next call.
+func (gf *GGPKFile) readBytes(n int) ([]byte, error) {
+	if m, ok := gf.reader.(*mappedFile); ok {
+		pos := int64(len(m.data)) - int64(m.Len())
+		if b, ok := gf.view(pos, int64(n)); ok {
+			_, err := m.Seek(int64(n), io.SeekCurrent)
+			return b, err
+		}
+	}
+	if cap(gf.stringReadBuf) < n {
+		gf.stringReadBuf = make([]byte, n)
+	} else {
+		gf.stringReadBuf = gf.stringReadBuf[:n]
+	}
+	if _, err := io.ReadFull(gf.reader, gf.stringReadBuf); err != nil {
+		return nil, err
+	}
+	return gf.stringReadBuf, nil
+}
+
+// DataView returns the stored data of a file like ReadRawData. If the file is mapped, the
+// returned slice is a view of the mapping instead of a copy: it must not be modified, and
+// is only valid until Close.
+func (gf *GGPKFile) DataView(fileRecord *FileRecord) ([]byte, error) {
+	if fileRecord != nil && fileRecord.DataLength > 0 {
+		if b, ok := gf.view(fileRecord.DataOffset, int64(fileRecord.DataLength)); ok {
+			return b, nil
+		}
+	}
+	return gf.ReadRawData(fileRecord)
+}
+
+// DataHash returns the SHA-256 of the stored data of a file, to compare with its Hash.
+// Mapped data is hashed in place, other data is streamed.
+func (gf *GGPKFile) DataHash(fileRecord *FileRecord) ([HashSize]byte, error) {
+	var sum [HashSize]byte
+	if gf.Mapped() {
+		data, err := gf.DataView(fileRecord)
+		if err != nil {
+			return sum, err
+		}
+		return sha256.Sum256(data), nil
+	}
+	r, err := gf.DataReader(fileRecord)
+	if err != nil {
+		return sum, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return sum, fmt.Errorf("failed to read data of %s: %w", fileRecord.Name, err)
+	}
+	h.Sum(sum[:0])
+	return sum, nil
+}
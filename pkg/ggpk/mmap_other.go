@@ -0,0 +1,17 @@
+//go:build !linux
+
+package ggpk
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile isn't supported outside Linux; files are read through os.File.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func munmap(data []byte) error {
+	return nil
+}
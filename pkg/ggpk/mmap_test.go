@@ -0,0 +1,62 @@
+package ggpk_test
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+func TestOpen_Mapped(t *testing.T) {
+	files := map[string][]byte{
+		"Art/a.txt":   []byte("first"),
+		"Art/b.txt":   []byte("second"),
+		"Data/ü.dat":  []byte("non-ASCII name"),
+		"empty.txt":   {},
+		"packed.data": lz4Data(t, bytes.Repeat([]byte("packed "), 50)),
+	}
+	path := ggpktest.WriteFile(t, files)
+
+	for _, opts := range []ggpk.Options{{}, {DisableMmap: true}} {
+		gf, err := ggpk.OpenWithOptions(path, opts)
+		if err != nil {
+			t.Fatalf("OpenWithOptions failed: %v", err)
+		}
+		if want := runtime.GOOS == "linux" && !opts.DisableMmap; gf.Mapped() != want {
+			t.Errorf("Mapped() = %v with %+v, expected %v", gf.Mapped(), opts, want)
+		}
+		for p, content := range files {
+			fr := getFile(t, gf, p)
+			if view, err := gf.DataView(fr); err != nil || !bytes.Equal(view, content) {
+				t.Errorf("DataView(%s) = %q, %v, expected %q", p, view, err, content)
+			}
+			if sum, err := gf.DataHash(fr); err != nil || sum != fr.Hash {
+				t.Errorf("DataHash(%s) = %x, %v, expected %x", p, sum, err, fr.Hash)
+			}
+			data, err := gf.ReadFileData(fr)
+			if err != nil {
+				t.Fatalf("ReadFileData(%s) failed: %v", p, err)
+			}
+			if p == "packed.data" {
+				continue
+			}
+			if !bytes.Equal(data, content) {
+				t.Errorf("ReadFileData(%s) = %q, expected %q", p, data, content)
+			}
+			if len(data) > 0 {
+				data[0] ^= 0xff // The result must be a copy, not the read-only mapping
+			}
+		}
+		if err := gf.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	}
+
+	gf := openReadWrite(t, path)
+	defer gf.Close()
+	if gf.Mapped() {
+		t.Errorf("Expected a writable GGPK not to be mapped")
+	}
+}
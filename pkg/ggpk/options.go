@@ -0,0 +1,151 @@
+package ggpk
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// DefaultMaxFileSize is the limit of Options.MaxFileSize when it is 0.
+const DefaultMaxFileSize = 500 << 20
+
+// Options configure how OpenWithOptions opens a GGPK.
+type Options struct {
+	// Writable opens the file for reading and writing, like OpenReadWrite.
+	// It requires CacheAll and doesn't allow SkipBadRecords.
+	Writable bool
+	// Cache selects the records kept in memory once read. The zero value is CacheAll.
+	Cache CacheMode
+	// MaxCachedRecords is the limit of CacheLRU, DefaultMaxCachedRecords if 0.
+	MaxCachedRecords int
+	// Decompression selects how ReadFileData decodes LZ4 data. The zero value is
+	// DecompressByExtension; ReadRawData returns the data as stored whatever the mode.
+	Decompression DecompressionMode
+	// LZ4Extensions lists the extensions, like ".dds", of files stored with an LZ4 size prefix
+	// under DecompressByExtension, DefaultLZ4Extensions if nil. Matching ignores case.
+	LZ4Extensions []string
+	// MaxFileSize bounds the size ReadFileData decompresses data to, DefaultMaxFileSize if 0.
+	// Larger data is returned as stored by DecompressAuto, and fails with DecompressAlways.
+	MaxFileSize int64
+	// SkipBadRecords makes GetChildren leave out the children whose records are corrupt,
+	// logging them, instead of failing. The directory entries are kept as they are.
+	SkipBadRecords bool
+	// DisableMmap reads the file through os.File even where it could be memory-mapped.
+	// Files are mapped on Linux unless they are writable, see DataView. Reading a mapped file
+	// that another writer truncates crashes the process.
+	DisableMmap bool
+	// Logger receives warnings about skipped records and data that failed to decompress.
+	// Nothing is logged if it is nil.
+	Logger *slog.Logger
+}
+
+// apply checks the options and sets them on gf.
+func (o Options) apply(gf *GGPKFile) error {
+	if o.MaxCachedRecords < 0 {
+		return fmt.Errorf("invalid MaxCachedRecords %d", o.MaxCachedRecords)
+	}
+	if o.MaxFileSize < 0 {
+		return fmt.Errorf("invalid MaxFileSize %d", o.MaxFileSize)
+	}
+	if o.Writable && (o.Cache != CacheAll || o.SkipBadRecords) {
+		return fmt.Errorf("a writable GGPK requires CacheAll and no SkipBadRecords")
+	}
+	switch o.Cache {
+	case CacheAll, CacheDirectories:
+	case CacheLRU:
+		if o.MaxCachedRecords == 0 {
+			o.MaxCachedRecords = DefaultMaxCachedRecords
+		}
+		gf.lru = newRecordLRU(o.MaxCachedRecords)
+	default:
+		return fmt.Errorf("unknown cache mode %d", o.Cache)
+	}
+	if !o.Decompression.valid() {
+		return fmt.Errorf("unknown decompression mode %d", o.Decompression)
+	}
+	gf.options = o
+	return nil
+}
+
+// maxFileSize returns the limit of Options.MaxFileSize.
+func (gf *GGPKFile) maxFileSize() int64 {
+	if gf.options.MaxFileSize == 0 {
+		return DefaultMaxFileSize
+	}
+	return gf.options.MaxFileSize
+}
+
+// logger returns Options.Logger, or a logger discarding everything.
+func (gf *GGPKFile) logger() *slog.Logger {
+	if gf.options.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return gf.options.Logger
+}
+
+// OpenWithOptions opens a GGPK file from disk like Open, or like OpenReadWrite if
+// opts.Writable is set, configured by opts. Only a writable open recovers an interrupted commit;
+// a read-only one fails with ErrJournalPending instead, leaving the file untouched.
+func OpenWithOptions(filepath string, opts Options) (*GGPKFile, error) {
+	if opts.Writable {
+		if err := recoverJournal(filepath); err != nil {
+			return nil, err
+		}
+	} else if err := checkNoJournal(filepath); err != nil {
+		return nil, err
+	}
+	flag, mode := os.O_RDONLY, ""
+	if opts.Writable {
+		flag, mode = os.O_RDWR, " for writing"
+	}
+	f, err := os.OpenFile(filepath, flag, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s%s: %w", filepath, mode, err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to get file info for %s: %w", filepath, err)
+	}
+
+	if !opts.Writable {
+		if opts.DisableMmap {
+			return initGGPKFile(f, fi.Size(), opts)
+		}
+		m, err := openMapped(f, fi.Size())
+		if err != nil {
+			// Read through f instead
+			if opts.Logger != nil {
+				opts.Logger.Debug("not memory-mapping GGPK", "path", filepath, "error", err)
+			}
+			return initGGPKFile(f, fi.Size(), opts)
+		}
+		gf, err := initGGPKFile(m, fi.Size(), opts)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		return gf, nil
+	}
+	gf, err := initGGPKFile(&txFile{f: f, journalPath: filepath + JournalSuffix}, fi.Size(), opts)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	gf.writable = true
+	return gf, nil
+}
+
+// OpenFromReaderWithOptions opens a GGPK from rs like OpenFromReader, configured by opts.
+// Writable isn't supported.
+func OpenFromReaderWithOptions(rs io.ReadSeeker, fileSize int64, opts Options) (*GGPKFile, error) {
+	if fileSize <= 0 {
+		return nil, fmt.Errorf("fileSize must be positive for OpenFromReader")
+	}
+	if opts.Writable {
+		return nil, fmt.Errorf("a GGPK opened from a reader can't be writable")
+	}
+	return initGGPKFile(rs, fileSize, opts)
+}
@@ -0,0 +1,169 @@
+package ggpk_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/pierrec/lz4/v4"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+func TestOpenWithOptions_Writable(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{"a.txt": []byte("old")})
+	if _, err := ggpk.OpenWithOptions(path, ggpk.Options{Writable: true, Cache: ggpk.CacheLRU}); err == nil {
+		t.Errorf("Expected an error for a writable GGPK with CacheLRU")
+	}
+
+	gf, err := ggpk.OpenWithOptions(path, ggpk.Options{Writable: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions failed: %v", err)
+	}
+	if err := gf.WriteFileData(getFile(t, gf, "a.txt"), []byte("new")); err != nil {
+		t.Fatalf("WriteFileData failed: %v", err)
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	gf, err = ggpk.OpenWithOptions(path, ggpk.Options{})
+	if err != nil {
+		t.Fatalf("OpenWithOptions failed: %v", err)
+	}
+	defer gf.Close()
+	if err := gf.WriteFileData(getFile(t, gf, "a.txt"), []byte("x")); err == nil {
+		t.Errorf("Expected an error writing to a read-only GGPK")
+	}
+	if data, _ := gf.ReadFileData(getFile(t, gf, "a.txt")); string(data) != "new" {
+		t.Errorf("Expected 'new', got %q", data)
+	}
+}
+
+func TestOpenWithOptions_SkipBadRecords(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{
+		"Art/a.txt": []byte("first"),
+		"Art/b.txt": []byte("second"),
+	})
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	offset := getFile(t, gf, "Art/a.txt").Offset
+	gf.Close()
+	patchFile(t, path, offset+4, []byte("JUNK"))
+
+	gf, err = ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := getDir(t, gf, "Art").GetChildren(gf); !errors.Is(err, ggpk.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+	gf.Close()
+
+	var log bytes.Buffer
+	gf, err = ggpk.OpenWithOptions(path, ggpk.Options{
+		SkipBadRecords: true,
+		Logger:         slog.New(slog.NewTextHandler(&log, nil)),
+	})
+	if err != nil {
+		t.Fatalf("OpenWithOptions failed: %v", err)
+	}
+	defer gf.Close()
+	children, err := getDir(t, gf, "Art").GetChildren(gf)
+	if err != nil {
+		t.Fatalf("GetChildren failed: %v", err)
+	}
+	if len(children) != 1 || children[0].GetName() != "b.txt" {
+		t.Errorf("Expected only b.txt, got %v", children)
+	}
+	if !strings.Contains(log.String(), "skipping bad record") {
+		t.Errorf("Expected the skipped record to be logged, got %q", log.String())
+	}
+}
+
+// lz4Data returns data compressed with an LZ4 size prefix.
+func lz4Data(t *testing.T, data []byte) []byte {
+	t.Helper()
+	buf := make([]byte, lz4.CompressBlockBound(len(data)))
+	n, err := lz4.CompressBlock(data, buf, nil)
+	if err != nil || n == 0 {
+		t.Fatalf("CompressBlock failed: %d, %v", n, err)
+	}
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(data))), buf[:n]...)
+}
+
+func TestOpenWithOptions_Decompression(t *testing.T) {
+	content := bytes.Repeat([]byte("compressible "), 100)
+	compressed := lz4Data(t, content)
+	garbage := []byte{100, 0, 0, 0, 0xff, 0xff}
+	path := ggpktest.WriteFile(t, map[string][]byte{
+		"compressed.bin": compressed,
+		"texture.dds":    compressed,
+		"plain.txt":      []byte("plain text"),
+		"garbage.bin":    garbage,
+	})
+
+	type result struct {
+		data    []byte
+		corrupt bool // Expect an error wrapping ErrCorrupt, nil data for another error
+	}
+	tests := []struct {
+		name string
+		opts ggpk.Options
+		want map[string]result
+	}{
+		{"default", ggpk.Options{}, map[string]result{
+			"compressed.bin": {data: compressed},
+			"texture.dds":    {data: content},
+			"plain.txt":      {data: []byte("plain text")},
+			"garbage.bin":    {data: garbage},
+		}},
+		{"auto", ggpk.Options{Decompression: ggpk.DecompressAuto}, map[string]result{
+			"compressed.bin": {data: content},
+			"plain.txt":      {data: []byte("plain text")},
+			"garbage.bin":    {data: garbage},
+		}},
+		{"never", ggpk.Options{Decompression: ggpk.DecompressNever}, map[string]result{
+			"compressed.bin": {data: compressed},
+			"texture.dds":    {data: compressed},
+			"plain.txt":      {data: []byte("plain text")},
+			"garbage.bin":    {data: garbage},
+		}},
+		{"always", ggpk.Options{Decompression: ggpk.DecompressAlways}, map[string]result{
+			"compressed.bin": {data: content},
+			"plain.txt":      {}, // The prefix is a size over the limit
+			"garbage.bin":    {corrupt: true},
+		}},
+		{"limit", ggpk.Options{Decompression: ggpk.DecompressAuto, MaxFileSize: 100}, map[string]result{
+			"compressed.bin": {data: compressed},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gf, err := ggpk.OpenWithOptions(path, tt.opts)
+			if err != nil {
+				t.Fatalf("OpenWithOptions failed: %v", err)
+			}
+			defer gf.Close()
+			for p, want := range tt.want {
+				data, err := gf.ReadFileData(getFile(t, gf, p))
+				switch {
+				case want.data != nil:
+					if err != nil || !bytes.Equal(data, want.data) {
+						t.Errorf("ReadFileData(%s) = %q, %v, expected %q", p, data, err, want.data)
+					}
+				case err == nil:
+					t.Errorf("ReadFileData(%s): expected an error", p)
+				case errors.Is(err, ggpk.ErrCorrupt) != want.corrupt:
+					t.Errorf("ReadFileData(%s): unexpected error %v", p, err)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package ggpk
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
 
 // Endianness used in GGPK files
 var GGPKEndian = binary.LittleEndian
@@ -136,3 +140,36 @@ func (dr *DirectoryRecord) GetPath() string {
 	}
 	return parentPath + "/" + dr.Name
 }
+
+// NameHash returns the Murmur2 hash of the lowercase name, as stored in DirectoryEntry.NameHash.
+// The name is hashed as UTF-16LE regardless of the GGPK version.
+func NameHash(name string) uint32 {
+	units := utf16.Encode([]rune(strings.ToLower(name)))
+	data := make([]byte, len(units)*2)
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(data[i*2:], u)
+	}
+	return murmurHash2(data, 0)
+}
+
+// murmurHash2 is the 32-bit MurmurHash2 used by TreeNode.GetNameHash in LibGGPK3.
+func murmurHash2(data []byte, seed uint32) uint32 {
+	const m = 0x5BD1E995
+	const r = 24
+
+	h := seed ^ uint32(len(data))
+	for len(data) >= 4 {
+		k := binary.LittleEndian.Uint32(data) * m
+		h = (h * m) ^ ((k ^ (k >> r)) * m)
+		data = data[4:]
+	}
+	if len(data) > 0 {
+		var tail uint32
+		for i := len(data) - 1; i >= 0; i-- {
+			tail = tail<<8 | uint32(data[i])
+		}
+		h = (h ^ tail) * m
+	}
+	h = (h ^ (h >> 13)) * m
+	return h ^ (h >> 15)
+}
@@ -0,0 +1,394 @@
+package ggpk
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ReferenceFile is a file a GGPK is expected to hold, which Repair uses to put orphaned
+// FileRecords back at their place in the tree.
+type ReferenceFile struct {
+	Path string          // Slash-separated path from the root
+	Hash *[HashSize]byte // SHA-256 of the content, nil if unknown
+}
+
+// ReferenceFiles lists the files of a GGPK with their hashes, as a reference for Repair.
+func ReferenceFiles(gf *GGPKFile) ([]ReferenceFile, error) {
+	var files []ReferenceFile
+	err := Walk(gf, gf.Root, func(p string, node TreeNode, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to get children of '%s': %w", p, err)
+		}
+		if fr, ok := node.(*FileRecord); ok {
+			files = append(files, ReferenceFile{Path: p, Hash: &fr.Hash})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// OrphanFile is a FileRecord that Repair found outside the tree and couldn't place.
+type OrphanFile struct {
+	Offset int64  `json:"offset"`
+	Name   string `json:"name"`
+}
+
+// RepairReport is the result of Repair.
+type RepairReport struct {
+	DamagedBytes     int64        `json:"damaged_bytes"`     // Bytes not holding a valid record, turned into free space
+	DroppedEntries   int          `json:"dropped_entries"`   // Directory entries that didn't point at a valid record
+	NewRoot          bool         `json:"new_root"`          // The root directory was damaged and has been recreated
+	Relinked         []string     `json:"relinked"`          // Paths of the orphaned files put back into the tree
+	Unresolved       []OrphanFile `json:"unresolved"`        // Orphaned files left out of the tree
+	FreedDirectories int          `json:"freed_directories"` // Orphaned directory records turned into free space
+	UnusableBytes    int64        `json:"unusable_bytes"`    // Damaged bytes too few for a FreeRecord, left as they are
+}
+
+// Repair fixes the structure of a damaged GGPK in place. It scans the records like ScanRecords
+// and rebuilds the tree from them: entries that don't point at a valid FILE or PDIR record are
+// dropped, damaged bytes and orphaned directory records become free space, and the free list is
+// relinked from all the free space found. Orphaned files, such as those of a smashed directory,
+// are put back at the path of the reference file with the same hash and name, or with the same
+// name if the reference has no hashes and only one missing path has that name; the missing
+// directories are recreated. Files that can't be placed are left as they are and reported.
+//
+// The repair is one transaction committed at the end, like the modifications of OpenReadWrite.
+// The GGPK header at offset 0 must be intact.
+func Repair(path string, reference []ReferenceFile) (*RepairReport, error) {
+	if err := recoverJournal(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s for writing: %w", path, err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info for %s: %w", path, err)
+	}
+
+	t := &txFile{f: f, journalPath: path + JournalSuffix}
+	r := &repairer{
+		gf:      newGGPKFile(t, fi.Size()),
+		report:  &RepairReport{Relinked: []string{}, Unresolved: []OrphanFile{}},
+		files:   make(map[int64]*FileRecord),
+		dirs:    make(map[int64]*DirectoryRecord),
+		claimed: make(map[int64]bool),
+	}
+	r.gf.writable = true
+	if err := r.scan(); err != nil {
+		return nil, err
+	}
+	err = r.rebuildFreeList()
+	if err == nil {
+		err = r.rebuildTree()
+	}
+	if err == nil {
+		err = r.relink(reference)
+	}
+	if err == nil {
+		err = r.freeOrphanDirectories()
+	}
+	if err == nil {
+		err = r.gf.Flush()
+	}
+	if err != nil {
+		t.abort()
+		return nil, err
+	}
+	return r.report, nil
+}
+
+type repairer struct {
+	gf      *GGPKFile
+	report  *RepairReport
+	files   map[int64]*FileRecord      // FileRecords found by the scan, by offset
+	dirs    map[int64]*DirectoryRecord // DirectoryRecords found by the scan, by offset
+	free    [][2]int64                 // Start and end of the free space found by the scan
+	claimed map[int64]bool             // Records placed in the rebuilt tree
+}
+
+// scan reads every record of the file.
+func (r *repairer) scan() error {
+	for record, err := range ScanRecords(r.gf.reader) {
+		var scanErr *ScanError
+		if errors.As(err, &scanErr) {
+			r.free = append(r.free, [2]int64{scanErr.Offset, scanErr.Offset + scanErr.Skipped})
+			r.report.DamagedBytes += scanErr.Skipped
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch rec := record.(type) {
+		case *GGPKRecord:
+			if rec.Offset == 0 {
+				r.gf.Header = *rec
+				r.gf.recordCache[0] = rec
+			}
+		case *FreeRecord:
+			r.free = append(r.free, [2]int64{rec.Offset, rec.Offset + int64(rec.Length)})
+		case *FileRecord:
+			r.files[rec.Offset] = rec
+		case *DirectoryRecord:
+			r.dirs[rec.Offset] = rec
+		}
+	}
+	if r.gf.Header.Tag != GGPKRecordTag {
+		return fmt.Errorf("the GGPK header is damaged, so the file can't be repaired")
+	}
+	return nil
+}
+
+// maxFreeLength bounds the FreeRecords made of large damaged regions.
+const maxFreeLength = 1 << 30
+
+// rebuildFreeList links all the free space found by the scan, merging adjacent regions,
+// in the order of the file.
+func (r *repairer) rebuildFreeList() error {
+	sort.Slice(r.free, func(i, j int) bool { return r.free[i][0] < r.free[j][0] })
+	var merged [][2]int64
+	for _, span := range r.free {
+		if n := len(merged); n > 0 && merged[n-1][1] == span[0] {
+			merged[n-1][1] = span[1]
+			continue
+		}
+		merged = append(merged, span)
+	}
+
+	var list []*FreeRecord
+	for _, span := range merged {
+		for start := span[0]; start < span[1]; {
+			length := span[1] - start
+			if length > maxFreeLength {
+				length = min(maxFreeLength, length-minFreeRecordLength) // Leave a valid FreeRecord behind
+			}
+			if length < minFreeRecordLength {
+				// Such as the torn tail of a crashed write: nothing points at these bytes, which the
+				// transaction can't cut off, so they are only reported
+				r.report.DamagedBytes -= length
+				r.report.UnusableBytes += length
+				break
+			}
+			list = append(list, &FreeRecord{BaseRecord: BaseRecord{Offset: start, Length: int32(length), Tag: FreeRecordTag}})
+			start += length
+		}
+	}
+	for i := range list {
+		if i+1 < len(list) {
+			list[i].NextFreeOffset = list[i+1].Offset
+		}
+	}
+
+	// The transaction starts with this list, so that the free space can be reused right away
+	r.gf.freeList = list
+	r.gf.freeListLoaded = true
+	r.gf.Header.FirstFreeOffset = 0
+	if len(list) > 0 {
+		r.gf.Header.FirstFreeOffset = list[0].Offset
+	}
+	for _, free := range list {
+		r.gf.recordCache[free.Offset] = free
+		if err := r.gf.writeFreeRecord(free); err != nil {
+			return err
+		}
+	}
+	return r.gf.writeInt64At(ggpkFirstFreeField, r.gf.Header.FirstFreeOffset)
+}
+
+// rebuildTree keeps the valid entries of the directories reachable from the root,
+// recreating the root if it is damaged.
+func (r *repairer) rebuildTree() error {
+	root, ok := r.dirs[r.gf.Header.RootDirectoryOffset]
+	if !ok {
+		_, nameLength := r.gf.encodeName("")
+		root = &DirectoryRecord{
+			BaseRecord: BaseRecord{Tag: PDirRecordTag},
+			NameLength: nameLength,
+			Hash:       sha256.Sum256(nil),
+			Children:   []TreeNode{},
+		}
+		r.gf.Root = root
+		if err := r.gf.writeDirectoryRecord(root); err != nil {
+			return fmt.Errorf("failed to recreate the root directory: %w", err)
+		}
+		r.report.NewRoot = true
+	}
+	r.gf.Root = root
+	r.claimed[root.Offset] = true
+	r.gf.recordCache[root.Offset] = root
+	return r.rebuildDirectory(root)
+}
+
+// rebuildDirectory drops the invalid entries of dr, writing it if any was dropped or the
+// entries weren't sorted, then does the same below it.
+func (r *repairer) rebuildDirectory(dr *DirectoryRecord) error {
+	type entry struct {
+		DirectoryEntry
+		node TreeNode
+	}
+	var kept []entry
+	for _, e := range dr.Entries {
+		var node TreeNode
+		if fr, ok := r.files[e.Offset]; ok {
+			node = fr
+		} else if d, ok := r.dirs[e.Offset]; ok {
+			node = d
+		}
+		if node == nil || r.claimed[e.Offset] {
+			r.report.DroppedEntries++
+			continue
+		}
+		r.claimed[e.Offset] = true
+		r.gf.recordCache[e.Offset] = node
+		node.SetParent(dr)
+		kept = append(kept, entry{e, node})
+	}
+	changed := len(kept) != len(dr.Entries)
+	if !slices.IsSortedFunc(kept, func(a, b entry) int { return compareHash(a.NameHash, b.NameHash) }) {
+		slices.SortStableFunc(kept, func(a, b entry) int { return compareHash(a.NameHash, b.NameHash) })
+		changed = true
+	}
+	dr.Entries = make([]DirectoryEntry, len(kept))
+	dr.Children = make([]TreeNode, len(kept))
+	for i, e := range kept {
+		dr.Entries[i], dr.Children[i] = e.DirectoryEntry, e.node
+	}
+	dr.childRecordsDirty = false
+	if changed {
+		if err := r.gf.writeDirectoryRecord(dr); err != nil {
+			return err
+		}
+		r.gf.dirtyHashes[dr] = struct{}{}
+	}
+	for _, child := range dr.Children {
+		if d, ok := child.(*DirectoryRecord); ok {
+			if err := r.rebuildDirectory(d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func compareHash(a, b uint32) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// relink puts the orphaned files back at the paths of the reference missing from the tree.
+func (r *repairer) relink(reference []ReferenceFile) error {
+	byHash := make(map[[HashSize]byte][]string)
+	byName := make(map[string][]string)
+	for _, ref := range reference {
+		missing, err := r.missing(ref.Path)
+		if err != nil {
+			return err
+		}
+		if !missing {
+			continue
+		}
+		if ref.Hash != nil {
+			byHash[*ref.Hash] = append(byHash[*ref.Hash], ref.Path)
+		} else {
+			name := strings.ToLower(path.Base(ref.Path))
+			byName[name] = append(byName[name], ref.Path)
+		}
+	}
+
+	used := make(map[string]bool)
+	unused := func(paths []string, name string) []string {
+		var result []string
+		for _, p := range paths {
+			if !used[p] && strings.EqualFold(path.Base(p), name) {
+				result = append(result, p)
+			}
+		}
+		return result
+	}
+	offsets := make([]int64, 0, len(r.files))
+	for offset := range r.files {
+		if !r.claimed[offset] {
+			offsets = append(offsets, offset)
+		}
+	}
+	slices.Sort(offsets)
+	for _, offset := range offsets {
+		fr := r.files[offset]
+		// Files with the same content and name are interchangeable; names alone must be unique
+		target := ""
+		if paths := unused(byHash[fr.Hash], fr.Name); len(paths) > 0 {
+			target = paths[0]
+		} else if paths := unused(byName[strings.ToLower(fr.Name)], fr.Name); len(paths) == 1 {
+			target = paths[0]
+		}
+		if target == "" {
+			r.report.Unresolved = append(r.report.Unresolved, OrphanFile{Offset: fr.Offset, Name: fr.Name})
+			continue
+		}
+		parts, err := splitPath(target)
+		if err != nil {
+			return err
+		}
+		dir, err := r.gf.walkDirectories(r.gf.Root, parts[:len(parts)-1], true)
+		if err != nil {
+			return fmt.Errorf("failed to recreate the directory of '%s': %w", target, err)
+		}
+		if err := r.gf.link(dir, fr, fr.Offset); err != nil {
+			return fmt.Errorf("failed to relink '%s': %w", target, err)
+		}
+		r.gf.recordCache[fr.Offset] = fr
+		r.claimed[fr.Offset] = true
+		used[target] = true
+		r.report.Relinked = append(r.report.Relinked, target)
+	}
+	return nil
+}
+
+// missing reports whether the tree has nothing at the path. Paths going through a file or
+// with invalid names can't be recreated, so they aren't missing.
+func (r *repairer) missing(p string) (bool, error) {
+	parts, err := splitPath(p)
+	if err != nil || len(parts) == 0 {
+		return false, nil
+	}
+	dir, err := r.gf.walkDirectories(r.gf.Root, parts[:len(parts)-1], false)
+	if err != nil || dir == nil {
+		return err == nil, nil
+	}
+	child, err := findChildFold(r.gf, dir, parts[len(parts)-1])
+	if err != nil {
+		return false, err
+	}
+	return child == nil, nil
+}
+
+// freeOrphanDirectories turns the directory records outside the rebuilt tree into free space.
+func (r *repairer) freeOrphanDirectories() error {
+	offsets := make([]int64, 0, len(r.dirs))
+	for offset := range r.dirs {
+		if !r.claimed[offset] {
+			offsets = append(offsets, offset)
+		}
+	}
+	slices.Sort(offsets)
+	for _, offset := range offsets {
+		if err := r.gf.markAsFree(offset, r.dirs[offset].Length); err != nil {
+			return fmt.Errorf("failed to free orphaned directory record at offset %d: %w", offset, err)
+		}
+		r.report.FreedDirectories++
+	}
+	return nil
+}
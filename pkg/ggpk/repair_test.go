@@ -0,0 +1,110 @@
+package ggpk_test
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+var repairFiles = map[string][]byte{
+	"Art/Sub/a.txt": []byte("first file"),
+	"Art/Sub/b.txt": []byte("second file"),
+	"Art/c.txt":     []byte("third file"),
+	"d.txt":         []byte("fourth file"),
+}
+
+// repairFixture builds a GGPK with repairFiles, lists it as a reference and smashes the tag
+// of the directory at dir.
+func repairFixture(t *testing.T, dir string) (string, []ggpk.ReferenceFile) {
+	t.Helper()
+	path := ggpktest.WriteFile(t, repairFiles)
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+	reference, err := ggpk.ReferenceFiles(gf)
+	if err != nil {
+		t.Fatalf("ReferenceFiles failed: %v", err)
+	}
+	if len(reference) != len(repairFiles) {
+		t.Fatalf("ReferenceFiles returned %d files, expected %d", len(reference), len(repairFiles))
+	}
+	patchFile(t, path, getDir(t, gf, dir).Offset+4, []byte("XXXX"))
+	return path, reference
+}
+
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		name     string
+		dir      string
+		relinked []string
+		newRoot  bool
+		freed    int
+	}{
+		{"Directory", "Art", []string{"Art/Sub/a.txt", "Art/Sub/b.txt", "Art/c.txt"}, false, 1},
+		{"Root", "", []string{"Art/Sub/a.txt", "Art/Sub/b.txt", "Art/c.txt", "d.txt"}, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, reference := repairFixture(t, tt.dir)
+			report, err := ggpk.Repair(path, reference)
+			if err != nil {
+				t.Fatalf("Repair failed: %v", err)
+			}
+			slices.Sort(report.Relinked)
+			slices.Sort(tt.relinked)
+			if !slices.Equal(report.Relinked, tt.relinked) || report.NewRoot != tt.newRoot || len(report.Unresolved) != 0 {
+				t.Errorf("Unexpected report: %+v", report)
+			}
+			if report.DamagedBytes == 0 || report.FreedDirectories != tt.freed {
+				t.Errorf("Expected damaged bytes and a freed directory, got %+v", report)
+			}
+			checkContent(t, path, repairFiles, "Art/Sub")
+			if r := runCheck(t, path); !r.OK() {
+				t.Errorf("Check after Repair found issues: %+v", r.Issues)
+			}
+			if _, err := os.Stat(path + ggpk.JournalSuffix); !os.IsNotExist(err) {
+				t.Errorf("Journal left behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestRepair_Unresolved(t *testing.T) {
+	path, _ := repairFixture(t, "Art")
+	report, err := ggpk.Repair(path, nil)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if len(report.Unresolved) != 3 || len(report.Relinked) != 0 || report.DroppedEntries != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	checkContent(t, path, map[string][]byte{"d.txt": repairFiles["d.txt"]})
+	// The files are kept for a later repair or salvage
+	if kinds := issueKinds(runCheck(t, path)); kinds[ggpk.IssueOrphan] != 3 || len(kinds) != 1 {
+		t.Errorf("Expected 3 orphans, got %v", kinds)
+	}
+}
+
+func TestRepair_ShortDamage(t *testing.T) {
+	path := ggpktest.WriteFile(t, repairFiles)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("torn")) // A crashed write, too short for a FreeRecord
+	f.Close()
+
+	report, err := ggpk.Repair(path, nil)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if report.UnusableBytes != 4 || report.DamagedBytes != 0 {
+		t.Errorf("Expected 4 unusable bytes, got %+v", report)
+	}
+	checkContent(t, path, repairFiles, "Art/Sub")
+}
@@ -0,0 +1,162 @@
+package ggpk
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/ggpkgo/internal/zipfile"
+)
+
+// ReplaceStatus tells what Replace did with an entry.
+type ReplaceStatus string
+
+const (
+	StatusReplaced  ReplaceStatus = "replaced"  // The content of an existing file was replaced
+	StatusUnchanged ReplaceStatus = "unchanged" // The file already had the content, nothing was written
+	StatusAdded     ReplaceStatus = "added"     // The file was created, with its missing directories
+	StatusNotFound  ReplaceStatus = "not-found" // No file at the path and adding wasn't allowed
+)
+
+// ReplaceFunc is called by Replace after each entry with its path relative to the root of the
+// replacement and the file written, which is nil for StatusNotFound.
+// Returning an error stops Replace, which returns that error.
+type ReplaceFunc func(path string, fr *FileRecord, status ReplaceStatus) error
+
+// Replace writes the files of a zip archive onto the tree below root (Root if nil), matching
+// their paths ignoring case like the game does. Files whose SHA-256 already matches their
+// FileRecord.Hash are left as they are. Files that don't exist are created with their
+// directories if allowAdd is set, and reported as StatusNotFound otherwise. Directory entries
+// of the archive are ignored. fn may be nil. An entry whose path has a "." or ".." name, or a
+// name with a '\', fails Replace before anything is written.
+// It returns the number of files replaced or added. Directory hashes are renewed by Flush.
+func (gf *GGPKFile) Replace(root *DirectoryRecord, zr *zip.Reader, allowAdd bool, fn ReplaceFunc) (int, error) {
+	if root == nil {
+		root = gf.Root
+	}
+	for _, entry := range zr.File {
+		if _, err := splitPath(entry.Name); err != nil {
+			return 0, fmt.Errorf("zip entry %s: %w", entry.Name, err)
+		}
+	}
+	count := 0
+	for _, entry := range zr.File {
+		if strings.HasSuffix(entry.Name, "/") {
+			continue
+		}
+		data, err := zipfile.ReadEntry(entry)
+		if err != nil {
+			return count, err
+		}
+		if err := gf.apply(root, entry.Name, data, allowAdd, fn, &count); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// ReplaceFromDirectory mirrors the files below a directory on disk onto the tree below root
+// (Root if nil), like Replace does with the entries of a zip archive. Files are written in
+// lexical order of their paths.
+func (gf *GGPKFile) ReplaceFromDirectory(root *DirectoryRecord, dir string, allowAdd bool, fn ReplaceFunc) (int, error) {
+	if root == nil {
+		root = gf.Root
+	}
+	count := 0
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil // Links and devices aren't files of a mod
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		return gf.apply(root, filepath.ToSlash(rel), data, allowAdd, fn, &count)
+	})
+	return count, err
+}
+
+// apply writes one file for Replace and ReplaceFromDirectory, counting it if it was written.
+func (gf *GGPKFile) apply(root *DirectoryRecord, path string, data []byte, allowAdd bool, fn ReplaceFunc, count *int) error {
+	fr, status, err := gf.replaceFile(root, path, data, allowAdd)
+	if err != nil {
+		return err
+	}
+	if status == StatusReplaced || status == StatusAdded {
+		*count++
+	}
+	if fn != nil {
+		return fn(path, fr, status)
+	}
+	return nil
+}
+
+// replaceFile writes data to the file at the path below root unless it already has that content,
+// creating it if allowAdd is set.
+func (gf *GGPKFile) replaceFile(root *DirectoryRecord, path string, data []byte, allowAdd bool) (*FileRecord, ReplaceStatus, error) {
+	parts, err := splitPath(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(parts) == 0 {
+		return nil, "", fmt.Errorf("invalid path '%s'", path)
+	}
+	dir, err := gf.walkDirectories(root, parts[:len(parts)-1], allowAdd)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot write '%s': %w", path, err)
+	}
+	if dir == nil {
+		return nil, StatusNotFound, nil
+	}
+	name := parts[len(parts)-1]
+	child, err := findChildFold(gf, dir, name)
+	if err != nil {
+		return nil, "", err
+	}
+	switch c := child.(type) {
+	case nil:
+		if !allowAdd {
+			return nil, StatusNotFound, nil
+		}
+		fr, err := gf.addFile(dir, name, data)
+		if err != nil {
+			return nil, "", err
+		}
+		return fr, StatusAdded, nil
+	case *FileRecord:
+		if c.Hash == sha256.Sum256(data) {
+			return c, StatusUnchanged, nil
+		}
+		if err := gf.WriteFileData(c, data); err != nil {
+			return nil, "", err
+		}
+		return c, StatusReplaced, nil
+	default:
+		return nil, "", fmt.Errorf("cannot write '%s': '%s' is a directory", path, child.GetPath())
+	}
+}
+
+// findChildFold returns the child of dir with the name ignoring case, or nil if there is none.
+func findChildFold(gf *GGPKFile, dir *DirectoryRecord, name string) (TreeNode, error) {
+	children, err := dir.GetChildren(gf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get children of '%s': %w", dir.GetPath(), err)
+	}
+	for _, child := range children {
+		if strings.EqualFold(child.GetName(), name) {
+			return child, nil
+		}
+	}
+	return nil, nil
+}
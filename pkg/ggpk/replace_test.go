@@ -0,0 +1,135 @@
+package ggpk_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/internal/ziptest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+func TestReplace(t *testing.T) {
+	files := map[string][]byte{
+		"Art/Sub/a.txt": []byte("old a"),
+		"Art/b.txt":     []byte("old b"),
+		"Data/c.txt":    []byte("c"),
+	}
+	path := ggpktest.WriteFile(t, files)
+	zr := ziptest.Reader(t,
+		"art/sub/A.TXT", "new content of a",
+		"Art/New/Deeper/d.txt", "added",
+		"Art/", "", // Directory entries are ignored
+	)
+
+	gf := openReadWrite(t, path)
+	statuses := make(map[string]ggpk.ReplaceStatus)
+	record := func(p string, fr *ggpk.FileRecord, status ggpk.ReplaceStatus) error {
+		statuses[p] = status
+		return nil
+	}
+	// Without allowAdd, missing files are only reported
+	if n, err := gf.Replace(nil, zr, false, record); err != nil || n != 1 {
+		t.Fatalf("Replace returned %d, %v; expected 1 file", n, err)
+	}
+	if statuses["art/sub/A.TXT"] != ggpk.StatusReplaced || statuses["Art/New/Deeper/d.txt"] != ggpk.StatusNotFound {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+	if _, err := gf.GetNodeByPath("Art/New"); err == nil {
+		t.Error("Replace created a directory without allowAdd")
+	}
+
+	// The file replaced before is now left as it is
+	if n, err := gf.Replace(getDir(t, gf, ""), zr, true, record); err != nil || n != 1 {
+		t.Fatalf("Replace returned %d, %v; expected 1 file", n, err)
+	}
+	if statuses["art/sub/A.TXT"] != ggpk.StatusUnchanged || statuses["Art/New/Deeper/d.txt"] != ggpk.StatusAdded {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	files["Art/Sub/a.txt"] = []byte("new content of a")
+	files["Art/New/Deeper/d.txt"] = []byte("added")
+	checkContent(t, path, files, "Art/Sub", "Art/New", "Art/New/Deeper")
+}
+
+func TestReplace_Conflict(t *testing.T) {
+	gf := openReadWrite(t, ggpktest.WriteFile(t, map[string][]byte{"Art/a.txt": []byte("a")}))
+	defer gf.Close()
+	if _, err := gf.Replace(nil, ziptest.Reader(t, "Art/a.txt/b.txt", "b"), true, nil); err == nil {
+		t.Error("Expected an error writing below a file")
+	}
+	if _, err := gf.Replace(nil, ziptest.Reader(t, "Art", "file"), true, nil); err == nil {
+		t.Error("Expected an error replacing a directory with a file")
+	}
+}
+
+func TestReplace_InvalidName(t *testing.T) {
+	files := map[string][]byte{"Art/a.txt": []byte("a")}
+	path := ggpktest.WriteFile(t, files)
+	gf := openReadWrite(t, path)
+	for _, name := range []string{"Data/../evil.dat", "../x.txt", `Art\b.txt`} {
+		// The valid entry before the invalid one isn't written either
+		zr := ziptest.Reader(t, "Art/a.txt", "new", "Art/c.txt", "c", name, "evil")
+		if n, err := gf.Replace(nil, zr, true, nil); err == nil || n != 0 {
+			t.Errorf("Replace(%s) returned %d, %v; expected an error", name, n, err)
+		}
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	checkContent(t, path, files, "Art")
+}
+
+func TestReplaceFromDirectory(t *testing.T) {
+	files := map[string][]byte{
+		"Art/same.txt":  []byte("same"),
+		"Art/Sub/a.txt": []byte("old a"),
+		"Data/b.txt":    []byte("b"),
+	}
+	path := ggpktest.WriteFile(t, files)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"same.txt": "same", "sub/A.txt": "new a", "New/c.txt": "c"})
+
+	gf := openReadWrite(t, path)
+	sameOffset := getFile(t, gf, "Art/same.txt").Offset
+	statuses := make(map[string]ggpk.ReplaceStatus)
+	n, err := gf.ReplaceFromDirectory(getDir(t, gf, "Art"), dir, true, func(p string, fr *ggpk.FileRecord, status ggpk.ReplaceStatus) error {
+		statuses[p] = status
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("ReplaceFromDirectory returned %d, %v; expected 2 files", n, err)
+	}
+	want := map[string]ggpk.ReplaceStatus{"same.txt": ggpk.StatusUnchanged, "sub/A.txt": ggpk.StatusReplaced, "New/c.txt": ggpk.StatusAdded}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+	if getFile(t, gf, "Art/same.txt").Offset != sameOffset {
+		t.Error("An unchanged file was rewritten")
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	files["Art/Sub/a.txt"] = []byte("new a")
+	files["Art/New/c.txt"] = []byte("c")
+	checkContent(t, path, files, "Art/Sub", "Art/New")
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package ggpk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+)
+
+// ScanError is yielded by ScanRecords for bytes that don't hold a valid record.
+type ScanError struct {
+	Offset  int64 // Start of the damaged bytes
+	Skipped int64 // Number of bytes skipped to the next valid record or the end of the file
+	Err     error // Why the record at Offset is invalid
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("skipped %d bytes at offset %d: %v", e.Skipped, e.Offset, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// ScanRecords returns an iterator over the records of a GGPK read from r in the order they are
+// stored, without following the directory tree, so it works when the tree is damaged. Records
+// are yielded as *GGPKRecord, *FreeRecord, *FileRecord or *DirectoryRecord, with their offsets
+// set but no parents or children. Bytes that don't hold a valid record are yielded as a
+// *ScanError wrapping a *RecordError, and the scan continues at the next offset starting a
+// valid record.
+// Other errors, such as failing to read r, end the iteration.
+//
+// Names are decoded as UTF-32 if the GGPK header at offset 0 says version 4, UTF-16 otherwise.
+// Records are read through the seek position of r, which must not be used during the iteration.
+func ScanRecords(r io.ReadSeeker) iter.Seq2[any, error] {
+	return func(yield func(any, error) bool) {
+		size, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to get size of GGPK: %w", err))
+			return
+		}
+		gf := newGGPKFile(r, size)
+		if header, err := gf.parseGGPKRecordBody(0); err == nil && header.Tag == GGPKRecordTag {
+			gf.Header = *header
+		}
+
+		for offset := int64(0); offset < size; {
+			record, length, err := gf.parseRecordAt(offset)
+			if err == nil {
+				if !yield(record, nil) {
+					return
+				}
+				offset += int64(length)
+				continue
+			}
+			if !errors.Is(err, ErrCorrupt) {
+				yield(nil, err)
+				return
+			}
+			next, nextErr := gf.nextRecord(offset + 1)
+			if nextErr != nil {
+				yield(nil, nextErr)
+				return
+			}
+			if !yield(nil, &ScanError{Offset: offset, Skipped: next - offset, Err: err}) {
+				return
+			}
+			offset = next
+		}
+	}
+}
+
+// parseRecordAt parses the record at offset without caching it. Errors caused by invalid
+// content are a *RecordError; others are failures to read the file.
+func (gf *GGPKFile) parseRecordAt(offset int64) (any, int32, error) {
+	if gf.fileSize-offset < RecordHeaderSize {
+		return nil, 0, recordError(offset, 0, "%d trailing bytes are too short for a record", gf.fileSize-offset)
+	}
+	length, tag, err := gf.readRecordHeaderAndSeek(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if msg := validateRecord(tag, length, offset, gf.fileSize); msg != "" {
+		return nil, 0, recordError(offset, tag, "%s", msg)
+	}
+	base := BaseRecord{Offset: offset, Length: length, Tag: tag}
+	var record any
+	switch tag {
+	case GGPKRecordTag:
+		record, err = gf.parseGGPKRecordBody(offset)
+	case FreeRecordTag:
+		record, err = gf.parseFreeRecordBody(offset, base)
+	case FileRecordTag:
+		record, err = gf.parseFileRecordBody(offset, base)
+	case PDirRecordTag:
+		record, err = gf.parseDirectoryRecordBody(offset, base, "")
+	}
+	if err != nil {
+		// The header said the record fits in the file, so its fields are what's wrong
+		if errors.Is(err, ErrCorrupt) {
+			return nil, 0, err
+		}
+		return nil, 0, &RecordError{Offset: offset, Tag: tag, Err: fmt.Errorf("%s record: %w", tagName(tag), err)}
+	}
+	return record, length, nil
+}
+
+// scanChunkSize is how much nextRecord reads at once while looking for a record tag.
+const scanChunkSize = 64 << 10
+
+// nextRecord returns the first offset from start that holds a valid record,
+// or the size of the file if there is none.
+func (gf *GGPKFile) nextRecord(start int64) (int64, error) {
+	buf := make([]byte, scanChunkSize)
+	// The tag follows the length, so a record at offset has its tag at offset+4
+	for pos := start + 4; pos+4 <= gf.fileSize; {
+		n := int(min(int64(len(buf)), gf.fileSize-pos))
+		if _, err := gf.reader.Seek(pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(gf.reader, buf[:n]); err != nil {
+			return 0, fmt.Errorf("failed to read at offset %d: %w", pos, err)
+		}
+		for i := 0; i+4 <= n; i++ {
+			switch GGPKEndian.Uint32(buf[i:]) {
+			case FreeRecordTag, FileRecordTag, PDirRecordTag:
+			default:
+				continue
+			}
+			offset := pos + int64(i) - 4
+			_, _, err := gf.parseRecordAt(offset)
+			if err == nil {
+				return offset, nil
+			}
+			if !errors.Is(err, ErrCorrupt) {
+				return 0, err
+			}
+		}
+		pos += int64(n) - 3 // The last 3 bytes may start a tag cut by the end of the chunk
+	}
+	return gf.fileSize, nil
+}
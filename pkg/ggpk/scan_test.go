@@ -0,0 +1,65 @@
+package ggpk_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// scanFile returns the names of the FileRecords found by ScanRecords and the ScanErrors.
+func scanFile(t *testing.T, path string) (map[string]int64, []*ggpk.ScanError) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	files := make(map[string]int64)
+	var scanErrs []*ggpk.ScanError
+	for record, err := range ggpk.ScanRecords(bytes.NewReader(data)) {
+		var scanErr *ggpk.ScanError
+		switch {
+		case errors.As(err, &scanErr):
+			scanErrs = append(scanErrs, scanErr)
+		case err != nil:
+			t.Fatalf("ScanRecords failed: %v", err)
+		default:
+			if fr, ok := record.(*ggpk.FileRecord); ok {
+				files[fr.Name] = fr.Offset
+			}
+		}
+	}
+	return files, scanErrs
+}
+
+func TestScanRecords(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{
+		"Art/a.txt":     []byte("aaa"),
+		"Art/Sub/b.txt": []byte("bbb"),
+		"c.txt":         []byte("ccc"),
+	})
+	files, scanErrs := scanFile(t, path)
+	if len(files) != 3 || len(scanErrs) != 0 {
+		t.Fatalf("Expected 3 files and no damage, got %v and %v", files, scanErrs)
+	}
+
+	// Smash the Sub directory: the files around it are still found
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	sub := getDir(t, gf, "Art/Sub")
+	gf.Close()
+	patchFile(t, path, sub.Offset, bytes.Repeat([]byte{0xFF}, int(sub.Length)))
+
+	files, scanErrs = scanFile(t, path)
+	if len(files) != 3 {
+		t.Errorf("Expected the 3 files to be found after damage, got %v", files)
+	}
+	if len(scanErrs) != 1 || scanErrs[0].Offset != sub.Offset || scanErrs[0].Skipped != int64(sub.Length) {
+		t.Errorf("Expected one ScanError of %d bytes at %d, got %v", sub.Length, sub.Offset, scanErrs)
+	}
+}
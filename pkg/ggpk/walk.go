@@ -0,0 +1,83 @@
+package ggpk
+
+import (
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// SkipDir can be returned by a WalkFunc to skip the children of a directory, or the remaining
+// children of the directory of a file.
+var SkipDir = fs.SkipDir
+
+// SkipAll can be returned by a WalkFunc to stop the walk, which then returns nil.
+var SkipAll = fs.SkipAll
+
+// WalkFunc is called by Walk for every node, with path being node.GetPath(), like
+// fs.WalkDirFunc. err is nil, except for a directory whose children couldn't be read: then
+// the function is called with the error instead of after the children in post-order, or a
+// second time in pre-order, and returning nil continues with the next node.
+type WalkFunc func(path string, node TreeNode, err error) error
+
+// Walk calls fn for root, or the root of gf if nil, and everything below it, directories
+// before their children and children in name order. Any error other than SkipDir and SkipAll
+// returned by fn stops the walk and is returned.
+func Walk(gf *GGPKFile, root TreeNode, fn WalkFunc) error {
+	return walkTree(gf, root, fn, false)
+}
+
+// WalkPostOrder is like Walk, but calls fn for directories after their children.
+// SkipDir returned for a directory then only ends the walk of its parent like for a file.
+func WalkPostOrder(gf *GGPKFile, root TreeNode, fn WalkFunc) error {
+	return walkTree(gf, root, fn, true)
+}
+
+func walkTree(gf *GGPKFile, root TreeNode, fn WalkFunc, post bool) error {
+	if root == nil {
+		root = gf.Root
+	}
+	err := walkNode(gf, root, fn, post)
+	if err == SkipDir || err == SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkNode(gf *GGPKFile, node TreeNode, fn WalkFunc, post bool) error {
+	dr, ok := node.(*DirectoryRecord)
+	if !ok {
+		return fn(node.GetPath(), node, nil)
+	}
+	if !post {
+		if err := fn(dr.GetPath(), dr, nil); err != nil {
+			if err == SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+	children, err := dr.GetChildren(gf)
+	if err != nil {
+		err = fn(dr.GetPath(), dr, err)
+		if err == SkipDir {
+			return nil
+		}
+		return err
+	}
+	// Sorted apart, since the children of dr stay in the order of its entries
+	children = slices.SortedFunc(slices.Values(children), func(a, b TreeNode) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+	for _, child := range children {
+		if err := walkNode(gf, child, fn, post); err != nil {
+			if err == SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	if post {
+		return fn(dr.GetPath(), dr, nil)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package ggpk_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+func TestWalk(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{
+		"b.txt":       []byte("b"),
+		"Art/z.txt":   []byte("z"),
+		"Art/a.txt":   []byte("a"),
+		"Art/Sub/c":   []byte("c"),
+		"Data/d.dat":  []byte("d"),
+		"Data/e.dat":  []byte("e"),
+		"Data/f.dat":  []byte("f"),
+		"Other/g.txt": []byte("g"),
+	})
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+
+	errStop := errors.New("stop")
+	tests := []struct {
+		name    string
+		post    bool
+		stop    map[string]error // Returned for these paths
+		want    []string
+		wantErr error
+	}{
+		{name: "pre-order", want: []string{
+			"", "Art", "Art/Sub", "Art/Sub/c", "Art/a.txt", "Art/z.txt", "Data", "Data/d.dat", "Data/e.dat", "Data/f.dat",
+			"Other", "Other/g.txt", "b.txt",
+		}},
+		{name: "post-order", post: true, want: []string{
+			"Art/Sub/c", "Art/Sub", "Art/a.txt", "Art/z.txt", "Art", "Data/d.dat", "Data/e.dat", "Data/f.dat", "Data",
+			"Other/g.txt", "Other", "b.txt", "",
+		}},
+		{
+			name: "SkipDir",
+			stop: map[string]error{"Art": ggpk.SkipDir, "Data/e.dat": ggpk.SkipDir},
+			want: []string{"", "Art", "Data", "Data/d.dat", "Data/e.dat", "Other", "Other/g.txt", "b.txt"},
+		},
+		{
+			name: "SkipAll",
+			stop: map[string]error{"Data/d.dat": ggpk.SkipAll},
+			want: []string{"", "Art", "Art/Sub", "Art/Sub/c", "Art/a.txt", "Art/z.txt", "Data", "Data/d.dat"},
+		},
+		{
+			name:    "error",
+			post:    true,
+			stop:    map[string]error{"Art/a.txt": errStop},
+			want:    []string{"Art/Sub/c", "Art/Sub", "Art/a.txt"},
+			wantErr: errStop,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			walk := ggpk.Walk
+			if tt.post {
+				walk = ggpk.WalkPostOrder
+			}
+			err := walk(gf, nil, func(p string, node ggpk.TreeNode, err error) error {
+				if err != nil {
+					t.Fatalf("Unexpected error for %s: %v", p, err)
+				}
+				got = append(got, p)
+				return tt.stop[p]
+			})
+			if err != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWalk_BadDirectory(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{
+		"Art/a.txt":   []byte("a"),
+		"Other/b.txt": []byte("b"),
+	})
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	offset := getFile(t, gf, "Art/a.txt").Offset
+	gf.Close()
+	patchFile(t, path, offset+4, []byte("JUNK"))
+
+	gf, err = ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+	var got []string
+	err = ggpk.Walk(gf, nil, func(p string, node ggpk.TreeNode, err error) error {
+		if err != nil {
+			if !errors.Is(err, ggpk.ErrCorrupt) {
+				t.Errorf("Expected ErrCorrupt for %s, got %v", p, err)
+			}
+			got = append(got, p+" (error)")
+			return nil // Go on with the next directory
+		}
+		got = append(got, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	want := []string{"", "Art", "Art (error)", "Other", "Other/b.txt"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
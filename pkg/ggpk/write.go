@@ -0,0 +1,660 @@
+package ggpk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// minFreeRecordLength is the smallest FreeRecord: length + tag + NextFreeOffset.
+// A record written into a FreeRecord must either fill it exactly or leave at least this much behind.
+const minFreeRecordLength = RecordHeaderSize + 8
+
+// Offsets of the mutable fields of the GGPKRecord at the start of the file
+const (
+	ggpkRootOffsetField = RecordHeaderSize + 4    // After Version
+	ggpkFirstFreeField  = ggpkRootOffsetField + 8 // After RootDirectoryOffset
+)
+
+// OpenReadWrite opens a GGPK file from disk for reading and writing.
+// Modifications form a transaction that Flush commits, renewing the directory hashes first;
+// Close calls it automatically. An interrupted commit is recovered first, see Rollback.
+// Every record read stays cached like with CacheAll, since modified nodes must stay unique.
+func OpenReadWrite(filepath string) (*GGPKFile, error) {
+	return OpenWithOptions(filepath, Options{Writable: true})
+}
+
+// writeAt writes data at the given offset, growing the known file size if needed.
+// Data that the committed file refers to is only written when the transaction is committed.
+func (gf *GGPKFile) writeAt(offset int64, data []byte) error {
+	if !gf.writable {
+		return fmt.Errorf("GGPK file is opened read-only")
+	}
+	if err := gf.begin(); err != nil {
+		return err
+	}
+	if err := gf.reader.(*txFile).writeAt(offset, data); err != nil {
+		return fmt.Errorf("failed to write %d bytes at offset %d: %w", len(data), offset, err)
+	}
+	if end := offset + int64(len(data)); end > gf.fileSize {
+		gf.fileSize = end
+	}
+	return nil
+}
+
+func (gf *GGPKFile) writeInt64At(offset int64, v int64) error {
+	var b [8]byte
+	GGPKEndian.PutUint64(b[:], uint64(v))
+	return gf.writeAt(offset, b[:])
+}
+
+// truncate shrinks the file to size, used when free space ends up at the end of the file.
+func (gf *GGPKFile) truncate(size int64) error {
+	t, ok := gf.reader.(interface{ Truncate(int64) error })
+	if !ok {
+		return fmt.Errorf("underlying reader %T does not support truncating", gf.reader)
+	}
+	if err := t.Truncate(size); err != nil {
+		return fmt.Errorf("failed to truncate GGPK to %d bytes: %w", size, err)
+	}
+	gf.fileSize = size
+	return nil
+}
+
+// encodeName returns the stored form of a record name including its null terminator,
+// and the NameLength (in characters, null terminator included) to record for it.
+func (gf *GGPKFile) encodeName(name string) ([]byte, uint32) {
+	if gf.Header.Version == 4 { // Mac version uses UTF-32
+		runes := []rune(name)
+		b := make([]byte, (len(runes)+1)*4)
+		for i, r := range runes {
+			GGPKEndian.PutUint32(b[i*4:], uint32(r))
+		}
+		return b, uint32(len(runes) + 1)
+	}
+	units := utf16.Encode([]rune(name))
+	b := make([]byte, (len(units)+1)*2)
+	for i, u := range units {
+		GGPKEndian.PutUint16(b[i*2:], u)
+	}
+	return b, uint32(len(units) + 1)
+}
+
+// fileRecordHeader serializes a FileRecord without its data.
+func (gf *GGPKFile) fileRecordHeader(fr *FileRecord) []byte {
+	name, nameLength := gf.encodeName(fr.Name)
+	b := make([]byte, 0, RecordHeaderSize+4+HashSize+len(name))
+	b = binary.LittleEndian.AppendUint32(b, uint32(fr.Length))
+	b = binary.LittleEndian.AppendUint32(b, FileRecordTag)
+	b = binary.LittleEndian.AppendUint32(b, nameLength)
+	b = append(b, fr.Hash[:]...)
+	return append(b, name...)
+}
+
+// fileRecordLength returns the record length of a file with the given name and data length.
+func (gf *GGPKFile) fileRecordLength(name string, dataLength int32) int32 {
+	nameBytes, _ := gf.encodeName(name)
+	return RecordHeaderSize + 4 + HashSize + int32(len(nameBytes)) + dataLength
+}
+
+// directoryRecordBytes serializes a DirectoryRecord with its current entries.
+func (gf *GGPKFile) directoryRecordBytes(dr *DirectoryRecord) []byte {
+	name, nameLength := gf.encodeName(dr.Name)
+	length := gf.directoryRecordLength(dr)
+	b := make([]byte, 0, length)
+	b = binary.LittleEndian.AppendUint32(b, uint32(length))
+	b = binary.LittleEndian.AppendUint32(b, PDirRecordTag)
+	b = binary.LittleEndian.AppendUint32(b, nameLength)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(dr.Entries)))
+	b = append(b, dr.Hash[:]...)
+	b = append(b, name...)
+	for _, e := range dr.Entries {
+		b = binary.LittleEndian.AppendUint32(b, e.NameHash)
+		b = binary.LittleEndian.AppendUint64(b, uint64(e.Offset))
+	}
+	return b
+}
+
+// directoryRecordLength returns the length the directory record needs with its current entries.
+func (gf *GGPKFile) directoryRecordLength(dr *DirectoryRecord) int32 {
+	name, _ := gf.encodeName(dr.Name)
+	return RecordHeaderSize + 4 + 4 + HashSize + int32(len(name)) + int32(len(dr.Entries))*12
+}
+
+// loadFreeList reads the linked list of FreeRecords starting at Header.FirstFreeOffset.
+func (gf *GGPKFile) loadFreeList() error {
+	if gf.freeListLoaded {
+		return nil
+	}
+	var list []*FreeRecord
+	seen := make(map[int64]bool)
+	for offset := gf.Header.FirstFreeOffset; offset != 0; {
+		if seen[offset] {
+			return fmt.Errorf("free record list has a cycle at offset %d", offset)
+		}
+		seen[offset] = true
+		record, err := gf.ReadRecordAt(offset)
+		if err != nil {
+			return fmt.Errorf("failed to read free record at offset %d: %w", offset, err)
+		}
+		free, ok := record.(*FreeRecord)
+		if !ok {
+			return fmt.Errorf("expected FreeRecord at offset %d, but got %T", offset, record)
+		}
+		list = append(list, free)
+		offset = free.NextFreeOffset
+	}
+	gf.freeList = list
+	gf.freeListLoaded = true
+	return nil
+}
+
+// FreeRecords returns the FreeRecords of the file in linked-list order.
+func (gf *GGPKFile) FreeRecords() ([]*FreeRecord, error) {
+	if err := gf.loadFreeList(); err != nil {
+		return nil, err
+	}
+	return gf.freeList, nil
+}
+
+// setNextFree points the list element before index i (or the header when i == 0) at offset.
+func (gf *GGPKFile) setNextFree(i int, offset int64) error {
+	if i == 0 {
+		gf.Header.FirstFreeOffset = offset
+		return gf.writeInt64At(ggpkFirstFreeField, offset)
+	}
+	prev := gf.freeList[i-1]
+	prev.NextFreeOffset = offset
+	return gf.writeInt64At(prev.Offset+RecordHeaderSize, offset)
+}
+
+// removeFree unlinks the FreeRecord at index i of the free list.
+func (gf *GGPKFile) removeFree(i int) error {
+	free := gf.freeList[i]
+	if err := gf.setNextFree(i, free.NextFreeOffset); err != nil {
+		return err
+	}
+	gf.freeList = append(gf.freeList[:i], gf.freeList[i+1:]...)
+	delete(gf.recordCache, free.Offset)
+	return nil
+}
+
+// writeFreeRecord writes the header of a FreeRecord at its current offset.
+func (gf *GGPKFile) writeFreeRecord(free *FreeRecord) error {
+	b := make([]byte, 0, minFreeRecordLength)
+	b = binary.LittleEndian.AppendUint32(b, uint32(free.Length))
+	b = binary.LittleEndian.AppendUint32(b, FreeRecordTag)
+	b = binary.LittleEndian.AppendUint64(b, uint64(free.NextFreeOffset))
+	return gf.writeAt(free.Offset, b)
+}
+
+// markAsFree turns the space of a record into free space, merging it with adjacent FreeRecords
+// and trimming the file if the space is at its end. Until the transaction is committed, the file
+// is only trimmed of the records it appended.
+func (gf *GGPKFile) markAsFree(offset int64, length int32) error {
+	if err := gf.begin(); err != nil {
+		return err
+	}
+	if err := gf.loadFreeList(); err != nil {
+		return err
+	}
+	delete(gf.recordCache, offset)
+
+	// Absorb a FreeRecord directly after this space
+	for i, f := range gf.freeList {
+		if f.Offset == offset+int64(length) {
+			length += f.Length
+			if err := gf.removeFree(i); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	// Extend a FreeRecord directly before this space
+	for i, f := range gf.freeList {
+		if f.Offset+int64(f.Length) != offset {
+			continue
+		}
+		f.Length += length
+		if f.Offset+int64(f.Length) >= gf.fileSize && gf.canTruncate(f.Offset) {
+			if err := gf.removeFree(i); err != nil {
+				return err
+			}
+			return gf.truncate(f.Offset)
+		}
+		var b [4]byte
+		GGPKEndian.PutUint32(b[:], uint32(f.Length))
+		return gf.writeAt(f.Offset, b[:])
+	}
+
+	if offset+int64(length) >= gf.fileSize && gf.canTruncate(offset) {
+		return gf.truncate(offset)
+	}
+
+	// New FreeRecord at the head of the list
+	free := &FreeRecord{
+		BaseRecord:     BaseRecord{Offset: offset, Length: length, Tag: FreeRecordTag},
+		NextFreeOffset: gf.Header.FirstFreeOffset,
+	}
+	if err := gf.writeFreeRecord(free); err != nil {
+		return err
+	}
+	gf.freeList = append([]*FreeRecord{free}, gf.freeList...)
+	gf.recordCache[offset] = free
+	return gf.setNextFree(0, offset)
+}
+
+// allocate finds space for a record of the given length, reusing the best fitting FreeRecord
+// or the end of the file, and returns its offset. The caller must write the record there.
+func (gf *GGPKFile) allocate(length int32) (int64, error) {
+	if err := gf.begin(); err != nil {
+		return 0, err
+	}
+	if err := gf.loadFreeList(); err != nil {
+		return 0, err
+	}
+	best := -1
+	for i, f := range gf.freeList {
+		if f.Length != length && f.Length < length+minFreeRecordLength || !gf.reusable(f.Offset, length) {
+			continue
+		}
+		if best == -1 || f.Length < gf.freeList[best].Length {
+			best = i
+		}
+		if f.Length == length {
+			break
+		}
+	}
+	if best == -1 {
+		return gf.fileSize, nil
+	}
+
+	free := gf.freeList[best]
+	offset := free.Offset
+	delete(gf.recordCache, offset)
+	if free.Length == length {
+		return offset, gf.removeFree(best)
+	}
+	// Keep the remaining space as a smaller FreeRecord
+	free.Offset += int64(length)
+	free.Length -= length
+	if err := gf.writeFreeRecord(free); err != nil {
+		return 0, err
+	}
+	gf.recordCache[free.Offset] = free
+	return offset, gf.setNextFree(best, free.Offset)
+}
+
+// relocate moves a tree node to a new place that fits newLength bytes, freeing its old space,
+// and points its parent entry (or the GGPK header for the root) at the new offset.
+// The caller is responsible for writing the record content at the returned offset.
+func (gf *GGPKFile) relocate(node TreeNode, oldOffset int64, oldLength, newLength int32) (int64, error) {
+	if oldOffset != 0 {
+		if err := gf.markAsFree(oldOffset, oldLength); err != nil {
+			return 0, fmt.Errorf("failed to free old record at offset %d: %w", oldOffset, err)
+		}
+	}
+	newOffset, err := gf.allocate(newLength)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate %d bytes: %w", newLength, err)
+	}
+	if err := gf.updateNodeOffset(node, oldOffset, newOffset); err != nil {
+		return 0, err
+	}
+	return newOffset, nil
+}
+
+// updateNodeOffset rewrites the reference to a node after it moved from oldOffset to newOffset.
+func (gf *GGPKFile) updateNodeOffset(node TreeNode, oldOffset, newOffset int64) error {
+	if cached, ok := gf.recordCache[oldOffset]; ok && cached == node {
+		delete(gf.recordCache, oldOffset)
+	}
+	gf.recordCache[newOffset] = node
+
+	if dr, ok := node.(*DirectoryRecord); ok && dr == gf.Root {
+		gf.Header.RootDirectoryOffset = newOffset
+		return gf.writeInt64At(ggpkRootOffsetField, newOffset)
+	}
+	parent := node.GetParent()
+	if parent == nil {
+		return fmt.Errorf("cannot update offset of '%s': node has no parent", node.GetName())
+	}
+	for i := range parent.Entries {
+		if parent.Entries[i].Offset != oldOffset {
+			continue
+		}
+		parent.Entries[i].Offset = newOffset
+		entryPos := parent.Offset + int64(parent.Length) - int64(len(parent.Entries)-i)*12 + 4 // Skip NameHash
+		return gf.writeInt64At(entryPos, newOffset)
+	}
+	return fmt.Errorf("entry for '%s' at offset %d not found in directory '%s'", node.GetName(), oldOffset, parent.GetPath())
+}
+
+// WriteFileData replaces the content of a file, updating its SHA-256 hash.
+// The record is moved into free space or to the end of the file, unless it was added by the
+// running transaction and keeps its length. Directory hashes are renewed by Flush.
+func (gf *GGPKFile) WriteFileData(fr *FileRecord, data []byte) error {
+	if fr == nil {
+		return fmt.Errorf("FileRecord is nil")
+	}
+	hash := sha256.Sum256(data)
+
+	if int64(len(data)) == int64(fr.DataLength) && gf.direct(fr.Offset, int64(fr.Length)) {
+		if err := gf.writeAt(fr.Offset+RecordHeaderSize+4, hash[:]); err != nil {
+			return fmt.Errorf("failed to write hash of file %s: %w", fr.Name, err)
+		}
+		if err := gf.writeAt(fr.DataOffset, data); err != nil {
+			return fmt.Errorf("failed to write data of file %s: %w", fr.Name, err)
+		}
+		fr.Hash = hash
+	} else {
+		headerLength := fr.Length - fr.DataLength
+		newLength := int64(headerLength) + int64(len(data))
+		if newLength > int64(^uint32(0)>>1) {
+			return fmt.Errorf("file %s is too large: %d bytes", fr.Name, len(data))
+		}
+		newOffset, err := gf.relocate(fr, fr.Offset, fr.Length, int32(newLength))
+		if err != nil {
+			return fmt.Errorf("failed to relocate file %s: %w", fr.Name, err)
+		}
+		fr.Offset = newOffset
+		fr.Length = int32(newLength)
+		fr.DataLength = int32(len(data))
+		fr.DataOffset = newOffset + int64(headerLength)
+		fr.Hash = hash
+		if err := gf.writeAt(fr.Offset, gf.fileRecordHeader(fr)); err != nil {
+			return fmt.Errorf("failed to write record of file %s: %w", fr.Name, err)
+		}
+		if err := gf.writeAt(fr.DataOffset, data); err != nil {
+			return fmt.Errorf("failed to write data of file %s: %w", fr.Name, err)
+		}
+	}
+	if fr.parent != nil {
+		gf.dirtyHashes[fr.parent] = struct{}{}
+	}
+	return nil
+}
+
+// writeDirectoryRecord writes a directory after its entries changed, moving it if its length changed.
+func (gf *GGPKFile) writeDirectoryRecord(dr *DirectoryRecord) error {
+	newLength := gf.directoryRecordLength(dr)
+	if dr.Offset == 0 || newLength != dr.Length {
+		newOffset, err := gf.relocate(dr, dr.Offset, dr.Length, newLength)
+		if err != nil {
+			return fmt.Errorf("failed to relocate directory '%s': %w", dr.GetPath(), err)
+		}
+		dr.Offset = newOffset
+		dr.Length = newLength
+	}
+	dr.EntryCount = uint32(len(dr.Entries))
+	if err := gf.writeAt(dr.Offset, gf.directoryRecordBytes(dr)); err != nil {
+		return fmt.Errorf("failed to write directory '%s': %w", dr.GetPath(), err)
+	}
+	return nil
+}
+
+// addFile creates a file with the given content in dir. The name must not exist in dir yet.
+func (gf *GGPKFile) addFile(dir *DirectoryRecord, name string, data []byte) (*FileRecord, error) {
+	length := int64(gf.fileRecordLength(name, 0)) + int64(len(data))
+	if length > int64(^uint32(0)>>1) {
+		return nil, fmt.Errorf("file %s is too large: %d bytes", name, len(data))
+	}
+	_, nameLength := gf.encodeName(name)
+	fr := &FileRecord{
+		BaseRecord: BaseRecord{Length: int32(length), Tag: FileRecordTag},
+		NameLength: nameLength,
+		Hash:       sha256.Sum256(data),
+		Name:       name,
+		DataLength: int32(len(data)),
+	}
+	offset, err := gf.allocate(fr.Length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate %d bytes for file %s: %w", fr.Length, name, err)
+	}
+	fr.Offset = offset
+	fr.DataOffset = offset + length - int64(len(data))
+	if err := gf.writeAt(fr.Offset, gf.fileRecordHeader(fr)); err != nil {
+		return nil, fmt.Errorf("failed to write record of file %s: %w", name, err)
+	}
+	if err := gf.writeAt(fr.DataOffset, data); err != nil {
+		return nil, fmt.Errorf("failed to write data of file %s: %w", name, err)
+	}
+	gf.recordCache[offset] = fr
+	return fr, gf.link(dir, fr, offset)
+}
+
+// addDirectory creates an empty directory in dir. The name must not exist in dir yet.
+func (gf *GGPKFile) addDirectory(dir *DirectoryRecord, name string) (*DirectoryRecord, error) {
+	_, nameLength := gf.encodeName(name)
+	dr := &DirectoryRecord{
+		BaseRecord: BaseRecord{Tag: PDirRecordTag},
+		NameLength: nameLength,
+		Hash:       sha256.Sum256(nil), // The hash of no children
+		Name:       name,
+		Children:   []TreeNode{},
+	}
+	dr.Length = gf.directoryRecordLength(dr)
+	offset, err := gf.allocate(dr.Length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate %d bytes for directory %s: %w", dr.Length, name, err)
+	}
+	dr.Offset = offset
+	if err := gf.writeAt(dr.Offset, gf.directoryRecordBytes(dr)); err != nil {
+		return nil, fmt.Errorf("failed to write directory %s: %w", name, err)
+	}
+	gf.recordCache[offset] = dr
+	return dr, gf.link(dir, dr, offset)
+}
+
+// link adds an entry for a new record at offset to dir, keeping the entries sorted by NameHash.
+func (gf *GGPKFile) link(dir *DirectoryRecord, node TreeNode, offset int64) error {
+	children, err := dir.GetChildren(gf)
+	if err != nil {
+		return fmt.Errorf("failed to get children of '%s': %w", dir.GetPath(), err)
+	}
+	hash := NameHash(node.GetName())
+	i := sort.Search(len(dir.Entries), func(i int) bool { return dir.Entries[i].NameHash > hash })
+	dir.Entries = slices.Insert(dir.Entries, i, DirectoryEntry{NameHash: hash, Offset: offset})
+	dir.Children = slices.Insert(children, i, node)
+	node.SetParent(dir)
+	if err := gf.writeDirectoryRecord(dir); err != nil {
+		return err
+	}
+	gf.dirtyHashes[dir] = struct{}{}
+	return nil
+}
+
+// FindOrAddDirectory returns the directory at the path below dr, creating it and the missing
+// directories above it. Names match ignoring case, like the game does.
+func (dr *DirectoryRecord) FindOrAddDirectory(path string, gf *GGPKFile) (*DirectoryRecord, error) {
+	parts, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return gf.walkDirectories(dr, parts, true)
+}
+
+// FindOrAddFile returns the file at the path below dr, or creates it with its missing
+// directories. A new file holds preallocatedSize zero bytes, which WriteFileData can replace
+// in place while the file hasn't been committed yet. Names match ignoring case.
+func (dr *DirectoryRecord) FindOrAddFile(path string, preallocatedSize int32, gf *GGPKFile) (*FileRecord, error) {
+	parts, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("invalid file path '%s'", path)
+	}
+	if preallocatedSize < 0 {
+		return nil, fmt.Errorf("invalid preallocated size %d", preallocatedSize)
+	}
+	dir, err := gf.walkDirectories(dr, parts[:len(parts)-1], true)
+	if err != nil {
+		return nil, err
+	}
+	name := parts[len(parts)-1]
+	child, err := findChildFold(gf, dir, name)
+	if err != nil {
+		return nil, err
+	}
+	switch c := child.(type) {
+	case nil:
+		return gf.addFile(dir, name, make([]byte, preallocatedSize))
+	case *FileRecord:
+		return c, nil
+	default:
+		return nil, fmt.Errorf("'%s' is a directory", child.GetPath())
+	}
+}
+
+// splitPath returns the names of a path separated by '/', without empty ones. Names that
+// aren't valid for a record, "." and ".." or names containing '\', fail.
+func splitPath(path string) ([]string, error) {
+	parts := strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+	for _, part := range parts {
+		if part == "." || part == ".." || strings.ContainsRune(part, '\\') {
+			return nil, fmt.Errorf("invalid path '%s': bad name '%s'", path, part)
+		}
+	}
+	return parts, nil
+}
+
+// walkDirectories returns the directory reached from dir through the names of parts, creating
+// the missing ones if create is set. Without create, it returns nil if one is missing.
+func (gf *GGPKFile) walkDirectories(dir *DirectoryRecord, parts []string, create bool) (*DirectoryRecord, error) {
+	for _, part := range parts {
+		child, err := findChildFold(gf, dir, part)
+		if err != nil {
+			return nil, err
+		}
+		switch c := child.(type) {
+		case nil:
+			if !create {
+				return nil, nil
+			}
+			if dir, err = gf.addDirectory(dir, part); err != nil {
+				return nil, err
+			}
+		case *DirectoryRecord:
+			dir = c
+		default:
+			return nil, fmt.Errorf("'%s' is a file: %w", child.GetPath(), ErrNotDirectory)
+		}
+	}
+	return dir, nil
+}
+
+// Remove deletes the child with the given name from dr, turning its record into free space,
+// along with the records of everything below it for a directory. dr is rewritten without the
+// entry, moving it if needed, and its hash is renewed by Flush.
+func (dr *DirectoryRecord) Remove(name string, gf *GGPKFile) error {
+	if !gf.writable {
+		return fmt.Errorf("GGPK file is opened read-only")
+	}
+	children, err := dr.GetChildren(gf)
+	if err != nil {
+		return fmt.Errorf("failed to get children of '%s': %w", dr.GetPath(), err)
+	}
+	i := slices.IndexFunc(children, func(c TreeNode) bool { return c.GetName() == name })
+	if i == -1 {
+		return fmt.Errorf("child node '%s' in directory '%s': %w", name, dr.GetPath(), ErrNotFound)
+	}
+	child := children[i]
+	// Children are loaded in the order of the entries
+	dr.Entries = slices.Delete(dr.Entries, i, i+1)
+	dr.Children = slices.Delete(children, i, i+1)
+	if err := gf.writeDirectoryRecord(dr); err != nil {
+		return err
+	}
+	gf.dirtyHashes[dr] = struct{}{}
+	if err := gf.freeNode(child); err != nil {
+		return fmt.Errorf("failed to free '%s': %w", child.GetPath(), err)
+	}
+	return nil
+}
+
+// freeNode turns the record of a removed node into free space, children first for a directory.
+func (gf *GGPKFile) freeNode(node TreeNode) error {
+	return WalkPostOrder(gf, node, func(_ string, node TreeNode, err error) error {
+		if err != nil {
+			return err
+		}
+		switch n := node.(type) {
+		case *FileRecord:
+			return gf.markAsFree(n.Offset, n.Length)
+		case *DirectoryRecord:
+			delete(gf.dirtyHashes, n) // Its hash must not be written into the free space
+			return gf.markAsFree(n.Offset, n.Length)
+		}
+		return fmt.Errorf("unexpected node type %T", node)
+	})
+}
+
+// RenewHash recalculates the hash of a directory from the hashes of its children,
+// or replaces it with the given hash if not nil. The parent is marked for renewal by Flush.
+func (gf *GGPKFile) RenewHash(dr *DirectoryRecord, hash *[HashSize]byte) error {
+	if hash != nil {
+		dr.Hash = *hash
+	} else {
+		children, err := dr.GetChildren(gf)
+		if err != nil {
+			return fmt.Errorf("failed to get children of '%s' for hashing: %w", dr.GetPath(), err)
+		}
+		h := sha256.New()
+		for _, child := range children {
+			switch c := child.(type) {
+			case *FileRecord:
+				h.Write(c.Hash[:])
+			case *DirectoryRecord:
+				h.Write(c.Hash[:])
+			}
+		}
+		h.Sum(dr.Hash[:0])
+	}
+	if err := gf.writeAt(dr.Offset+RecordHeaderSize+4+4, dr.Hash[:]); err != nil {
+		return fmt.Errorf("failed to write hash of directory '%s': %w", dr.GetPath(), err)
+	}
+	delete(gf.dirtyHashes, dr)
+	if dr.parent != nil {
+		gf.dirtyHashes[dr.parent] = struct{}{} // The parent hash depends on this one
+	}
+	return nil
+}
+
+// RenewHashes recalculates the hashes of all directories modified through this GGPKFile.
+// The hashes of Root and its direct children are kept unless forceRenewRoot is true,
+// since changing them makes the game start patching and revert all modifications.
+func (gf *GGPKFile) RenewHashes(forceRenewRoot bool) error {
+	for {
+		changed := false
+		for dr := range gf.dirtyHashes {
+			if !forceRenewRoot && (dr == gf.Root || dr.parent == gf.Root) {
+				continue
+			}
+			if err := gf.RenewHash(dr, nil); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+	}
+}
+
+// Flush renews the directory hashes after modifications and commits them.
+// If it fails, the GGPKFile should be closed; the next Open finishes or undoes the commit.
+func (gf *GGPKFile) Flush() error {
+	if !gf.writable {
+		return nil
+	}
+	if err := gf.RenewHashes(false); err != nil {
+		return err
+	}
+	return gf.reader.(*txFile).commit()
+}
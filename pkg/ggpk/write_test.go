@@ -0,0 +1,326 @@
+package ggpk_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+func openReadWrite(t *testing.T, path string) *ggpk.GGPKFile {
+	t.Helper()
+	gf, err := ggpk.OpenReadWrite(path)
+	if err != nil {
+		t.Fatalf("OpenReadWrite failed: %v", err)
+	}
+	return gf
+}
+
+func getFile(t *testing.T, gf *ggpk.GGPKFile, path string) *ggpk.FileRecord {
+	t.Helper()
+	node, err := gf.GetNodeByPath(path)
+	if err != nil {
+		t.Fatalf("GetNodeByPath(%s) failed: %v", path, err)
+	}
+	fr, ok := node.(*ggpk.FileRecord)
+	if !ok {
+		t.Fatalf("Expected FileRecord at %s, got %T", path, node)
+	}
+	return fr
+}
+
+func getDir(t *testing.T, gf *ggpk.GGPKFile, path string) *ggpk.DirectoryRecord {
+	t.Helper()
+	node, err := gf.GetNodeByPath(path)
+	if err != nil {
+		t.Fatalf("GetNodeByPath(%s) failed: %v", path, err)
+	}
+	dr, ok := node.(*ggpk.DirectoryRecord)
+	if !ok {
+		t.Fatalf("Expected DirectoryRecord at %s, got %T", path, node)
+	}
+	return dr
+}
+
+// checkContent reopens the GGPK read-only and compares file contents and directory hashes
+// against a freshly built GGPK holding the expected files.
+func checkContent(t *testing.T, path string, expected map[string][]byte, dirs ...string) {
+	t.Helper()
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open after writing failed: %v", err)
+	}
+	defer gf.Close()
+	want, err := ggpk.Open(ggpktest.WriteFile(t, expected))
+	if err != nil {
+		t.Fatalf("Open of expected GGPK failed: %v", err)
+	}
+	defer want.Close()
+
+	for p, content := range expected {
+		fr := getFile(t, gf, p)
+		data, err := gf.ReadFileData(fr)
+		if err != nil {
+			t.Fatalf("ReadFileData(%s) failed: %v", p, err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Errorf("Content of %s is %q, expected %q", p, data, content)
+		}
+		if fr.Hash != sha256.Sum256(content) {
+			t.Errorf("Hash of %s was not updated", p)
+		}
+	}
+	for _, d := range dirs {
+		if getDir(t, gf, d).Hash != getDir(t, want, d).Hash {
+			t.Errorf("Hash of directory %s does not match the expected one", d)
+		}
+	}
+}
+
+func TestWriteFileData_SameLength(t *testing.T) {
+	files := map[string][]byte{
+		"Art/Sub/a.txt": []byte("old content"),
+		"Art/b.txt":     []byte("other file"),
+	}
+	path := ggpktest.WriteFile(t, files)
+
+	gf := openReadWrite(t, path)
+	oldOffset := getFile(t, gf, "Art/Sub/a.txt").Offset
+	if err := gf.WriteFileData(getFile(t, gf, "Art/Sub/a.txt"), []byte("new content")); err != nil {
+		t.Fatalf("WriteFileData failed: %v", err)
+	}
+	// Committed records are never overwritten, so the old content stays until the commit
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	files["Art/Sub/a.txt"] = []byte("new content")
+	checkContent(t, path, files, "Art/Sub")
+
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+	if free, err := gf.FreeRecords(); err != nil || len(free) != 1 || free[0].Offset != oldOffset {
+		t.Errorf("Expected the old record to be free space, got %d FreeRecords (err %v)", len(free), err)
+	}
+}
+
+func TestWriteFileData_Relocate(t *testing.T) {
+	files := map[string][]byte{
+		"Art/Sub/a.txt": []byte("some content that is long enough to leave free space"),
+		"Art/Sub/c.txt": []byte("the last file"),
+		"Art/b.txt":     []byte("other file"),
+	}
+	path := ggpktest.WriteFile(t, files)
+
+	gf := openReadWrite(t, path)
+	oldOffset := getFile(t, gf, "Art/Sub/a.txt").Offset
+	// Growing moves the record to the end and turns its old place into a FreeRecord
+	if err := gf.WriteFileData(getFile(t, gf, "Art/Sub/a.txt"), []byte("grown content that no longer fits into its old record at all")); err != nil {
+		t.Fatalf("WriteFileData (grow) failed: %v", err)
+	}
+	free, err := gf.FreeRecords()
+	if err != nil {
+		t.Fatalf("FreeRecords failed: %v", err)
+	}
+	if len(free) != 1 || free[0].Offset != oldOffset {
+		t.Fatalf("Expected one FreeRecord at offset %d, got %d records", oldOffset, len(free))
+	}
+	// The freed space is only reused once the move is committed
+	if err := gf.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	// Shrinking another file moves it into the free space, splitting it
+	if err := gf.WriteFileData(getFile(t, gf, "Art/Sub/c.txt"), []byte("tiny")); err != nil {
+		t.Fatalf("WriteFileData (shrink) failed: %v", err)
+	}
+	if c := getFile(t, gf, "Art/Sub/c.txt"); c.Offset != oldOffset {
+		t.Errorf("Expected shrunk file to reuse free space at %d, got offset %d", oldOffset, c.Offset)
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	files["Art/Sub/a.txt"] = []byte("grown content that no longer fits into its old record at all")
+	files["Art/Sub/c.txt"] = []byte("tiny")
+	checkContent(t, path, files, "Art/Sub")
+
+	gf, err = ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+	if free, err := gf.FreeRecords(); err != nil || len(free) != 1 || free[0].Offset <= oldOffset {
+		t.Errorf("Expected the remaining free space after the shrunk file, got %d records (err %v)", len(free), err)
+	}
+}
+
+func TestWriteFileData_ReadOnly(t *testing.T) {
+	gf, err := ggpk.Open(ggpktest.WriteFile(t, map[string][]byte{"a.txt": []byte("content")}))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+	if err := gf.WriteFileData(getFile(t, gf, "a.txt"), []byte("changed")); err == nil {
+		t.Error("Expected error when writing to a read-only GGPK, got nil")
+	}
+}
+
+func TestRenewHashes_KeepsRoot(t *testing.T) {
+	path := ggpktest.WriteFile(t, map[string][]byte{"Art/Sub/a.txt": []byte("old content")})
+	gf := openReadWrite(t, path)
+	artHash := getDir(t, gf, "Art").Hash
+	if err := gf.WriteFileData(getFile(t, gf, "Art/Sub/a.txt"), []byte("new content")); err != nil {
+		t.Fatalf("WriteFileData failed: %v", err)
+	}
+	if err := gf.RenewHashes(false); err != nil {
+		t.Fatalf("RenewHashes failed: %v", err)
+	}
+	if getDir(t, gf, "Art").Hash != artHash {
+		t.Error("Hash of a direct child of root changed without forceRenewRoot")
+	}
+	if err := gf.RenewHashes(true); err != nil {
+		t.Fatalf("RenewHashes(true) failed: %v", err)
+	}
+	if getDir(t, gf, "Art").Hash == artHash {
+		t.Error("Hash of a direct child of root was not renewed with forceRenewRoot")
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	checkContent(t, path, map[string][]byte{"Art/Sub/a.txt": []byte("new content")}, "Art", "Art/Sub", "")
+}
+
+func TestFindOrAdd(t *testing.T) {
+	files := map[string][]byte{"Art/Sub/a.txt": []byte("a")}
+	path := ggpktest.WriteFile(t, files)
+
+	gf := openReadWrite(t, path)
+	deep, err := gf.Root.FindOrAddDirectory("Art/New/Deep", gf)
+	if err != nil {
+		t.Fatalf("FindOrAddDirectory failed: %v", err)
+	}
+	if again, err := gf.Root.FindOrAddDirectory("art/new/deep/", gf); err != nil || again != deep {
+		t.Errorf("Expected FindOrAddDirectory to find the created directory ignoring case, got %v", err)
+	}
+	if sub, err := getDir(t, gf, "Art").FindOrAddDirectory("SUB", gf); err != nil || sub != getDir(t, gf, "Art/Sub") {
+		t.Errorf("Expected FindOrAddDirectory to find the existing directory, got %v", err)
+	}
+
+	fr, err := gf.Root.FindOrAddFile("Art/New/f.bin", 16, gf)
+	if err != nil {
+		t.Fatalf("FindOrAddFile failed: %v", err)
+	}
+	if fr.DataLength != 16 {
+		t.Errorf("Expected 16 preallocated bytes, got %d", fr.DataLength)
+	}
+	offset := fr.Offset
+	content := []byte("sixteen bytes!!!")
+	if err := gf.WriteFileData(fr, content); err != nil {
+		t.Fatalf("WriteFileData failed: %v", err)
+	}
+	if fr.Offset != offset {
+		t.Errorf("Expected the preallocated file to be written in place, moved from %d to %d", offset, fr.Offset)
+	}
+	if again, err := gf.Root.FindOrAddFile("Art/New/F.bin", 0, gf); err != nil || again != fr {
+		t.Errorf("Expected FindOrAddFile to find the created file, got %v", err)
+	}
+	if _, err := deep.FindOrAddFile("g.txt", 0, gf); err != nil {
+		t.Fatalf("FindOrAddFile of an empty file failed: %v", err)
+	}
+	if _, err := gf.Root.FindOrAddFile("Art/Sub/a.txt/b.txt", 0, gf); err == nil {
+		t.Error("Expected an error adding a file below a file")
+	}
+	if _, err := gf.Root.FindOrAddFile("Art/New", 0, gf); err == nil {
+		t.Error("Expected an error for a path naming a directory")
+	}
+	for _, p := range []string{"Art/../x.txt", "./x.txt", "Art/..", `Art\x.txt`} {
+		if _, err := gf.Root.FindOrAddFile(p, 0, gf); err == nil {
+			t.Errorf("Expected an error adding '%s'", p)
+		}
+		if _, err := gf.Root.FindOrAddDirectory(p, gf); err == nil {
+			t.Errorf("Expected an error adding the directory '%s'", p)
+		}
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	files["Art/New/f.bin"] = content
+	files["Art/New/Deep/g.txt"] = []byte{}
+	checkContent(t, path, files, "Art/New", "Art/New/Deep", "Art/Sub")
+}
+
+func TestRemove(t *testing.T) {
+	files := map[string][]byte{
+		"Art/Sub/a.txt":         []byte("removed file"),
+		"Art/Sub/c.txt":         []byte("kept file"),
+		"Art/Lang/French/x.txt": []byte("removed with its directory"),
+		"Art/Lang/y.txt":        []byte("also removed"),
+		"Art/b.txt":             []byte("other file"),
+	}
+	path := ggpktest.WriteFile(t, files)
+
+	gf := openReadWrite(t, path)
+	removed := []int64{
+		getFile(t, gf, "Art/Sub/a.txt").Offset,
+		getFile(t, gf, "Art/Lang/French/x.txt").Offset,
+		getFile(t, gf, "Art/Lang/y.txt").Offset,
+		getDir(t, gf, "Art/Lang/French").Offset,
+		getDir(t, gf, "Art/Lang").Offset,
+	}
+	if err := getDir(t, gf, "Art/Sub").Remove("a.txt", gf); err != nil {
+		t.Fatalf("Remove(a.txt) failed: %v", err)
+	}
+	if err := getDir(t, gf, "Art").Remove("Lang", gf); err != nil {
+		t.Fatalf("Remove(Lang) failed: %v", err)
+	}
+	if err := getDir(t, gf, "Art").Remove("missing", gf); err == nil {
+		t.Error("Expected error when removing a missing child, got nil")
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	delete(files, "Art/Sub/a.txt")
+	delete(files, "Art/Lang/French/x.txt")
+	delete(files, "Art/Lang/y.txt")
+	checkContent(t, path, files, "Art/Sub")
+
+	gf, err := ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer gf.Close()
+	if _, err := gf.GetNodeByPath("Art/Lang"); err == nil {
+		t.Error("Expected Art/Lang to be gone")
+	}
+	free, err := gf.FreeRecords()
+	if err != nil {
+		t.Fatalf("FreeRecords failed: %v", err)
+	}
+	for _, offset := range removed {
+		covered := false
+		for _, f := range free {
+			covered = covered || offset >= f.Offset && offset < f.Offset+int64(f.Length)
+		}
+		if !covered {
+			t.Errorf("Removed record at offset %d is not free space", offset)
+		}
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	return fi.Size()
+}
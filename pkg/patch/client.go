@@ -0,0 +1,347 @@
+package patch
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+// Known patch server endpoints, mirroring PatchClient.ServerEndPoints in LibGGPK3.
+const (
+	ServerUS  = "patch.pathofexile.com:12995"
+	ServerTW  = "patch.pathofexile.tw:12999"
+	ServerUS2 = "patch.pathofexile2.com:13060"
+	ServerTW2 = "patch.pathofexile2.tw:13070"
+)
+
+// ProtocolVersion is the only patch protocol version currently supported.
+const ProtocolVersion = 6
+
+// Opcodes of the patch protocol. Requests are odd, their responses are request+1.
+const (
+	opConnect                = 1
+	opConnectResponse        = 2
+	opQueryDirectory         = 3
+	opQueryDirectoryResponse = 4
+	opPatchNotes             = 5
+	opPatchNotesResponse     = 6
+)
+
+// HashSize is the size of the SHA-256 hashes reported for each entry.
+const HashSize = 32
+
+// ErrDirectoryNotFound is returned by QueryDirectory when the server has no such directory.
+// The server signals this by sending an empty response.
+var ErrDirectoryNotFound = errors.New("directory not found on patch server")
+
+// EntryInfo describes a file or directory reported by the patch server.
+type EntryInfo struct {
+	Name     string
+	FileSize int32 // -1 for directories
+	Hash     [HashSize]byte
+}
+
+// IsDirectory reports whether the entry is a directory.
+func (e EntryInfo) IsDirectory() bool {
+	return e.FileSize == -1
+}
+
+// Client speaks the patch server protocol over a net.Conn.
+// Requests are serialized; calling methods concurrently only causes more waiting.
+type Client struct {
+	// CdnURL is the base URL to download patch files from, received during the handshake.
+	CdnURL string
+	// HTTPClient is used by UpdateNode to download files from CdnURL. nil means http.DefaultClient.
+	HTTPClient *http.Client
+
+	conn net.Conn
+	addr string // Remote address used by Dial, empty if the client was created from an existing conn
+	mu   sync.Mutex
+}
+
+// Dial connects to the patch server at addr (host:port) and performs the handshake.
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to patch server %s: %w", addr, err)
+	}
+	c, err := NewClient(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.addr = addr
+	return c, nil
+}
+
+// NewClient performs the handshake over an already established connection.
+// The connection is owned by the returned Client and closed by Close.
+func NewClient(ctx context.Context, conn net.Conn) (*Client, error) {
+	c := &Client{conn: conn}
+	if err := c.handshake(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetPatchCdnURL connects to the server, returns its CDN URL and disconnects.
+func GetPatchCdnURL(ctx context.Context, addr string) (string, error) {
+	c, err := Dial(ctx, addr)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	return c.CdnURL, nil
+}
+
+// Close closes the underlying connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.Close()
+}
+
+// Reconnect drops the current connection and dials the server again.
+// It is only available for clients created by Dial.
+func (c *Client) Reconnect(ctx context.Context) error {
+	if c.addr == "" {
+		return fmt.Errorf("cannot reconnect a client that was not created by Dial")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("failed to reconnect to patch server %s: %w", c.addr, err)
+	}
+	c.mu.Lock()
+	c.conn.Close()
+	c.conn = conn
+	c.mu.Unlock()
+	return c.handshake(ctx)
+}
+
+// withDeadline makes blocking I/O on the connection honour ctx for the duration of fn.
+func (c *Client) withDeadline(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(d)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Unix(1, 0)) // Unblock pending reads/writes
+	})
+	err := fn()
+	stop()
+	c.conn.SetDeadline(time.Time{})
+	if ctxErr := ctx.Err(); ctxErr != nil && err != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func (c *Client) handshake(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.withDeadline(ctx, func() error {
+		if _, err := c.conn.Write([]byte{opConnect, ProtocolVersion}); err != nil {
+			return fmt.Errorf("failed to send connect request: %w", err)
+		}
+		// Opcode, 32 unused bytes, then a big-endian uint16 length of the UTF-16 URL
+		header := make([]byte, 1+32+2)
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			return fmt.Errorf("failed to read connect response: %w", err)
+		}
+		if header[0] != opConnectResponse {
+			return fmt.Errorf("invalid connect response opcode %d", header[0])
+		}
+		url, err := readUTF16(c.conn, int(binary.BigEndian.Uint16(header[33:])))
+		if err != nil {
+			return fmt.Errorf("failed to read CDN URL: %w", err)
+		}
+		c.CdnURL = url
+		return nil
+	})
+}
+
+// QueryDirectory returns the entries of the directory at path, which is a GGPK path
+// without leading or trailing slash ("" for the root).
+// ErrDirectoryNotFound is returned if the server doesn't know the directory.
+func (c *Client) QueryDirectory(ctx context.Context, path string) ([]EntryInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var entries []EntryInfo
+	err := c.withDeadline(ctx, func() error {
+		units := utf16.Encode([]rune(path))
+		if len(units) > 0xFFFF {
+			return fmt.Errorf("directory path too long: %d characters", len(units))
+		}
+		request := make([]byte, 3, 3+len(units)*2)
+		request[0] = opQueryDirectory
+		binary.BigEndian.PutUint16(request[1:], uint16(len(units)))
+		for _, u := range units {
+			request = binary.LittleEndian.AppendUint16(request, u)
+		}
+		if _, err := c.conn.Write(request); err != nil {
+			return fmt.Errorf("failed to send directory query for '%s': %w", path, err)
+		}
+
+		// Opcode + compressedLen + decompressedLen + compressedLen (again), all big-endian
+		header := make([]byte, 1+4+4+4)
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			if errors.Is(err, io.EOF) { // Nothing sent back
+				return fmt.Errorf("%w: '%s'", ErrDirectoryNotFound, path)
+			}
+			return fmt.Errorf("failed to read directory response header for '%s': %w", path, err)
+		}
+		if header[0] != opQueryDirectoryResponse {
+			return fmt.Errorf("invalid directory response opcode %d", header[0])
+		}
+		compressedLen := int32(binary.BigEndian.Uint32(header[1:]))
+		decompressedLen := int32(binary.BigEndian.Uint32(header[5:]))
+		if compressedLen < 0 || decompressedLen < 0 {
+			return fmt.Errorf("invalid directory response lengths (compressed %d, decompressed %d)", compressedLen, decompressedLen)
+		}
+		compressed := make([]byte, compressedLen)
+		if _, err := io.ReadFull(c.conn, compressed); err != nil {
+			return fmt.Errorf("failed to read directory response body for '%s': %w", path, err)
+		}
+		decompressed := make([]byte, decompressedLen)
+		n, err := lz4.UncompressBlock(compressed, decompressed)
+		if err != nil {
+			return fmt.Errorf("failed to decompress directory response for '%s': %w", path, err)
+		}
+		entries, err = parseDirectoryListing(decompressed[:n])
+		if err != nil {
+			return fmt.Errorf("failed to parse directory response for '%s': %w", path, err)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// parseDirectoryListing decodes the decompressed body of a directory response.
+// All fields in the body are little-endian.
+func parseDirectoryListing(data []byte) ([]EntryInfo, error) {
+	r := &sliceReader{data: data}
+	nameLength := r.int32()
+	r.skip(int(nameLength) * 2) // Name of the queried directory
+	count := r.int32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("invalid entry count %d", count)
+	}
+	entries := make([]EntryInfo, 0, count)
+	for i := int32(0); i < count; i++ {
+		var e EntryInfo
+		entryType := r.byte()
+		e.FileSize = r.int32()
+		if entryType == 1 {
+			e.FileSize = -1
+		}
+		e.Name = r.utf16(int(r.int32()))
+		copy(e.Hash[:], r.bytes(HashSize))
+		if r.err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, r.err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// QueryPatchNotesURL asks the server for the URL of the current patch notes.
+func (c *Client) QueryPatchNotesURL(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var url string
+	err := c.withDeadline(ctx, func() error {
+		if _, err := c.conn.Write([]byte{opPatchNotes}); err != nil {
+			return fmt.Errorf("failed to send patch notes request: %w", err)
+		}
+		header := make([]byte, 1+2)
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			return fmt.Errorf("failed to read patch notes response: %w", err)
+		}
+		if header[0] != opPatchNotesResponse {
+			return fmt.Errorf("invalid patch notes response opcode %d", header[0])
+		}
+		var err error
+		url, err = readUTF16(c.conn, int(binary.BigEndian.Uint16(header[1:])))
+		if err != nil {
+			return fmt.Errorf("failed to read patch notes URL: %w", err)
+		}
+		return nil
+	})
+	return url, err
+}
+
+// readUTF16 reads length UTF-16LE code units from r.
+func readUTF16(r io.Reader, length int) (string, error) {
+	buf := make([]byte, length*2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return decodeUTF16(buf), nil
+}
+
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// sliceReader reads little-endian values from a byte slice, remembering the first error.
+type sliceReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sliceReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *sliceReader) skip(n int) { r.bytes(n) }
+
+func (r *sliceReader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *sliceReader) int32() int32 {
+	if b := r.bytes(4); b != nil {
+		return int32(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *sliceReader) utf16(length int) string {
+	if length < 0 {
+		r.err = fmt.Errorf("invalid string length %d", length)
+		return ""
+	}
+	return decodeUTF16(r.bytes(length * 2))
+}
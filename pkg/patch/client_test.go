@@ -0,0 +1,246 @@
+package patch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// fakeServer is an in-process patch server speaking protocol version 6.
+type fakeServer struct {
+	t        *testing.T
+	cdnURL   string
+	notesURL string
+	dirs     map[string][]EntryInfo // Directory path -> entries
+	listener net.Listener
+	queries  []string // Paths queried, in order
+}
+
+func startFakeServer(t *testing.T, cdnURL string, dirs map[string][]EntryInfo) *fakeServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &fakeServer{t: t, cdnURL: cdnURL, notesURL: "https://example.com/patchnotes", dirs: dirs, listener: l}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) addr() string { return s.listener.Addr().String() }
+
+func appendUTF16(b []byte, str string) []byte {
+	for _, u := range utf16.Encode([]rune(str)) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// lz4Literals encodes data as a single literal-only LZ4 block, which is always valid.
+func lz4Literals(data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/255+2)
+	if len(data) < 15 {
+		out = append(out, byte(len(data)<<4))
+	} else {
+		out = append(out, 0xF0)
+		n := len(data) - 15
+		for n >= 255 {
+			out = append(out, 255)
+			n -= 255
+		}
+		out = append(out, byte(n))
+	}
+	return append(out, data...)
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	op := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(conn, op); err != nil {
+			return
+		}
+		switch op[0] {
+		case opConnect:
+			version := make([]byte, 1)
+			if _, err := io.ReadFull(conn, version); err != nil || version[0] != ProtocolVersion {
+				return
+			}
+			resp := make([]byte, 1+32+2)
+			resp[0] = opConnectResponse
+			binary.BigEndian.PutUint16(resp[33:], uint16(len(utf16.Encode([]rune(s.cdnURL)))))
+			conn.Write(appendUTF16(resp, s.cdnURL))
+		case opQueryDirectory:
+			lenBuf := make([]byte, 2)
+			if _, err := io.ReadFull(conn, lenBuf); err != nil {
+				return
+			}
+			pathBuf := make([]byte, int(binary.BigEndian.Uint16(lenBuf))*2)
+			if _, err := io.ReadFull(conn, pathBuf); err != nil {
+				return
+			}
+			path := decodeUTF16(pathBuf)
+			s.queries = append(s.queries, path)
+			entries, ok := s.dirs[path]
+			if !ok {
+				return // Close the connection without answering
+			}
+			var body []byte
+			body = binary.LittleEndian.AppendUint32(body, uint32(len(utf16.Encode([]rune(path)))))
+			body = appendUTF16(body, path)
+			body = binary.LittleEndian.AppendUint32(body, uint32(len(entries)))
+			for _, e := range entries {
+				if e.IsDirectory() {
+					body = append(body, 1)
+					body = binary.LittleEndian.AppendUint32(body, 0)
+				} else {
+					body = append(body, 0)
+					body = binary.LittleEndian.AppendUint32(body, uint32(e.FileSize))
+				}
+				body = binary.LittleEndian.AppendUint32(body, uint32(len(utf16.Encode([]rune(e.Name)))))
+				body = appendUTF16(body, e.Name)
+				body = append(body, e.Hash[:]...)
+			}
+			compressed := lz4Literals(body)
+			resp := []byte{opQueryDirectoryResponse}
+			resp = binary.BigEndian.AppendUint32(resp, uint32(len(compressed)))
+			resp = binary.BigEndian.AppendUint32(resp, uint32(len(body)))
+			resp = binary.BigEndian.AppendUint32(resp, uint32(len(compressed)))
+			conn.Write(append(resp, compressed...))
+		case opPatchNotes:
+			resp := []byte{opPatchNotesResponse}
+			resp = binary.BigEndian.AppendUint16(resp, uint16(len(utf16.Encode([]rune(s.notesURL)))))
+			conn.Write(appendUTF16(resp, s.notesURL))
+		default:
+			s.t.Errorf("fake server received unknown opcode %d", op[0])
+			return
+		}
+	}
+}
+
+func TestClient_Handshake(t *testing.T) {
+	s := startFakeServer(t, "https://patch-cdn.example.com/3.25.0.1/", nil)
+	c, err := Dial(context.Background(), s.addr())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	if c.CdnURL != "https://patch-cdn.example.com/3.25.0.1/" {
+		t.Errorf("Unexpected CDN URL '%s'", c.CdnURL)
+	}
+
+	url, err := GetPatchCdnURL(context.Background(), s.addr())
+	if err != nil {
+		t.Fatalf("GetPatchCdnURL failed: %v", err)
+	}
+	if url != c.CdnURL {
+		t.Errorf("GetPatchCdnURL returned '%s', expected '%s'", url, c.CdnURL)
+	}
+}
+
+func TestClient_QueryDirectory(t *testing.T) {
+	fileHash := sha256.Sum256([]byte("file content"))
+	dirHash := sha256.Sum256([]byte("directory"))
+	s := startFakeServer(t, "http://cdn/", map[string][]EntryInfo{
+		"Data": {
+			{Name: "Mods.dat64", FileSize: 1234, Hash: fileHash},
+			{Name: "Ünicode", FileSize: -1, Hash: dirHash},
+		},
+	})
+	c, err := Dial(context.Background(), s.addr())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+
+	entries, err := c.QueryDirectory(context.Background(), "Data")
+	if err != nil {
+		t.Fatalf("QueryDirectory failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Name != "Mods.dat64" || entries[0].FileSize != 1234 || entries[0].Hash != fileHash || entries[0].IsDirectory() {
+		t.Errorf("Unexpected file entry: %+v", entries[0])
+	}
+	if entries[1].Name != "Ünicode" || !entries[1].IsDirectory() || entries[1].Hash != dirHash {
+		t.Errorf("Unexpected directory entry: %+v", entries[1])
+	}
+
+	// Requests on the same connection keep working
+	url, err := c.QueryPatchNotesURL(context.Background())
+	if err != nil {
+		t.Fatalf("QueryPatchNotesURL failed: %v", err)
+	}
+	if url != s.notesURL {
+		t.Errorf("Expected patch notes URL '%s', got '%s'", s.notesURL, url)
+	}
+}
+
+func TestClient_QueryDirectory_NotFound(t *testing.T) {
+	s := startFakeServer(t, "http://cdn/", map[string][]EntryInfo{})
+	c, err := Dial(context.Background(), s.addr())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+
+	_, err = c.QueryDirectory(context.Background(), "Missing")
+	if !errors.Is(err, ErrDirectoryNotFound) {
+		t.Fatalf("Expected ErrDirectoryNotFound, got %v", err)
+	}
+
+	// The server drops the connection after a miss; Reconnect restores it
+	if err := c.Reconnect(context.Background()); err != nil {
+		t.Fatalf("Reconnect failed: %v", err)
+	}
+	if c.CdnURL != "http://cdn/" {
+		t.Errorf("Unexpected CDN URL after reconnect '%s'", c.CdnURL)
+	}
+}
+
+func TestClient_ContextCancel(t *testing.T) {
+	// A server that accepts but never answers the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Dial(ctx, l.Addr().String()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestParseDirectoryListing_Truncated(t *testing.T) {
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, 0) // Empty directory name
+	body = binary.LittleEndian.AppendUint32(body, 1) // One entry, but no entry data
+	if _, err := parseDirectoryListing(body); err == nil {
+		t.Error("Expected error for truncated listing, got nil")
+	}
+}
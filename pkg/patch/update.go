@@ -0,0 +1,180 @@
+package patch
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// UpdateNode compares node (and everything under it) against the listings of the patch server
+// and downloads every file whose SHA-256 differs from CdnURL, writing it back into gf.
+// Directories whose hash already matches are skipped without descending into them.
+// It returns the number of files written.
+//
+// gf must be opened by ggpk.OpenReadWrite. Entries that exist only locally or only on the
+// server are left untouched. Hashes of updated directories are set to the server's, and
+// the remaining ancestors are renewed when gf is flushed.
+func (c *Client) UpdateNode(ctx context.Context, gf *ggpk.GGPKFile, node ggpk.TreeNode) (int, error) {
+	if err := gf.RenewHashes(false); err != nil {
+		return 0, fmt.Errorf("failed to renew pending hashes: %w", err)
+	}
+
+	var hash [ggpk.HashSize]byte
+	switch n := node.(type) {
+	case *ggpk.FileRecord:
+		hash = n.Hash
+	case *ggpk.DirectoryRecord:
+		hash = n.Hash
+	default:
+		return 0, fmt.Errorf("unsupported node type %T", node)
+	}
+
+	if dr, ok := node.(*ggpk.DirectoryRecord); !ok || dr != gf.Root {
+		parent := node.GetParent()
+		if parent == nil {
+			return 0, fmt.Errorf("node '%s' has no parent", node.GetName())
+		}
+		entries, err := c.queryDirectoryWithRetry(ctx, parent.GetPath())
+		if err != nil {
+			return 0, err
+		}
+		found := false
+		for _, e := range entries {
+			if e.Name == node.GetName() {
+				if e.Hash == hash {
+					return 0, nil // Hash is matched, skip updating
+				}
+				hash, found = e.Hash, true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("'%s' not found on patch server", node.GetPath())
+		}
+	}
+	return c.updateCore(ctx, gf, node, hash)
+}
+
+// updateCore brings node in line with the server, which reported hash for it.
+func (c *Client) updateCore(ctx context.Context, gf *ggpk.GGPKFile, node ggpk.TreeNode, hash [ggpk.HashSize]byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	path := node.GetPath()
+
+	if fr, ok := node.(*ggpk.FileRecord); ok {
+		data, err := c.download(ctx, path)
+		if err != nil {
+			return 0, err
+		}
+		if sha256.Sum256(data) != hash {
+			return 0, fmt.Errorf("downloaded data of '%s' does not match the hash reported by the patch server", path)
+		}
+		if err := gf.WriteFileData(fr, data); err != nil {
+			return 0, fmt.Errorf("failed to write '%s': %w", path, err)
+		}
+		return 1, nil
+	}
+
+	dr := node.(*ggpk.DirectoryRecord)
+	entries, err := c.queryDirectoryWithRetry(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	byName := make(map[string]EntryInfo, len(entries))
+	for _, e := range entries {
+		byName[e.Name] = e
+	}
+
+	children, err := dr.GetChildren(gf)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read children of '%s': %w", path, err)
+	}
+	count := 0
+	for _, child := range children {
+		info, ok := byName[child.GetName()]
+		if !ok {
+			continue
+		}
+		var childHash [ggpk.HashSize]byte
+		switch n := child.(type) {
+		case *ggpk.FileRecord:
+			if info.IsDirectory() {
+				return count, fmt.Errorf("'%s' is a file locally but a directory on the patch server", n.GetPath())
+			}
+			childHash = n.Hash
+		case *ggpk.DirectoryRecord:
+			if !info.IsDirectory() {
+				return count, fmt.Errorf("'%s' is a directory locally but a file on the patch server", n.GetPath())
+			}
+			childHash = n.Hash
+		}
+		if childHash == info.Hash {
+			continue
+		}
+		n, err := c.updateCore(ctx, gf, child, info.Hash)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+
+	if count != 0 {
+		if err := gf.RenewHash(dr, &hash); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// queryDirectoryWithRetry queries a directory, reconnecting once if it fails.
+// After downloading large files from the CDN, the idle connection to the patch server
+// may have been dropped, which also shows up as an empty response.
+func (c *Client) queryDirectoryWithRetry(ctx context.Context, path string) ([]EntryInfo, error) {
+	entries, err := c.QueryDirectory(ctx, path)
+	if err == nil || ctx.Err() != nil || c.addr == "" {
+		return entries, err
+	}
+	if rerr := c.Reconnect(ctx); rerr != nil {
+		return nil, errors.Join(err, rerr)
+	}
+	return c.QueryDirectory(ctx, path)
+}
+
+// download fetches the file at the GGPK path from the CDN.
+func (c *Client) download(ctx context.Context, path string) ([]byte, error) {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	u := strings.TrimSuffix(c.CdnURL, "/") + "/" + strings.Join(segments, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", u, err)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", u, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response of %s: %w", u, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,174 @@
+package patch
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/user/ggpkgo/internal/ggpktest"
+	"github.com/user/ggpkgo/pkg/ggpk"
+)
+
+// listingFromGGPK returns the directory listings a patch server would send for the content of gf.
+func listingFromGGPK(t *testing.T, gf *ggpk.GGPKFile) map[string][]EntryInfo {
+	t.Helper()
+	dirs := make(map[string][]EntryInfo)
+	var walk func(dr *ggpk.DirectoryRecord)
+	walk = func(dr *ggpk.DirectoryRecord) {
+		children, err := dr.GetChildren(gf)
+		if err != nil {
+			t.Fatalf("GetChildren failed: %v", err)
+		}
+		entries := []EntryInfo{}
+		for _, child := range children {
+			switch c := child.(type) {
+			case *ggpk.FileRecord:
+				entries = append(entries, EntryInfo{Name: c.Name, FileSize: c.DataLength, Hash: c.Hash})
+			case *ggpk.DirectoryRecord:
+				entries = append(entries, EntryInfo{Name: c.Name, FileSize: -1, Hash: c.Hash})
+				walk(c)
+			}
+		}
+		dirs[dr.GetPath()] = entries
+	}
+	walk(gf.Root)
+	return dirs
+}
+
+func TestClient_UpdateNode(t *testing.T) {
+	good := map[string][]byte{
+		"Art/Sub/a.txt":       []byte("good content"),
+		"Art/Sub/b.txt":       []byte("unchanged"),
+		"Data/Mods.dat":       []byte("mods data"),
+		"Data/With Space.txt": []byte("escaped url"),
+	}
+	broken := map[string][]byte{
+		"Art/Sub/a.txt":       []byte("bad"), // Different length
+		"Art/Sub/b.txt":       []byte("unchanged"),
+		"Data/Mods.dat":       []byte("mods data"),
+		"Data/With Space.txt": []byte("escaped URL"), // Same length
+	}
+
+	reference, err := ggpk.Open(ggpktest.WriteFile(t, good))
+	if err != nil {
+		t.Fatalf("Open of reference GGPK failed: %v", err)
+	}
+	defer reference.Close()
+
+	var mu sync.Mutex
+	var downloads []string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/patch/")
+		mu.Lock()
+		downloads = append(downloads, path)
+		mu.Unlock()
+		data, ok := good[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer cdn.Close()
+
+	s := startFakeServer(t, cdn.URL+"/patch/", listingFromGGPK(t, reference))
+	c, err := Dial(context.Background(), s.addr())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	c.HTTPClient = cdn.Client()
+
+	path := ggpktest.WriteFile(t, broken)
+	gf, err := ggpk.OpenReadWrite(path)
+	if err != nil {
+		t.Fatalf("OpenReadWrite failed: %v", err)
+	}
+	count, err := c.UpdateNode(context.Background(), gf, gf.Root)
+	if err != nil {
+		t.Fatalf("UpdateNode failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 updated files, got %d", count)
+	}
+	if len(downloads) != 2 {
+		t.Errorf("Expected only mismatched files to be downloaded, got %v", downloads)
+	}
+	if err := gf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	gf, err = ggpk.Open(path)
+	if err != nil {
+		t.Fatalf("Open after update failed: %v", err)
+	}
+	defer gf.Close()
+	for p, content := range good {
+		node, err := gf.GetNodeByPath(p)
+		if err != nil {
+			t.Fatalf("GetNodeByPath(%s) failed: %v", p, err)
+		}
+		data, err := gf.ReadFileData(node.(*ggpk.FileRecord))
+		if err != nil {
+			t.Fatalf("ReadFileData(%s) failed: %v", p, err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Errorf("Content of %s is %q, expected %q", p, data, content)
+		}
+	}
+	for _, p := range []string{"Art", "Art/Sub", "Data"} {
+		node, _ := gf.GetNodeByPath(p)
+		want, _ := reference.GetNodeByPath(p)
+		if node.(*ggpk.DirectoryRecord).Hash != want.(*ggpk.DirectoryRecord).Hash {
+			t.Errorf("Hash of directory %s does not match the server", p)
+		}
+	}
+
+	// Everything matches now, so updating a single file is a no-op
+	downloads = nil
+	gf2, err := ggpk.OpenReadWrite(path)
+	if err != nil {
+		t.Fatalf("OpenReadWrite failed: %v", err)
+	}
+	defer gf2.Close()
+	node, _ := gf2.GetNodeByPath("Art/Sub/a.txt")
+	if count, err := c.UpdateNode(context.Background(), gf2, node); err != nil || count != 0 {
+		t.Errorf("Expected no update for a matching file, got %d (err %v)", count, err)
+	}
+	if len(downloads) != 0 {
+		t.Errorf("Expected no downloads, got %v", downloads)
+	}
+}
+
+func TestClient_UpdateNode_HashMismatch(t *testing.T) {
+	reference, err := ggpk.Open(ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("good content")}))
+	if err != nil {
+		t.Fatalf("Open of reference GGPK failed: %v", err)
+	}
+	defer reference.Close()
+
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tampered data"))
+	}))
+	defer cdn.Close()
+	s := startFakeServer(t, cdn.URL+"/", listingFromGGPK(t, reference))
+	c, err := Dial(context.Background(), s.addr())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	c.HTTPClient = cdn.Client()
+
+	gf, err := ggpk.OpenReadWrite(ggpktest.WriteFile(t, map[string][]byte{"Data/a.txt": []byte("bad content!")}))
+	if err != nil {
+		t.Fatalf("OpenReadWrite failed: %v", err)
+	}
+	defer gf.Close()
+	if _, err := c.UpdateNode(context.Background(), gf, gf.Root); err == nil {
+		t.Error("Expected error for downloaded data not matching the server hash, got nil")
+	}
+}